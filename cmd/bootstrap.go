@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+
+	"gorm.io/gorm"
+
+	"api_authentication/internal/emailpolicy"
+	"api_authentication/internal/user"
+)
+
+// bootstrapAdmin cria a primeira conta de administrador (ou dá o papel admin a uma conta existente).
+//
+//	go run ./cmd bootstrap-admin -username admin -email admin@empresa.com.br
+//
+// A senha vem de BOOTSTRAP_ADMIN_PASSWORD (ou -password), para não ficar no histórico do shell.
+func bootstrapAdmin(db *gorm.DB, emailPolicy *emailpolicy.Policy, args []string) error {
+	flags := flag.NewFlagSet("bootstrap-admin", flag.ContinueOnError)
+	username := flags.String("username", "", "nome de usuário do administrador")
+	email := flags.String("email", "", "email do administrador (apenas se a conta for criada)")
+	password := flags.String("password", os.Getenv("BOOTSTRAP_ADMIN_PASSWORD"), "senha (padrão: BOOTSTRAP_ADMIN_PASSWORD)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" {
+		return errors.New("informe -username")
+	}
+
+	admin, created, err := user.BootstrapAdmin(user.NewUserRepository(db), emailPolicy, *username, *email, *password)
+	if err != nil {
+		return err
+	}
+	if created {
+		log.Printf("Administrador %q criado (userID %d)", admin.Username, admin.ID)
+	} else {
+		log.Printf("Papel %s atribuído ao usuário existente %q (userID %d)", user.AdminRole, admin.Username, admin.ID)
+	}
+	return nil
+}
@@ -3,14 +3,20 @@ package main
 import (
 	"api_authentication/configs"
 	"api_authentication/internal/database"
+	"api_authentication/internal/emailpolicy"
 	"api_authentication/internal/router"
+	"api_authentication/internal/user"
 	"log"
 	"net/http"
+	"os"
 )
 
 func main() {
 	// 1. Carregar variáveis de ambiente
 	configs.LoadEnv()
+	if configs.GetEnv("JWT_SECRET", "") == "" {
+		log.Fatal("JWT_SECRET não está definido nas variáveis de ambiente.")
+	}
 
 	// 2. Conectar ao banco de dados
 	db, err := database.ConnectDB()
@@ -19,6 +25,29 @@ func main() {
 	}
 	log.Println("Conexão com o banco de dados estabelecida com sucesso!")
 
+	// Migrações de dados pendentes (cada uma roda uma única vez por banco)
+	emailPolicy, err := emailpolicy.NewPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Configuração da política de emails inválida: %v", err)
+	}
+	if err := user.RunDataMigrations(user.NewUserRepository(db), emailPolicy); err != nil {
+		log.Fatalf("Erro ao aplicar migrações de dados: %v", err)
+	}
+
+	// Subcomandos de administração: executam e encerram sem subir o servidor
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bootstrap-admin" {
+		if err := bootstrapAdmin(db, emailPolicy, os.Args[2:]); err != nil {
+			log.Fatalf("bootstrap-admin: %v", err)
+		}
+		return
+	}
+
+	// Expurgo periódico das contas excluídas cujo prazo de restauração terminou
+	user.StartPurgeJob(user.NewUserRepository(db))
+
 	// 3. Configurar e iniciar o roteador (gorilla/mux)
 	r := router.SetupRouter(db)
 
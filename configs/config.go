@@ -4,6 +4,7 @@ package configs
 import (
 	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv" // Biblioteca para carregar variáveis de um arquivo .env
 )
@@ -27,3 +28,17 @@ func GetEnv(key string, fallback ...string) string {
 	log.Fatalf("Variável de ambiente %s não definida e sem valor padrão.", key)
 	return "" // Nunca será alcançado devido ao Fatalf
 }
+
+// GetEnvDuration lê uma duração no formato de time.ParseDuration (ex.: "15m", "24h")
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Atenção: valor inválido para %s (%q). Usando %s.", key, value, fallback)
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,77 @@
+// internal/auth/crypto.go
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+
+	"api_authentication/configs"
+)
+
+// encryptionKey retorna a chave AES-256 usada para proteger segredos em repouso.
+// Usa MFA_ENCRYPTION_KEY (64 caracteres hex) ou, na falta dela, deriva do JWT_SECRET.
+func encryptionKey() []byte {
+	if raw := configs.GetEnv("MFA_ENCRYPTION_KEY", ""); raw != "" {
+		key, err := hex.DecodeString(raw)
+		if err == nil && len(key) == 32 {
+			return key
+		}
+		log.Println("Atenção: MFA_ENCRYPTION_KEY inválida (esperado 32 bytes em hex). Derivando chave do JWT_SECRET.")
+	}
+	sum := sha256.Sum256(append([]byte("mfa-encryption:"), jwtSecret()...))
+	return sum[:]
+}
+
+// EncryptSecret criptografa um segredo com AES-GCM e retorna o resultado em base64
+func EncryptSecret(plaintext string) (string, error) {
+	block, err := aes.NewCipher(encryptionKey())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret reverte EncryptSecret
+func DecryptSecret(ciphertext string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(encryptionKey())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("segredo criptografado inválido")
+	}
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
@@ -4,6 +4,8 @@ package auth
 import (
 	"errors" // Import errors package
 	"log"    // Import log
+	"strconv"
+	"sync"
 	"time"
 
 	"api_authentication/configs" // Importe seu pacote de configs
@@ -11,25 +13,44 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret []byte
-
-func init() {
-	configs.LoadEnv()
+// jwtSecret é lido no primeiro uso, para que os testes possam definir JWT_SECRET antes.
+// O servidor confere a variável na inicialização (cmd/main.go).
+var jwtSecret = sync.OnceValue(func() []byte {
 	secret := configs.GetEnv("JWT_SECRET", "")
 	if secret == "" {
 		panic("JWT_SECRET não está definido nas variáveis de ambiente.")
 	}
-	jwtSecret = []byte(secret)
+	return []byte(secret)
+})
+
+func init() {
+	configs.LoadEnv()
 }
 
+// Finalidades de tokens que não são de acesso
+const (
+	PurposeTrustedDevice = "trusted_device" // Dispositivo confiável que dispensa o segundo fator
+)
+
 type Claims struct {
-	UserID uint `json:"user_id"`
+	UserID  uint   `json:"user_id"`
+	Purpose string `json:"purpose,omitempty"` // Vazio para tokens de acesso
+	OrgID   uint   `json:"org_id,omitempty"`  // Organização ativa (tokens de acesso)
+	// Papéis e grupos efetivos no momento da emissão (tokens de acesso). São informativos:
+	// a API recarrega a autorização do banco a cada requisição.
+	Roles  []string `json:"roles,omitempty"`
+	Groups []string `json:"groups,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(userID uint) (string, error) {
+// GenerateJWT gera o token de acesso; orgID é a organização ativa (zero se o usuário não tiver nenhuma),
+// roles e groups são os papéis e grupos efetivos do usuário
+func GenerateJWT(userID, orgID uint, roles, groups []string) (string, error) {
 	claims := &Claims{
 		UserID: userID,
+		OrgID:  orgID,
+		Roles:  roles,
+		Groups: groups,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)), // Token válido por 24 horas
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -38,18 +59,69 @@ func GenerateJWT(userID uint) (string, error) {
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return token.SignedString(jwtSecret())
+}
+
+// GenerateTrustedDeviceToken gera o token assinado de um dispositivo confiável. O ID do
+// dispositivo vai no jti para que o token possa ser revogado apagando o registro.
+func GenerateTrustedDeviceToken(userID, deviceID uint, expiresAt time.Time) (string, error) {
+	claims := &Claims{
+		UserID:  userID,
+		Purpose: PurposeTrustedDevice,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        strconv.FormatUint(uint64(deviceID), 10),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtSecret())
+}
+
+// ValidateTrustedDeviceToken valida o token de um dispositivo confiável e retorna o ID do dispositivo
+func ValidateTrustedDeviceToken(tokenString string) (*Claims, uint, error) {
+	claims, err := parseJWT(tokenString)
+	if err != nil {
+		return nil, 0, err
+	}
+	if claims.Purpose != PurposeTrustedDevice {
+		return nil, 0, errors.New("token de dispositivo confiável inválido")
+	}
+	deviceID, err := strconv.ParseUint(claims.ID, 10, 32)
+	if err != nil {
+		return nil, 0, errors.New("token de dispositivo confiável inválido")
+	}
+	return claims, uint(deviceID), nil
 }
 
 func ValidateJWT(tokenString string) (*Claims, error) {
 	log.Printf("Attempting to validate tokenString: '%s'", tokenString) // Log the token string
 
+	claims, err := parseJWT(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens com finalidade específica (ex.: dispositivo confiável) não dão acesso à API
+	if claims.Purpose != "" {
+		log.Printf("JWT with purpose %q rejected as access token", claims.Purpose)
+		return nil, errors.New("token JWT não é um token de acesso")
+	}
+
+	log.Printf("JWT token valid for userID: %d", claims.UserID) // Log successful validation
+	return claims, nil
+}
+
+// parseJWT verifica assinatura e validade do token e retorna suas claims
+func parseJWT(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		// Ensure the signing method is what we expect
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("método de assinatura inesperado")
 		}
-		return jwtSecret, nil
+		return jwtSecret(), nil
 	})
 
 	// CRITICAL FIX: Check for error immediately after parsing the token
@@ -71,6 +143,5 @@ func ValidateJWT(tokenString string) (*Claims, error) {
 		return nil, errors.New("claims do token JWT inválidos")
 	}
 
-	log.Printf("JWT token valid for userID: %d", claims.UserID) // Log successful validation
 	return claims, nil
 }
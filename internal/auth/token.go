@@ -0,0 +1,72 @@
+// internal/auth/token.go
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"strings"
+)
+
+// recoveryCodeEncoding gera códigos legíveis (sem padding, em minúsculas)
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateOpaqueToken gera um token aleatório de 256 bits, seguro para uso em URLs
+func GenerateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// GenerateRecoveryCode gera um código de recuperação de uso único no formato xxxxx-xxxxx
+func GenerateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// GenerateInviteCode gera um código de convite (100 bits) no formato xxxxx-xxxxx-xxxxx-xxxxx.
+// Assim como os códigos de recuperação, deve ser normalizado com NormalizeRecoveryCode.
+func GenerateInviteCode() (string, error) {
+	b := make([]byte, 13)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))[:20]
+	return code[:5] + "-" + code[5:10] + "-" + code[10:15] + "-" + code[15:], nil
+}
+
+// NormalizeRecoveryCode remove separadores e espaços para que o código possa ser
+// digitado com ou sem hífen e em qualquer caixa
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// HashToken retorna o SHA-256 (hex) de um token. Tokens aleatórios de alta entropia
+// não precisam de um hash lento como o bcrypt para serem armazenados com segurança.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateNumericCode gera um código numérico aleatório com a quantidade de dígitos informada
+func GenerateNumericCode(digits int) (string, error) {
+	code := make([]byte, digits)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		code[i] = byte('0' + n.Int64())
+	}
+	return string(code), nil
+}
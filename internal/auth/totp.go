@@ -0,0 +1,69 @@
+// internal/auth/totp.go
+package auth
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"image/png"
+	"time"
+
+	"api_authentication/configs"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// totpSkew é quantos passos (de 30s) antes/depois do atual são aceitos
+const totpSkew = 1
+
+// totpQRCodeSize é a largura/altura em pixels do QR code gerado no cadastro
+const totpQRCodeSize = 256
+
+// GenerateTOTPKey gera um novo segredo TOTP (RFC 6238) para a conta informada
+func GenerateTOTPKey(accountName string) (*otp.Key, error) {
+	return totp.Generate(totp.GenerateOpts{
+		Issuer:      configs.GetEnv("TOTP_ISSUER", "api_authentication"),
+		AccountName: accountName,
+	})
+}
+
+// TOTPQRCodePNG gera o QR code, em PNG, da URI otpauth:// da chave
+func TOTPQRCodePNG(key *otp.Key) ([]byte, error) {
+	img, err := key.Image(totpQRCodeSize, totpQRCodeSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ValidateTOTPCode verifica o código contra o segredo e retorna o passo de tempo em
+// que ele foi aceito. Passos menores ou iguais a lastStep são recusados, impedindo que
+// o mesmo código seja reutilizado dentro da janela de validade.
+func ValidateTOTPCode(secret, code string, lastStep int64, now time.Time) (int64, bool) {
+	opts := totp.ValidateOpts{
+		Period:    30,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	}
+
+	current := now.Unix() / int64(opts.Period)
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		step := current + offset
+		if step <= lastStep {
+			continue
+		}
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*int64(opts.Period), 0), opts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,29 @@
+// internal/auth/webauthn.go
+package auth
+
+import (
+	"strings"
+
+	"api_authentication/configs"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// NewWebAuthn cria o relying party WebAuthn a partir das variáveis de ambiente.
+// WEBAUTHN_RP_ORIGINS aceita várias origens separadas por vírgula.
+func NewWebAuthn() (*webauthn.WebAuthn, error) {
+	var origins []string
+	for _, origin := range strings.Split(configs.GetEnv("WEBAUTHN_RP_ORIGINS", "http://localhost:5500"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:                  configs.GetEnv("WEBAUTHN_RP_ID", "localhost"),
+		RPDisplayName:         configs.GetEnv("WEBAUTHN_RP_NAME", "api_authentication"),
+		RPOrigins:             origins,
+		AttestationPreference: protocol.PreferNoAttestation,
+	})
+}
@@ -0,0 +1,319 @@
+// internal/authz/engine.go
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"gopkg.in/yaml.v3"
+
+	"api_authentication/configs"
+)
+
+// Modos de aplicação de uma política
+const (
+	ModeEnforce = "enforce" // Nega a requisição quando a expressão é falsa
+	ModeDryRun  = "dry_run" // Só registra no log a decisão que seria tomada
+)
+
+// policyFile é o formato do arquivo de políticas (POLICY_FILE)
+type policyFile struct {
+	Mode     string       `yaml:"mode"` // Modo padrão das políticas do arquivo
+	Policies []policySpec `yaml:"policies"`
+}
+
+type policySpec struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Routes      []string `yaml:"routes"`  // Rotas no formato do gin (ex.: /api/users/:id)
+	Methods     []string `yaml:"methods"` // Vazio: todos os métodos
+	Expression  string   `yaml:"expression"`
+	Mode        string   `yaml:"mode"`
+}
+
+// policy é uma política já compilada
+type policy struct {
+	name    string
+	methods map[string]bool
+	dryRun  bool
+	program cel.Program
+}
+
+// Route é uma rota registrada no roteador (caminho no formato do gin)
+type Route struct {
+	Method string
+	Path   string
+}
+
+// Decision é o resultado de uma política para uma requisição
+type Decision struct {
+	Policy  string
+	Allowed bool
+	DryRun  bool  // A decisão só deve ser registrada, não aplicada
+	Err     error // Falha ao avaliar a expressão; a requisição conta como negada
+}
+
+// Engine avalia políticas escritas em CEL sobre os atributos principal, resource e request.
+// O arquivo é relido quando muda (ver StartReloader); se a nova versão tiver erro, as
+// políticas anteriores continuam valendo.
+type Engine struct {
+	path     string
+	forceDry bool
+	env      *cel.Env
+
+	mu      sync.RWMutex
+	byRoute map[string][]*policy
+	modTime time.Time           // Data de modificação da última versão lida do arquivo
+	routes  map[string][]string // Rotas avaliadas pelo middleware e seus métodos (ver SetRoutes)
+}
+
+// NewEngineFromEnv cria o motor de políticas a partir de POLICY_FILE (sem arquivo, nenhuma
+// política é aplicada) e POLICY_DRY_RUN (true: todas as políticas apenas registram decisões)
+func NewEngineFromEnv() (*Engine, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("principal", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("resource", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Engine{
+		path:     configs.GetEnv("POLICY_FILE", ""),
+		forceDry: configs.GetEnv("POLICY_DRY_RUN", "false") == "true",
+		env:      env,
+		byRoute:  make(map[string][]*policy),
+	}
+	if e.path == "" {
+		return e, nil
+	}
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Reload lê e compila o arquivo de políticas. Em caso de erro nada muda.
+func (e *Engine) Reload() error {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return fmt.Errorf("arquivo de políticas: %w", err)
+	}
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return fmt.Errorf("arquivo de políticas: %w", err)
+	}
+
+	var file policyFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("arquivo de políticas: %w", err)
+	}
+	byRoute, err := e.compile(file)
+	if err != nil {
+		return fmt.Errorf("arquivo de políticas: %w", err)
+	}
+
+	e.mu.Lock()
+	e.byRoute = byRoute
+	e.modTime = info.ModTime()
+	e.mu.Unlock()
+	e.warnUnmatched()
+	return nil
+}
+
+// SetRoutes informa as rotas em que as políticas são avaliadas. Uma política cuja rota (ou
+// método) não corresponde a nenhuma delas nunca seria aplicada, provavelmente por erro de
+// digitação; ela é apontada no log agora e a cada recarga do arquivo.
+func (e *Engine) SetRoutes(routes []Route) {
+	byPath := make(map[string][]string)
+	for _, r := range routes {
+		byPath[r.Path] = append(byPath[r.Path], r.Method)
+	}
+	e.mu.Lock()
+	e.routes = byPath
+	e.mu.Unlock()
+	e.warnUnmatched()
+}
+
+func (e *Engine) warnUnmatched() {
+	for _, warning := range e.unmatched() {
+		log.Printf("Atenção: %s", warning)
+	}
+}
+
+// unmatched descreve as políticas que não se aplicam a nenhuma rota informada em SetRoutes
+func (e *Engine) unmatched() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.routes == nil {
+		return nil
+	}
+
+	var warnings []string
+	for route, policies := range e.byRoute {
+		methods, known := e.routes[route]
+		for _, p := range policies {
+			if !known {
+				warnings = append(warnings, fmt.Sprintf("política %q: a rota %s não existe ou não passa pelo middleware de políticas", p.name, route))
+				continue
+			}
+			if p.methods == nil {
+				continue
+			}
+			matched := false
+			for _, m := range methods {
+				matched = matched || p.methods[m]
+			}
+			if !matched {
+				warnings = append(warnings, fmt.Sprintf("política %q: nenhum dos métodos informados existe na rota %s (%s)", p.name, route, strings.Join(methods, ", ")))
+			}
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// compile valida e compila todas as políticas do arquivo, agrupadas por rota
+func (e *Engine) compile(file policyFile) (map[string][]*policy, error) {
+	defaultMode, err := parseMode(file.Mode, ModeEnforce)
+	if err != nil {
+		return nil, err
+	}
+
+	byRoute := make(map[string][]*policy)
+	names := make(map[string]bool)
+	for _, spec := range file.Policies {
+		if spec.Name == "" {
+			return nil, errors.New("toda política precisa de um nome")
+		}
+		if names[spec.Name] {
+			return nil, fmt.Errorf("política %q duplicada", spec.Name)
+		}
+		names[spec.Name] = true
+		if len(spec.Routes) == 0 {
+			return nil, fmt.Errorf("política %q: nenhuma rota informada", spec.Name)
+		}
+		mode, err := parseMode(spec.Mode, defaultMode)
+		if err != nil {
+			return nil, fmt.Errorf("política %q: %w", spec.Name, err)
+		}
+
+		ast, issues := e.env.Compile(spec.Expression)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf("política %q: %w", spec.Name, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+			return nil, fmt.Errorf("política %q: a expressão deve resultar em bool, não %s", spec.Name, ast.OutputType())
+		}
+		program, err := e.env.Program(ast)
+		if err != nil {
+			return nil, fmt.Errorf("política %q: %w", spec.Name, err)
+		}
+
+		p := &policy{name: spec.Name, dryRun: mode == ModeDryRun, program: program}
+		if len(spec.Methods) > 0 {
+			p.methods = make(map[string]bool, len(spec.Methods))
+			for _, m := range spec.Methods {
+				p.methods[strings.ToUpper(m)] = true
+			}
+		}
+		for _, route := range spec.Routes {
+			byRoute[route] = append(byRoute[route], p)
+		}
+	}
+	return byRoute, nil
+}
+
+func parseMode(mode, fallback string) (string, error) {
+	switch mode {
+	case "":
+		return fallback, nil
+	case ModeEnforce, ModeDryRun:
+		return mode, nil
+	}
+	return "", fmt.Errorf("modo %q desconhecido (use %s ou %s)", mode, ModeEnforce, ModeDryRun)
+}
+
+// Applies indica se alguma política vale para a rota e o método
+func (e *Engine) Applies(method, route string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, p := range e.byRoute[route] {
+		if p.methods == nil || p.methods[method] {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate avalia as políticas da rota e do método; a requisição só é permitida se todas
+// as políticas aplicadas (não dry-run) a permitirem
+func (e *Engine) Evaluate(method, route string, principal, resource, request map[string]interface{}) []Decision {
+	e.mu.RLock()
+	policies := e.byRoute[route]
+	e.mu.RUnlock()
+
+	vars := map[string]interface{}{"principal": principal, "resource": resource, "request": request}
+	decisions := make([]Decision, 0, len(policies))
+	for _, p := range policies {
+		if p.methods != nil && !p.methods[method] {
+			continue
+		}
+
+		decision := Decision{Policy: p.name, DryRun: p.dryRun || e.forceDry}
+		out, _, err := p.program.Eval(vars)
+		if err != nil {
+			decision.Err = err
+		} else if allowed, ok := out.Value().(bool); ok {
+			decision.Allowed = allowed
+		} else {
+			decision.Err = fmt.Errorf("a expressão resultou em %s, não bool", out.Type())
+		}
+		decisions = append(decisions, decision)
+	}
+	return decisions
+}
+
+// StartReloader confere periodicamente (POLICY_RELOAD_INTERVAL) se o arquivo de políticas
+// mudou e o recarrega em segundo plano
+func (e *Engine) StartReloader() {
+	interval := configs.GetEnvDuration("POLICY_RELOAD_INTERVAL", 30*time.Second)
+	if e.path == "" || interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			info, err := os.Stat(e.path)
+			if err != nil {
+				log.Printf("Erro ao verificar o arquivo de políticas: %v", err)
+				continue
+			}
+			e.mu.RLock()
+			changed := !info.ModTime().Equal(e.modTime)
+			e.mu.RUnlock()
+			if !changed {
+				continue
+			}
+
+			if err := e.Reload(); err != nil {
+				// Guarda a data mesmo assim, para não repetir o erro até o arquivo mudar de novo
+				e.mu.Lock()
+				e.modTime = info.ModTime()
+				e.mu.Unlock()
+				log.Printf("Políticas não recarregadas, as anteriores continuam valendo: %v", err)
+			} else {
+				log.Printf("Políticas recarregadas de %s", e.path)
+			}
+		}
+	}()
+}
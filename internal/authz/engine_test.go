@@ -0,0 +1,156 @@
+package authz
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestEngine grava o arquivo de políticas num diretório temporário e cria o motor a partir dele
+func newTestEngine(t *testing.T, policies string) (*Engine, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	if err := os.WriteFile(path, []byte(policies), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("POLICY_FILE", path)
+	engine, err := NewEngineFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine, path
+}
+
+const testPolicies = `
+policies:
+  - name: self-or-admin
+    routes: [/api/users/:id]
+    methods: [put, DELETE]
+    expression: principal.id == resource.id || "admin" in principal.roles
+  - name: office-ip
+    routes: [/api/admin/roles]
+    mode: dry_run
+    expression: request.ip.startsWith("10.")
+  - name: needs-query
+    routes: [/api/reports]
+    expression: request.query.year == "2026"
+`
+
+func TestEvaluate(t *testing.T) {
+	engine, _ := newTestEngine(t, testPolicies)
+	alice := map[string]interface{}{"id": int64(1), "roles": []string{}}
+	admin := map[string]interface{}{"id": int64(2), "roles": []string{"admin"}}
+
+	tests := []struct {
+		name      string
+		method    string
+		route     string
+		principal map[string]interface{}
+		resource  map[string]interface{}
+		request   map[string]interface{}
+		want      []Decision
+	}{
+		{"próprio usuário", "PUT", "/api/users/:id", alice, map[string]interface{}{"id": int64(1)}, nil,
+			[]Decision{{Policy: "self-or-admin", Allowed: true}}},
+		{"outro usuário", "DELETE", "/api/users/:id", alice, map[string]interface{}{"id": int64(3)}, nil,
+			[]Decision{{Policy: "self-or-admin", Allowed: false}}},
+		{"administrador", "PUT", "/api/users/:id", admin, map[string]interface{}{"id": int64(3)}, nil,
+			[]Decision{{Policy: "self-or-admin", Allowed: true}}},
+		{"método sem política", "GET", "/api/users/:id", alice, map[string]interface{}{"id": int64(3)}, nil,
+			[]Decision{}},
+		{"dry-run", "GET", "/api/admin/roles", admin, nil, map[string]interface{}{"ip": "192.0.2.1"},
+			[]Decision{{Policy: "office-ip", Allowed: false, DryRun: true}}},
+	}
+	for _, tt := range tests {
+		got := engine.Evaluate(tt.method, tt.route, tt.principal, tt.resource, tt.request)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: %d decisões, esperado %d: %+v", tt.name, len(got), len(tt.want), got)
+			continue
+		}
+		for i := range got {
+			if got[i].Err != nil || got[i].Policy != tt.want[i].Policy || got[i].Allowed != tt.want[i].Allowed || got[i].DryRun != tt.want[i].DryRun {
+				t.Errorf("%s: decisão %+v, esperado %+v", tt.name, got[i], tt.want[i])
+			}
+		}
+	}
+
+	// Chave inexistente é erro, e a requisição conta como negada
+	got := engine.Evaluate("GET", "/api/reports", alice, nil, map[string]interface{}{"query": map[string]interface{}{}})
+	if len(got) != 1 || got[0].Err == nil || got[0].Allowed {
+		t.Errorf("chave inexistente: %+v", got)
+	}
+
+	if !engine.Applies("DELETE", "/api/users/:id") || engine.Applies("GET", "/api/users/:id") || engine.Applies("GET", "/api/other") {
+		t.Error("Applies não respeita rotas e métodos das políticas")
+	}
+}
+
+func TestForcedDryRun(t *testing.T) {
+	t.Setenv("POLICY_DRY_RUN", "true")
+	engine, _ := newTestEngine(t, testPolicies)
+	got := engine.Evaluate("DELETE", "/api/users/:id", map[string]interface{}{"id": int64(1), "roles": []string{}}, map[string]interface{}{"id": int64(3)}, nil)
+	if len(got) != 1 || !got[0].DryRun {
+		t.Errorf("POLICY_DRY_RUN ignorado: %+v", got)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := map[string]string{
+		"sem nome":              "policies:\n  - routes: [/a]\n    expression: 'true'\n",
+		"nome duplicado":        "policies:\n  - {name: a, routes: [/a], expression: 'true'}\n  - {name: a, routes: [/b], expression: 'true'}\n",
+		"sem rotas":             "policies:\n  - {name: a, expression: 'true'}\n",
+		"modo desconhecido":     "policies:\n  - {name: a, routes: [/a], mode: audit, expression: 'true'}\n",
+		"modo padrão inválido":  "mode: audit\npolicies: []\n",
+		"expressão inválida":    "policies:\n  - {name: a, routes: [/a], expression: 'principal.id =='}\n",
+		"variável desconhecida": "policies:\n  - {name: a, routes: [/a], expression: 'user.id == 1'}\n",
+		"resultado não bool":    "policies:\n  - {name: a, routes: [/a], expression: '1 + 1'}\n",
+		"yaml inválido":         "policies: [",
+	}
+	for name, file := range tests {
+		path := filepath.Join(t.TempDir(), "policies.yaml")
+		if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("POLICY_FILE", path)
+		if _, err := NewEngineFromEnv(); err == nil {
+			t.Errorf("%s: arquivo aceito", name)
+		}
+	}
+}
+
+func TestReloadKeepsPreviousPoliciesOnError(t *testing.T) {
+	engine, path := newTestEngine(t, testPolicies)
+	if err := os.WriteFile(path, []byte("policies:\n  - {name: a, routes: [/a], expression: '1 +'}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Reload(); err == nil {
+		t.Fatal("arquivo inválido recarregado")
+	}
+	if !engine.Applies("PUT", "/api/users/:id") {
+		t.Error("políticas anteriores descartadas após recarga com erro")
+	}
+}
+
+func TestUnmatchedPolicies(t *testing.T) {
+	engine, _ := newTestEngine(t, testPolicies)
+	if warnings := engine.unmatched(); warnings != nil {
+		t.Errorf("avisos antes de conhecer as rotas: %v", warnings)
+	}
+
+	engine.SetRoutes([]Route{
+		{Method: "GET", Path: "/api/users/:id"},
+		{Method: "DELETE", Path: "/api/users/:id"},
+		{Method: "POST", Path: "/api/admin/roles"}, // office-ip vale para todos os métodos
+	})
+	warnings := engine.unmatched()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], `"needs-query"`) {
+		t.Errorf("esperado aviso só para needs-query (rota inexistente), obtido %v", warnings)
+	}
+
+	engine.SetRoutes([]Route{{Method: "GET", Path: "/api/users/:id"}, {Method: "GET", Path: "/api/admin/roles"}, {Method: "GET", Path: "/api/reports"}})
+	warnings = engine.unmatched()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], `"self-or-admin"`) {
+		t.Errorf("esperado aviso só para self-or-admin (métodos inexistentes), obtido %v", warnings)
+	}
+}
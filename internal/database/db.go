@@ -42,7 +42,30 @@ func ConnectDB() (*gorm.DB, error) {
 		return nil, fmt.Errorf("falha ao conectar ao banco de dados: %w", err)
 	}
 
-	err = db.AutoMigrate(&user.User{})
+	err = db.AutoMigrate(
+		&user.User{},
+		&user.RecoveryCode{},
+		&user.WebAuthnCredential{},
+		&user.WebAuthnSession{},
+		&user.OneTimeToken{},
+		&user.TrustedDevice{},
+		&user.Invitation{},
+		&user.AuditEvent{},
+		&user.DataExport{},
+		&user.ErasureReceipt{},
+		&user.LegalDocument{},
+		&user.LegalAcceptance{},
+		&user.Permission{},
+		&user.Role{},
+		&user.UserRole{},
+		&user.Organization{},
+		&user.Membership{},
+		&user.Group{},
+		&user.GroupUser{},
+		&user.GroupSubgroup{},
+		&user.RelationTuple{},
+		&user.DataMigration{},
+	)
 	if err != nil {
 		log.Fatalf("Falha ao migrar o banco de dados: %v", err)
 		return nil, fmt.Errorf("falha ao migrar o banco de dados: %w", err)
@@ -0,0 +1,173 @@
+// internal/emailpolicy/policy.go
+package emailpolicy
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"api_authentication/configs"
+)
+
+//go:embed disposable_domains.txt
+var bundledDisposableDomains string
+
+// Erros retornados por Policy.Check
+var (
+	ErrDomainNotAllowed = errors.New("domínio de email não permitido")
+	ErrDomainBlocked    = errors.New("domínio de email bloqueado")
+	ErrDisposableEmail  = errors.New("endereços de email descartáveis não são aceitos")
+)
+
+// Policy define quais domínios de email podem ser usados no cadastro e como
+// os endereços são canonicalizados para detectar a mesma caixa postal
+type Policy struct {
+	allowed         []string            // Se não vazio, apenas estes domínios (e subdomínios) são aceitos
+	blocked         []string            // Domínios (e subdomínios) recusados
+	disposable      map[string]struct{} // Domínios descartáveis conhecidos
+	blockDisposable bool
+	stripPlus       bool // Remove +etiqueta nos provedores que a ignoram
+	stripGmailDots  bool // Remove pontos da parte local nos endereços do Gmail
+}
+
+// NewPolicyFromEnv cria a política a partir de EMAIL_ALLOWED_DOMAINS, EMAIL_BLOCKED_DOMAINS,
+// BLOCK_DISPOSABLE_EMAILS, DISPOSABLE_DOMAINS_FILE, EMAIL_CANONICAL_STRIP_PLUS e EMAIL_CANONICAL_STRIP_DOTS
+func NewPolicyFromEnv() (*Policy, error) {
+	var list io.Reader = strings.NewReader(bundledDisposableDomains)
+	if path := configs.GetEnv("DISPOSABLE_DOMAINS_FILE", ""); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("lista de domínios descartáveis: %w", err)
+		}
+		defer f.Close()
+		list = f
+	}
+
+	disposable, err := parseDomainList(list)
+	if err != nil {
+		return nil, fmt.Errorf("lista de domínios descartáveis: %w", err)
+	}
+
+	return &Policy{
+		allowed:         splitDomains(configs.GetEnv("EMAIL_ALLOWED_DOMAINS", "")),
+		blocked:         splitDomains(configs.GetEnv("EMAIL_BLOCKED_DOMAINS", "")),
+		disposable:      disposable,
+		blockDisposable: configs.GetEnv("BLOCK_DISPOSABLE_EMAILS", "true") == "true",
+		stripPlus:       configs.GetEnv("EMAIL_CANONICAL_STRIP_PLUS", "true") == "true",
+		stripGmailDots:  configs.GetEnv("EMAIL_CANONICAL_STRIP_DOTS", "true") == "true",
+	}, nil
+}
+
+// Check verifica se o domínio do email é aceito pela política
+func (p *Policy) Check(email string) error {
+	_, domain := splitEmail(email)
+
+	if len(p.allowed) > 0 && !matchesAny(domain, p.allowed) {
+		return ErrDomainNotAllowed
+	}
+	if matchesAny(domain, p.blocked) {
+		return ErrDomainBlocked
+	}
+	if p.blockDisposable && p.isDisposable(domain) {
+		return ErrDisposableEmail
+	}
+	return nil
+}
+
+// Canonicalize retorna a forma canônica do email: sempre em minúsculas e, nos provedores
+// conhecidos, sem +etiqueta e (Gmail) sem pontos, conforme a configuração
+func (p *Policy) Canonicalize(email string) string {
+	local, domain := splitEmail(email)
+
+	if alias, ok := domainAliases[domain]; ok {
+		domain = alias
+	}
+	if p.stripPlus && plusAddressingProviders[domain] {
+		if i := strings.IndexByte(local, '+'); i >= 0 {
+			local = local[:i]
+		}
+	}
+	if p.stripGmailDots && domain == "gmail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + domain
+}
+
+// isDisposable verifica o domínio e seus domínios pais na lista de descartáveis
+func (p *Policy) isDisposable(domain string) bool {
+	for d := domain; d != ""; {
+		if _, ok := p.disposable[d]; ok {
+			return true
+		}
+		i := strings.IndexByte(d, '.')
+		if i < 0 {
+			break
+		}
+		d = d[i+1:]
+	}
+	return false
+}
+
+// domainAliases mapeia domínios que entregam na mesma caixa postal
+var domainAliases = map[string]string{
+	"googlemail.com": "gmail.com",
+}
+
+// plusAddressingProviders são provedores em que usuario+etiqueta@ entrega em usuario@
+var plusAddressingProviders = map[string]bool{
+	"gmail.com":      true,
+	"outlook.com":    true,
+	"hotmail.com":    true,
+	"live.com":       true,
+	"icloud.com":     true,
+	"me.com":         true,
+	"fastmail.com":   true,
+	"proton.me":      true,
+	"protonmail.com": true,
+}
+
+func splitEmail(email string) (local, domain string) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	i := strings.LastIndexByte(email, '@')
+	if i < 0 {
+		return email, ""
+	}
+	return email[:i], strings.TrimSuffix(email[i+1:], ".")
+}
+
+// matchesAny indica se o domínio é igual a algum da lista ou subdomínio dele
+func matchesAny(domain string, list []string) bool {
+	for _, d := range list {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitDomains(value string) []string {
+	var domains []string
+	for _, d := range strings.Split(value, ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+func parseDomainList(r io.Reader) (map[string]struct{}, error) {
+	domains := make(map[string]struct{})
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[line] = struct{}{}
+	}
+	return domains, scanner.Err()
+}
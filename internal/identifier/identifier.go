@@ -0,0 +1,119 @@
+// internal/identifier/identifier.go
+package identifier
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/secure/precis"
+	"golang.org/x/text/unicode/norm"
+)
+
+//go:embed confusables.txt
+var bundledConfusables string
+
+// Erros retornados pela normalização
+var (
+	ErrInvalidUsername = errors.New("nome de usuário inválido")
+	ErrInvalidEmail    = errors.New("email inválido")
+)
+
+// confusables mapeia cada caractere ao protótipo com que ele se confunde visualmente
+var confusables = mustParseConfusables(bundledConfusables)
+
+// NormalizeUsername aplica NFKC e o perfil PRECIS UsernameCaseMapped (RFC 8265):
+// largura, caixa e composição unificadas. Recusa espaços, controles e caracteres não permitidos.
+func NormalizeUsername(username string) (string, error) {
+	normalized, err := precis.UsernameCaseMapped.String(norm.NFKC.String(strings.TrimSpace(username)))
+	if err != nil {
+		return "", ErrInvalidUsername
+	}
+	return normalized, nil
+}
+
+// NormalizeEmail aplica NFKC e case folding à parte local e converte o domínio
+// para a forma ASCII (IDNA), em minúsculas
+func NormalizeEmail(email string) (string, error) {
+	email = norm.NFKC.String(strings.TrimSpace(email))
+	i := strings.LastIndexByte(email, '@')
+	if i <= 0 || i == len(email)-1 {
+		return "", ErrInvalidEmail
+	}
+
+	local := norm.NFKC.String(cases.Fold().String(email[:i]))
+	domain, err := idna.Lookup.ToASCII(strings.TrimSuffix(email[i+1:], "."))
+	if err != nil || domain == "" {
+		return "", ErrInvalidEmail
+	}
+	return local + "@" + strings.ToLower(domain), nil
+}
+
+// Skeleton retorna o esqueleto de um nome (no espírito do UTS #39): nomes com o mesmo
+// esqueleto são visualmente confundíveis, como "admin", "аdmin" (a cirílico) e "adrnin".
+// Além da tabela de confundíveis, acentos são descartados ("josé" e "jose" colidem).
+func Skeleton(name string) string {
+	decomposed := norm.NFKD.String(cases.Fold().String(name))
+
+	var b strings.Builder
+	for _, r := range decomposed {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if prototype, ok := confusables[r]; ok {
+			b.WriteString(prototype)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return norm.NFC.String(b.String())
+}
+
+// mustParseConfusables lê a tabela no formato "origem ; protótipo # comentário",
+// com pontos de código em hexadecimal
+func mustParseConfusables(table string) map[rune]string {
+	mapping := make(map[rune]string)
+	scanner := bufio.NewScanner(strings.NewReader(table))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		source, prototype, ok := strings.Cut(line, ";")
+		if !ok {
+			panic(fmt.Sprintf("tabela de confundíveis: linha inválida %q", scanner.Text()))
+		}
+		src, err := parseCodePoints(source)
+		if err != nil || len([]rune(src)) != 1 {
+			panic(fmt.Sprintf("tabela de confundíveis: origem inválida %q", scanner.Text()))
+		}
+		dst, err := parseCodePoints(prototype)
+		if err != nil {
+			panic(fmt.Sprintf("tabela de confundíveis: protótipo inválido %q", scanner.Text()))
+		}
+		mapping[[]rune(src)[0]] = dst
+	}
+	return mapping
+}
+
+func parseCodePoints(field string) (string, error) {
+	var b strings.Builder
+	for _, hex := range strings.Fields(field) {
+		r, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return "", err
+		}
+		b.WriteRune(rune(r))
+	}
+	return b.String(), nil
+}
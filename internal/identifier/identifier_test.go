@@ -0,0 +1,97 @@
+package identifier
+
+import "testing"
+
+func TestNormalizeUsername(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"admin", "admin", false},
+		{"  Admin ", "admin", false},
+		{"ＡＤＭＩＮ", "admin", false}, // Largura total
+		{"José", "josé", false},
+		{"Jose\u0301", "josé", false}, // Acento combinado vira a forma composta
+		{"ad min", "", true},
+		{"admin\u0000", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeUsername(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizeUsername(%q) = %q, %v; esperado %q, erro %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"User@Example.COM", "user@example.com", false},
+		{" user@example.com. ", "user@example.com", false},
+		{"José@Exämple.com", "josé@xn--exmple-cua.com", false},
+		{"user", "", true},
+		{"@example.com", "", true},
+		{"user@", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeEmail(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizeEmail(%q) = %q, %v; esperado %q, erro %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSkeleton(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"admin", "Admin", true},
+		{"dave", "clave", true},     // d → cl
+		{"admin", "adrnin", true},   // m → rn
+		{"walter", "vvalter", true}, // w → vv
+		{"admin", "аdmin", true},    // a cirílico
+		{"root", "r00t", true},      // 0 → o
+		{"josé", "jose", true},      // Acentos descartados
+		{"ação", "acao", true},
+		{"Müller", "muller", true},
+		{"admin", "administrator", false},
+		{"alice", "bob", false},
+	}
+	for _, tt := range tests {
+		if same := Skeleton(tt.a) == Skeleton(tt.b); same != tt.same {
+			t.Errorf("Skeleton(%q) = %q, Skeleton(%q) = %q; esperado iguais: %v", tt.a, Skeleton(tt.a), tt.b, Skeleton(tt.b), tt.same)
+		}
+	}
+}
+
+func TestSkeletonPrototypes(t *testing.T) {
+	tests := map[string]string{
+		"d": "cl",
+		"m": "rn",
+		"w": "vv",
+		"é": "e",
+	}
+	for in, want := range tests {
+		if got := Skeleton(in); got != want {
+			t.Errorf("Skeleton(%q) = %q, esperado %q", in, got, want)
+		}
+	}
+}
+
+func TestParseConfusablesRejectsMalformedLines(t *testing.T) {
+	for _, table := range []string{"0064 0063", "zz ; 0061", "0061 0062 ; 0063"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("tabela %q aceita", table)
+				}
+			}()
+			mustParseConfusables(table)
+		}()
+	}
+}
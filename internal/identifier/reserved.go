@@ -0,0 +1,63 @@
+// internal/identifier/reserved.go
+package identifier
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"api_authentication/configs"
+)
+
+//go:embed reserved_usernames.txt
+var bundledReservedUsernames string
+
+// ReservedNames é a lista de nomes de usuário que não podem ser cadastrados.
+// Guarda os esqueletos, para que variantes confundíveis também sejam recusadas.
+type ReservedNames struct {
+	skeletons map[string]struct{}
+}
+
+// NewReservedNamesFromEnv cria a lista a partir de RESERVED_USERNAMES_FILE (substitui a lista
+// embutida) e RESERVED_USERNAMES (nomes adicionais, separados por vírgula)
+func NewReservedNamesFromEnv() (*ReservedNames, error) {
+	var list io.Reader = strings.NewReader(bundledReservedUsernames)
+	if path := configs.GetEnv("RESERVED_USERNAMES_FILE", ""); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("lista de nomes reservados: %w", err)
+		}
+		defer f.Close()
+		list = f
+	}
+
+	reserved := &ReservedNames{skeletons: make(map[string]struct{})}
+	scanner := bufio.NewScanner(list)
+	for scanner.Scan() {
+		reserved.add(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("lista de nomes reservados: %w", err)
+	}
+	for _, name := range strings.Split(configs.GetEnv("RESERVED_USERNAMES", ""), ",") {
+		reserved.add(name)
+	}
+	return reserved, nil
+}
+
+// Contains indica se o nome de usuário é reservado ou confundível com um nome reservado
+func (r *ReservedNames) Contains(username string) bool {
+	_, ok := r.skeletons[Skeleton(username)]
+	return ok
+}
+
+func (r *ReservedNames) add(name string) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.HasPrefix(name, "#") {
+		return
+	}
+	r.skeletons[Skeleton(name)] = struct{}{}
+}
@@ -0,0 +1,49 @@
+// internal/mail/file.go
+package mail
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// logSender escreve os emails no log em vez de enviá-los
+type logSender struct{}
+
+// NewLogSender cria um Sender que apenas registra os emails no log
+func NewLogSender() Sender {
+	return &logSender{}
+}
+
+func (s *logSender) Send(msg Message) error {
+	log.Printf("Email para %s | Assunto: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// fileSender acrescenta os emails a um arquivo local
+type fileSender struct {
+	path string
+	mu   sync.Mutex // Evita intercalar emails enviados em paralelo
+}
+
+// NewFileSender cria um Sender que grava os emails no arquivo informado
+func NewFileSender(path string) Sender {
+	return &fileSender{path: path}
+}
+
+func (s *fileSender) Send(msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("falha ao abrir arquivo de emails: %w", err)
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n---\n",
+		time.Now().Format(time.RFC1123Z), msg.To, msg.Subject, msg.Body)
+	return err
+}
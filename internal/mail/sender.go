@@ -0,0 +1,43 @@
+// internal/mail/sender.go
+package mail
+
+import (
+	"fmt"
+
+	"api_authentication/configs"
+)
+
+// Message é um email a ser enviado
+type Message struct {
+	To      string
+	Subject string
+	Body    string // Texto puro
+}
+
+// Sender define a interface para envio de emails
+type Sender interface {
+	Send(msg Message) error
+}
+
+// NewSenderFromEnv cria o Sender configurado em MAIL_DRIVER:
+//   - log (padrão): escreve os emails no log, para desenvolvimento local
+//   - file: acrescenta os emails ao arquivo MAIL_FILE_PATH, útil em testes
+//   - smtp: envia pelo servidor SMTP_HOST:SMTP_PORT
+func NewSenderFromEnv() (Sender, error) {
+	switch driver := configs.GetEnv("MAIL_DRIVER", "log"); driver {
+	case "log":
+		return NewLogSender(), nil
+	case "file":
+		return NewFileSender(configs.GetEnv("MAIL_FILE_PATH", "mail.log")), nil
+	case "smtp":
+		return NewSMTPSender(
+			configs.GetEnv("SMTP_HOST"),
+			configs.GetEnv("SMTP_PORT", "587"),
+			configs.GetEnv("SMTP_USERNAME", ""),
+			configs.GetEnv("SMTP_PASSWORD", ""),
+			configs.GetEnv("MAIL_FROM"),
+		), nil
+	default:
+		return nil, fmt.Errorf("MAIL_DRIVER desconhecido: %s", driver)
+	}
+}
@@ -0,0 +1,41 @@
+// internal/mail/smtp.go
+package mail
+
+import (
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+)
+
+// smtpSender envia emails por um servidor SMTP
+type smtpSender struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPSender cria um Sender SMTP. Sem usuário, envia sem autenticação.
+func NewSMTPSender(host, port, username, password, from string) Sender {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &smtpSender{addr: host + ":" + port, auth: auth, from: from}
+}
+
+func (s *smtpSender) Send(msg Message) error {
+	// Cabeçalhos não podem conter quebras de linha (injeção de cabeçalhos)
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return fmt.Errorf("destinatário ou assunto inválido")
+	}
+
+	body := "From: " + s.from + "\r\n" +
+		"To: " + msg.To + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + msg.Body
+
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, []byte(body))
+}
@@ -5,13 +5,21 @@ import (
 	"log" // Importe o pacote log
 	"net/http"
 	"strings"
+	"time"
 
 	"api_authentication/internal/auth"
+	"api_authentication/internal/user"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// currentUserKey guarda no contexto o usuário carregado pelo AuthMiddleware
+const currentUserKey = "currentUser"
+
+// AuthMiddleware valida o JWT e carrega o usuário a cada requisição, para que contas
+// excluídas ou suspensas percam o acesso imediatamente, mesmo com tokens já emitidos
+func AuthMiddleware(repo user.UserRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -38,8 +46,51 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		u, err := repo.GetUserByID(claims.UserID)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido ou expirado"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar usuário"})
+			}
+			c.Abort()
+			return
+		}
+
+		if user.IsSuspended(u, time.Now()) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Conta suspensa", "code": "account_suspended"})
+			c.Abort()
+			return
+		}
+
+		// Papéis e permissões, consultados por RequirePermission e pelos handlers
+		if err := user.LoadAuthorization(c, repo, u.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao carregar permissões"})
+			c.Abort()
+			return
+		}
+
+		// Organização ativa do token, desde que o usuário ainda seja membro dela
+		if err := user.LoadOrganization(c, repo, u.ID, claims.OrgID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao carregar organização"})
+			c.Abort()
+			return
+		}
+
 		c.Set("userID", claims.UserID)
+		c.Set(currentUserKey, u)
 		log.Printf("Token validado com sucesso para userID: %d", claims.UserID) // Adicione este log
 		c.Next()
 	}
 }
+
+// contextUser retorna o usuário carregado pelo AuthMiddleware; responde e aborta se não houver
+func contextUser(c *gin.Context) (*user.User, bool) {
+	value, exists := c.Get(currentUserKey)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token de autenticação ausente"})
+		c.Abort()
+		return nil, false
+	}
+	return value.(*user.User), true
+}
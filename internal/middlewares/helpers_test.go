@@ -0,0 +1,93 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"api_authentication/internal/auth"
+	"api_authentication/internal/user"
+)
+
+// newTestRepository cria um repositório sobre um SQLite em memória com todas as tabelas
+func newTestRepository(t *testing.T) user.UserRepository {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1) // Cada conexão teria o seu próprio banco em memória
+	t.Cleanup(func() { sqlDB.Close() })
+
+	err = db.AutoMigrate(
+		&user.User{}, &user.RecoveryCode{}, &user.WebAuthnCredential{}, &user.WebAuthnSession{}, &user.OneTimeToken{},
+		&user.TrustedDevice{}, &user.Invitation{}, &user.AuditEvent{}, &user.DataExport{}, &user.ErasureReceipt{},
+		&user.LegalDocument{}, &user.LegalAcceptance{}, &user.Permission{}, &user.Role{}, &user.UserRole{},
+		&user.Organization{}, &user.Membership{}, &user.Group{}, &user.GroupUser{}, &user.GroupSubgroup{}, &user.RelationTuple{}, &user.DataMigration{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.NewUserRepository(db)
+}
+
+// createTestUser grava um usuário ativo com email confirmado
+func createTestUser(t *testing.T, repo user.UserRepository, username string) *user.User {
+	t.Helper()
+	now := time.Now()
+	u := &user.User{Username: username, Email: username + "@example.com", Password: "-", Status: user.StatusActive, EmailVerifiedAt: &now}
+	if err := repo.CreateUser(u); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// bearerToken emite o token de acesso do usuário para o cabeçalho Authorization
+func bearerToken(t *testing.T, u *user.User) string {
+	t.Helper()
+	token, err := auth.GenerateJWT(u.ID, 0, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + token
+}
+
+// doRequest envia a requisição com o token informado e decodifica a resposta
+func doRequest(t *testing.T, r http.Handler, method, path, token string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	var out map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &out)
+	return rec.Code, out
+}
+
+// reached responde 200 quando a requisição passa pelos middlewares
+func reached(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Setenv("JWT_SECRET", "segredo-dos-testes")
+	os.Exit(m.Run())
+}
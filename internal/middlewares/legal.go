@@ -0,0 +1,39 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"api_authentication/internal/user"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireLegalAcceptance bloqueia o acesso enquanto houver versão em vigor de documento legal
+// não aceita pelo usuário. Deve ser usado depois do AuthMiddleware.
+func RequireLegalAcceptance(repo user.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, ok := contextUser(c)
+		if !ok {
+			return
+		}
+
+		pending, err := user.PendingLegalDocuments(repo, u.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao verificar documentos legais"})
+			c.Abort()
+			return
+		}
+
+		if len(pending) > 0 {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":     "É necessário aceitar a nova versão dos documentos legais",
+				"code":      "legal_acceptance_required",
+				"documents": pending,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
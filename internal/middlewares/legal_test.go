@@ -0,0 +1,80 @@
+package middlewares
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"api_authentication/internal/user"
+)
+
+// publishTestDocument publica uma versão de documento legal em vigor a partir de effectiveAt
+func publishTestDocument(t *testing.T, repo user.UserRepository, kind, version string, effectiveAt time.Time) *user.LegalDocument {
+	t.Helper()
+	document := &user.LegalDocument{Kind: kind, Version: version, Title: kind + " " + version, URL: "https://example.com/" + kind, EffectiveAt: effectiveAt}
+	if err := repo.CreateLegalDocument(document); err != nil {
+		t.Fatal(err)
+	}
+	return document
+}
+
+func acceptTestDocuments(t *testing.T, repo user.UserRepository, u *user.User, documents ...*user.LegalDocument) {
+	t.Helper()
+	acceptances := make([]user.LegalAcceptance, 0, len(documents))
+	for _, d := range documents {
+		acceptances = append(acceptances, user.LegalAcceptance{UserID: u.ID, DocumentID: d.ID, AcceptedAt: time.Now()})
+	}
+	if err := repo.CreateLegalAcceptances(acceptances); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequireLegalAcceptance(t *testing.T) {
+	repo := newTestRepository(t)
+	u := createTestUser(t, repo, "alice")
+	token := bearerToken(t, u)
+	r := gin.New()
+	r.GET("/protected", AuthMiddleware(repo), RequireLegalAcceptance(repo), reached)
+
+	if code, _ := doRequest(t, r, "GET", "/protected", token); code != http.StatusOK {
+		t.Errorf("sem documentos publicados: esperado 200, obtido %d", code)
+	}
+
+	terms := publishTestDocument(t, repo, user.LegalTerms, "1", time.Now().Add(-time.Hour))
+	privacy := publishTestDocument(t, repo, user.LegalPrivacy, "1", time.Now().Add(-time.Hour))
+	acceptTestDocuments(t, repo, u, terms)
+	code, body := doRequest(t, r, "GET", "/protected", token)
+	if code != http.StatusForbidden || body["code"] != "legal_acceptance_required" {
+		t.Fatalf("política de privacidade não aceita: esperado 403, obtido %d %v", code, body)
+	}
+	if pending := body["documents"].([]interface{}); len(pending) != 1 || pending[0].(map[string]interface{})["kind"] != user.LegalPrivacy {
+		t.Errorf("documentos pendentes: %v, esperada só a política de privacidade", pending)
+	}
+
+	acceptTestDocuments(t, repo, u, privacy)
+	if code, _ := doRequest(t, r, "GET", "/protected", token); code != http.StatusOK {
+		t.Errorf("documentos aceitos: esperado 200, obtido %d", code)
+	}
+
+	// Versão publicada com vigência futura só é exigida quando entrar em vigor
+	publishTestDocument(t, repo, user.LegalTerms, "2", time.Now().Add(time.Hour))
+	if code, _ := doRequest(t, r, "GET", "/protected", token); code != http.StatusOK {
+		t.Errorf("nova versão ainda fora de vigor: esperado 200, obtido %d", code)
+	}
+	publishTestDocument(t, repo, user.LegalTerms, "3", time.Now().Add(-time.Minute))
+	if code, _ := doRequest(t, r, "GET", "/protected", token); code != http.StatusForbidden {
+		t.Errorf("nova versão em vigor não aceita: esperado 403, obtido %d", code)
+	}
+}
+
+func TestRequireLegalAcceptanceWithoutUser(t *testing.T) {
+	repo := newTestRepository(t)
+	r := gin.New()
+	r.GET("/protected", RequireLegalAcceptance(repo), reached)
+
+	if code, _ := doRequest(t, r, "GET", "/protected", ""); code != http.StatusUnauthorized {
+		t.Errorf("sem AuthMiddleware: esperado 401, obtido %d", code)
+	}
+}
@@ -0,0 +1,33 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"api_authentication/internal/user"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireOrgRole permite a passagem apenas de quem tem, na organização ativa do token, pelo menos
+// o papel informado (owner > admin > member). Deve ser usado depois do AuthMiddleware.
+func RequireOrgRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := contextUser(c); !ok {
+			return
+		}
+
+		if _, _, ok := user.ActiveOrganization(c); !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Nenhuma organização ativa", "code": "organization_required"})
+			c.Abort()
+			return
+		}
+
+		if !user.HasOrgRole(c, role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Papel insuficiente na organização", "code": "organization_role_required", "role": role})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
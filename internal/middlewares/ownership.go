@@ -0,0 +1,59 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+
+	"api_authentication/configs"
+	"api_authentication/internal/user"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OwnerResolver extrai da requisição o ID do usuário dono do recurso acessado
+type OwnerResolver func(c *gin.Context) (uint, error)
+
+// PathUserID resolve o dono quando o próprio recurso é o usuário do parâmetro de rota (ex.: /users/:id)
+func PathUserID(param string) OwnerResolver {
+	return func(c *gin.Context) (uint, error) {
+		id, err := strconv.ParseUint(c.Param(param), 10, 32)
+		return uint(id), err
+	}
+}
+
+// RequireOwnerOrPermission permite a passagem do dono do recurso ou de quem tem a permissão.
+// Com AUTHZ_DENY_STATUS=404, a recusa repete o 404 do handler (notFoundMessage) para não
+// revelar quais recursos existem; o padrão é 403. Deve ser usado depois do AuthMiddleware.
+func RequireOwnerOrPermission(owner OwnerResolver, permission, notFoundMessage string) gin.HandlerFunc {
+	hideDenied := configs.GetEnv("AUTHZ_DENY_STATUS", "403") == "404"
+
+	return func(c *gin.Context) {
+		u, ok := contextUser(c)
+		if !ok {
+			return
+		}
+
+		// Um identificador inválido nunca pertence ao usuário; quem tem a permissão recebe o 400 do handler
+		if ownerID, err := owner(c); (err == nil && ownerID == u.ID) || user.HasPermission(c, permission) {
+			c.Next()
+			return
+		}
+
+		if hideDenied {
+			c.JSON(http.StatusNotFound, gin.H{"message": notFoundMessage})
+		} else {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "Permissão insuficiente",
+				"code":       "permission_denied",
+				"permission": permission,
+			})
+		}
+		c.Abort()
+	}
+}
+
+// RequireSelfOrPermission permite que o usuário acesse a própria conta (parâmetro de rota param)
+// e que quem tem a permissão acesse qualquer conta
+func RequireSelfOrPermission(param, permission string) gin.HandlerFunc {
+	return RequireOwnerOrPermission(PathUserID(param), permission, "Usuário não encontrado.")
+}
@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"api_authentication/internal/user"
+)
+
+// newOwnershipTestRouter monta as rotas de alteração e exclusão de conta como no roteador
+func newOwnershipTestRouter(repo user.UserRepository) *gin.Engine {
+	r := gin.New()
+	r.PUT("/api/users/:id", AuthMiddleware(repo), RequireSelfOrPermission("id", user.PermUsersUpdate), reached)
+	r.DELETE("/api/users/:id", AuthMiddleware(repo), RequireSelfOrPermission("id", user.PermUsersDelete), reached)
+	return r
+}
+
+// grantAdminRole atribui ao usuário o papel de administrador, com todas as permissões
+func grantAdminRole(t *testing.T, repo user.UserRepository, u *user.User) {
+	t.Helper()
+	if err := user.SeedRBAC(repo); err != nil {
+		t.Fatal(err)
+	}
+	role, err := repo.GetRoleByName(user.AdminRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.AssignRole(u.ID, role.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequireSelfOrPermission(t *testing.T) {
+	repo := newTestRepository(t)
+	alice := createTestUser(t, repo, "alice")
+	bob := createTestUser(t, repo, "bob")
+	admin := createTestUser(t, repo, "admin")
+	grantAdminRole(t, repo, admin)
+	r := newOwnershipTestRouter(repo)
+
+	for _, method := range []string{"PUT", "DELETE"} {
+		if code, _ := doRequest(t, r, method, fmt.Sprintf("/api/users/%d", alice.ID), bearerToken(t, alice)); code != http.StatusOK {
+			t.Errorf("%s na própria conta: esperado 200, obtido %d", method, code)
+		}
+		code, body := doRequest(t, r, method, fmt.Sprintf("/api/users/%d", alice.ID), bearerToken(t, bob))
+		if code != http.StatusForbidden || body["code"] != "permission_denied" {
+			t.Errorf("%s na conta de outro usuário: esperado 403, obtido %d %v", method, code, body)
+		}
+		if code, _ := doRequest(t, r, method, "/api/users/abc", bearerToken(t, bob)); code != http.StatusForbidden {
+			t.Errorf("%s com ID inválido sem permissão: esperado 403, obtido %d", method, code)
+		}
+		if code, _ := doRequest(t, r, method, fmt.Sprintf("/api/users/%d", alice.ID), bearerToken(t, admin)); code != http.StatusOK {
+			t.Errorf("%s com a permissão: esperado 200, obtido %d", method, code)
+		}
+	}
+}
+
+func TestRequireSelfOrPermissionHidesDenial(t *testing.T) {
+	t.Setenv("AUTHZ_DENY_STATUS", "404") // Lido na montagem das rotas
+	repo := newTestRepository(t)
+	alice := createTestUser(t, repo, "alice")
+	bob := createTestUser(t, repo, "bob")
+	r := newOwnershipTestRouter(repo)
+
+	for _, method := range []string{"PUT", "DELETE"} {
+		code, body := doRequest(t, r, method, fmt.Sprintf("/api/users/%d", alice.ID), bearerToken(t, bob))
+		if code != http.StatusNotFound || body["message"] != "Usuário não encontrado." {
+			t.Errorf("%s na conta de outro usuário: esperado 404, obtido %d %v", method, code, body)
+		}
+		if code, _ := doRequest(t, r, method, fmt.Sprintf("/api/users/%d", bob.ID), bearerToken(t, bob)); code != http.StatusOK {
+			t.Errorf("%s na própria conta: esperado 200, obtido %d", method, code)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"api_authentication/internal/user"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission permite a passagem apenas de usuários com a permissão informada
+// (ex.: "users:delete"), recebida por algum de seus papéis. Deve ser usado depois do AuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := contextUser(c); !ok {
+			return
+		}
+
+		if !user.HasPermission(c, permission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "Permissão insuficiente",
+				"code":       "permission_denied",
+				"permission": permission,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
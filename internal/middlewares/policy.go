@@ -0,0 +1,99 @@
+package middlewares
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"api_authentication/internal/authz"
+	"api_authentication/internal/user"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hiddenPolicyHeaders não são expostos às políticas
+var hiddenPolicyHeaders = map[string]bool{"authorization": true, "cookie": true, "x-trusted-device": true}
+
+// RequirePolicies avalia as políticas CEL da rota (ver authz.Engine) com os atributos principal
+// (usuário logado), resource (parâmetros da rota) e request. Políticas em dry-run só registram
+// a decisão no log. Deve ser usado depois do AuthMiddleware.
+func RequirePolicies(engine *authz.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		method := c.Request.Method
+		if !engine.Applies(method, route) {
+			c.Next()
+			return
+		}
+
+		u, ok := contextUser(c)
+		if !ok {
+			return
+		}
+
+		decisions := engine.Evaluate(method, route, user.PolicyPrincipal(c, u), policyResource(c), policyRequest(c))
+		for _, d := range decisions {
+			allowed := d.Allowed && d.Err == nil
+			if d.Err != nil {
+				log.Printf("Política %q falhou em %s %s para userID %d: %v", d.Policy, method, route, u.ID, d.Err)
+			}
+
+			if d.DryRun {
+				log.Printf("Política %q (dry-run) em %s %s para userID %d: permitido=%t", d.Policy, method, route, u.ID, allowed)
+				continue
+			}
+			if !allowed {
+				log.Printf("Política %q negou %s %s para userID %d", d.Policy, method, route, u.ID)
+				c.JSON(http.StatusForbidden, gin.H{
+					"error":  "Acesso negado pela política de autorização",
+					"code":   "policy_denied",
+					"policy": d.Policy,
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// policyResource expõe os parâmetros da rota (variável resource); valores numéricos viram int
+func policyResource(c *gin.Context) map[string]interface{} {
+	resource := make(map[string]interface{}, len(c.Params))
+	for _, p := range c.Params {
+		if n, err := strconv.ParseInt(p.Value, 10, 64); err == nil {
+			resource[p.Key] = n
+		} else {
+			resource[p.Key] = p.Value
+		}
+	}
+	return resource
+}
+
+// policyRequest descreve a requisição (variável request)
+func policyRequest(c *gin.Context) map[string]interface{} {
+	query := make(map[string]interface{})
+	for key, values := range c.Request.URL.Query() {
+		query[key] = values[0]
+	}
+	headers := make(map[string]interface{})
+	for key, values := range c.Request.Header {
+		name := strings.ToLower(key)
+		if !hiddenPolicyHeaders[name] {
+			headers[name] = values[0]
+		}
+	}
+
+	return map[string]interface{}{
+		"method":  c.Request.Method,
+		"path":    c.Request.URL.Path,
+		"route":   c.FullPath(),
+		"ip":      c.ClientIP(),
+		"query":   query,
+		"headers": headers,
+		"time":    time.Now(),
+	}
+}
@@ -0,0 +1,33 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"api_authentication/internal/user"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireVerifiedEmail bloqueia usuários com email não confirmado quando
+// EMAIL_VERIFICATION_MODE não é "off". Deve ser usado depois do AuthMiddleware.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user.EmailVerificationMode() == user.EmailVerificationOff {
+			c.Next()
+			return
+		}
+
+		u, ok := contextUser(c)
+		if !ok {
+			return
+		}
+
+		if u.EmailVerifiedAt == nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Confirme seu email para acessar este recurso", "code": "email_not_verified"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
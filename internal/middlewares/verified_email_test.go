@@ -0,0 +1,42 @@
+package middlewares
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"api_authentication/internal/user"
+)
+
+func TestRequireVerifiedEmailByMode(t *testing.T) {
+	for _, tc := range []struct {
+		mode       string
+		unverified int
+	}{
+		{user.EmailVerificationOff, http.StatusOK},
+		{user.EmailVerificationRestrict, http.StatusForbidden},
+		{user.EmailVerificationRequire, http.StatusForbidden},
+	} {
+		t.Setenv("EMAIL_VERIFICATION_MODE", tc.mode)
+		repo := newTestRepository(t)
+		verified := createTestUser(t, repo, "verified")
+		pending := createTestUser(t, repo, "pending")
+		if err := repo.UpdateUserFields(pending.ID, map[string]interface{}{"status": user.StatusPending, "email_verified_at": nil}); err != nil {
+			t.Fatal(err)
+		}
+		r := gin.New()
+		r.GET("/protected", AuthMiddleware(repo), RequireVerifiedEmail(), reached)
+
+		if code, _ := doRequest(t, r, "GET", "/protected", bearerToken(t, verified)); code != http.StatusOK {
+			t.Errorf("modo %q, email confirmado: esperado 200, obtido %d", tc.mode, code)
+		}
+		code, body := doRequest(t, r, "GET", "/protected", bearerToken(t, pending))
+		if code != tc.unverified {
+			t.Errorf("modo %q, email não confirmado: esperado %d, obtido %d", tc.mode, tc.unverified, code)
+		}
+		if code == http.StatusForbidden && body["code"] != "email_not_verified" {
+			t.Errorf("modo %q: código %v, esperado email_not_verified", tc.mode, body["code"])
+		}
+	}
+}
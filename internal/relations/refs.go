@@ -0,0 +1,56 @@
+// internal/relations/refs.go
+package relations
+
+import "strings"
+
+// Object identifica um objeto: "namespace:id" (ex.: document:readme)
+type Object struct {
+	Namespace string
+	ID        string
+}
+
+// Subject é quem recebe a relação: um objeto ("user:42", "folder:docs") ou um userset,
+// isto é, todos que têm uma relação com um objeto ("team:eng#member")
+type Subject struct {
+	Namespace string
+	ID        string
+	Relation  string // Vazio: o próprio objeto
+}
+
+// ParseObject lê uma referência "namespace:id"
+func ParseObject(ref string) (Object, error) {
+	ns, id, ok := strings.Cut(strings.TrimSpace(ref), ":")
+	if !ok || !nameRe.MatchString(ns) || !objectIDRe.MatchString(id) {
+		return Object{}, ErrInvalidReference
+	}
+	return Object{Namespace: ns, ID: id}, nil
+}
+
+// ParseSubject lê uma referência "namespace:id" ou "namespace:id#relacao"
+func ParseSubject(ref string) (Subject, error) {
+	objectRef, relation, hasRelation := strings.Cut(strings.TrimSpace(ref), "#")
+	object, err := ParseObject(objectRef)
+	if err != nil {
+		return Subject{}, err
+	}
+	if hasRelation && !nameRe.MatchString(relation) {
+		return Subject{}, ErrInvalidReference
+	}
+	return Subject{Namespace: object.Namespace, ID: object.ID, Relation: relation}, nil
+}
+
+// ValidName indica se o nome serve como namespace ou relação
+func ValidName(name string) bool {
+	return nameRe.MatchString(name)
+}
+
+func (o Object) String() string {
+	return o.Namespace + ":" + o.ID
+}
+
+func (s Subject) String() string {
+	if s.Relation == "" {
+		return s.Namespace + ":" + s.ID
+	}
+	return s.Namespace + ":" + s.ID + "#" + s.Relation
+}
@@ -0,0 +1,199 @@
+// internal/relations/schema.go
+package relations
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"api_authentication/configs"
+)
+
+// UserNamespace é o namespace implícito das contas deste serviço (sujeito "user:<id>")
+const UserNamespace = "user"
+
+var (
+	nameRe     = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+	objectIDRe = regexp.MustCompile(`^[A-Za-z0-9_.|-]{1,128}$`)
+)
+
+// Erros de validação de tuplas e consultas
+var (
+	ErrUnknownNamespace = errors.New("namespace desconhecido")
+	ErrUnknownRelation  = errors.New("relação desconhecida")
+	ErrNotDirect        = errors.New("a relação não aceita tuplas diretas, só é derivada de outras")
+	ErrInvalidReference = errors.New("referência inválida")
+)
+
+// Rewrite é um dos conjuntos cuja união forma uma relação
+type Rewrite struct {
+	Relation string // Relação calculada: outra relação do mesmo objeto (ex.: editor faz parte de viewer)
+	Tupleset string // Se não vazio: objetos ligados por esta relação, e de cada um deles a Relation (ex.: parent->viewer)
+}
+
+// Relation é a definição de uma relação de um namespace
+type Relation struct {
+	Direct bool      // Aceita tuplas gravadas diretamente
+	Union  []Rewrite // Conjuntos somados às tuplas diretas
+}
+
+// Schema são os namespaces e suas relações, carregados de RELATION_SCHEMA_FILE
+type Schema struct {
+	namespaces map[string]map[string]*Relation
+}
+
+type relationSpec struct {
+	Direct *bool    `yaml:"direct"` // Padrão: true
+	Union  []string `yaml:"union"`  // "relacao" ou "tupleset->relacao"
+}
+
+// NewSchemaFromEnv lê o esquema de RELATION_SCHEMA_FILE. Sem arquivo, o esquema fica vazio
+// e nenhuma tupla pode ser gravada.
+func NewSchemaFromEnv() (*Schema, error) {
+	path := configs.GetEnv("RELATION_SCHEMA_FILE", "")
+	if path == "" {
+		return &Schema{namespaces: map[string]map[string]*Relation{}}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("esquema de relações: %w", err)
+	}
+	schema, err := ParseSchema(data)
+	if err != nil {
+		return nil, fmt.Errorf("esquema de relações: %w", err)
+	}
+	return schema, nil
+}
+
+// ParseSchema lê um esquema em YAML no formato:
+//
+//	namespaces:
+//	  document:
+//	    parent: {}
+//	    owner: {}
+//	    editor: {union: [owner]}
+//	    viewer: {union: [editor, parent->viewer]}
+func ParseSchema(data []byte) (*Schema, error) {
+	var file struct {
+		Namespaces map[string]map[string]relationSpec `yaml:"namespaces"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	schema := &Schema{namespaces: make(map[string]map[string]*Relation, len(file.Namespaces))}
+	for ns, relations := range file.Namespaces {
+		if !nameRe.MatchString(ns) {
+			return nil, fmt.Errorf("nome de namespace inválido: %q", ns)
+		}
+		if ns == UserNamespace {
+			return nil, fmt.Errorf("o namespace %q é reservado para as contas", UserNamespace)
+		}
+		defs := make(map[string]*Relation, len(relations))
+		for name, spec := range relations {
+			if !nameRe.MatchString(name) {
+				return nil, fmt.Errorf("%s: nome de relação inválido: %q", ns, name)
+			}
+			rel := &Relation{Direct: spec.Direct == nil || *spec.Direct}
+			for _, entry := range spec.Union {
+				rewrite := Rewrite{Relation: strings.TrimSpace(entry)}
+				if tupleset, relation, ok := strings.Cut(entry, "->"); ok {
+					rewrite = Rewrite{Tupleset: strings.TrimSpace(tupleset), Relation: strings.TrimSpace(relation)}
+				}
+				rel.Union = append(rel.Union, rewrite)
+			}
+			defs[name] = rel
+		}
+		schema.namespaces[ns] = defs
+	}
+
+	// Referências só podem ser conferidas depois de todos os namespaces lidos
+	for ns, defs := range schema.namespaces {
+		for name, rel := range defs {
+			for _, rw := range rel.Union {
+				if rw.Tupleset == "" {
+					if defs[rw.Relation] == nil {
+						return nil, fmt.Errorf("%s#%s: relação %q não existe em %s", ns, name, rw.Relation, ns)
+					}
+					continue
+				}
+				if defs[rw.Tupleset] == nil {
+					return nil, fmt.Errorf("%s#%s: relação %q não existe em %s", ns, name, rw.Tupleset, ns)
+				}
+				if !schema.definedAnywhere(rw.Relation) {
+					return nil, fmt.Errorf("%s#%s: nenhum namespace define a relação %q", ns, name, rw.Relation)
+				}
+			}
+		}
+	}
+	return schema, nil
+}
+
+func (s *Schema) definedAnywhere(relation string) bool {
+	for _, defs := range s.namespaces {
+		if defs[relation] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Relation retorna a definição da relação do namespace
+func (s *Schema) Relation(namespace, relation string) (*Relation, error) {
+	defs, ok := s.namespaces[namespace]
+	if !ok {
+		return nil, ErrUnknownNamespace
+	}
+	rel, ok := defs[relation]
+	if !ok {
+		return nil, ErrUnknownRelation
+	}
+	return rel, nil
+}
+
+// Namespaces lista os namespaces com suas relações, em ordem alfabética
+func (s *Schema) Namespaces() map[string][]string {
+	out := make(map[string][]string, len(s.namespaces))
+	for ns, defs := range s.namespaces {
+		names := make([]string, 0, len(defs))
+		for name := range defs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		out[ns] = names
+	}
+	return out
+}
+
+// ValidateTuple confere se a tupla pode ser gravada: a relação existe e aceita tuplas diretas,
+// e o sujeito é um usuário, um objeto de namespace conhecido ou um userset existente
+func (s *Schema) ValidateTuple(object Object, relation string, subject Subject) error {
+	rel, err := s.Relation(object.Namespace, relation)
+	if err != nil {
+		return err
+	}
+	if !rel.Direct {
+		return ErrNotDirect
+	}
+
+	if subject.Namespace == UserNamespace {
+		if subject.Relation != "" {
+			return ErrInvalidReference
+		}
+		return nil
+	}
+	if _, ok := s.namespaces[subject.Namespace]; !ok {
+		return ErrUnknownNamespace
+	}
+	if subject.Relation != "" {
+		if _, err := s.Relation(subject.Namespace, subject.Relation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
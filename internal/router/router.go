@@ -1,8 +1,17 @@
 package router
 
 import (
+	"api_authentication/internal/auth"
+	"api_authentication/internal/authz"
+	"api_authentication/internal/emailpolicy"
+	"api_authentication/internal/identifier"
+	"api_authentication/internal/mail"
 	"api_authentication/internal/middlewares"
+	"api_authentication/internal/relations"
+	"api_authentication/internal/sms"
 	"api_authentication/internal/user"
+	"log"
+	"strings"
 
 	"time" // Para configurar o MaxAge, se desejar
 
@@ -23,8 +32,8 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 			"https://Alysson-Santos-bit.github.io/front-end/", // Seu front-end (com barra final)
 			"https://beck-end-oafv.onrender.com",
 		},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Trusted-Device"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		AllowOriginFunc: func(origin string) bool {
@@ -38,7 +47,42 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 
 	// Inicialize o repositório e serviço de usuário
 	userRepo := user.NewUserRepository(db)
-	userService := user.NewUserService(userRepo)
+	webAuthn, err := auth.NewWebAuthn()
+	if err != nil {
+		log.Fatalf("Configuração WebAuthn inválida: %v", err)
+	}
+	mailer, err := mail.NewSenderFromEnv()
+	if err != nil {
+		log.Fatalf("Configuração de email inválida: %v", err)
+	}
+	smsSender, err := sms.NewSenderFromEnv()
+	if err != nil {
+		log.Fatalf("Configuração de SMS inválida: %v", err)
+	}
+	emailPolicy, err := emailpolicy.NewPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Configuração da política de emails inválida: %v", err)
+	}
+	if err := user.SeedRBAC(userRepo); err != nil {
+		log.Fatalf("Erro ao preparar papéis e permissões: %v", err)
+	}
+	if _, err := user.EnsureDefaultOrganization(userRepo); err != nil {
+		log.Fatalf("Erro ao preparar a organização padrão: %v", err)
+	}
+	reservedNames, err := identifier.NewReservedNamesFromEnv()
+	if err != nil {
+		log.Fatalf("Configuração de nomes de usuário reservados inválida: %v", err)
+	}
+	relationSchema, err := relations.NewSchemaFromEnv()
+	if err != nil {
+		log.Fatalf("Esquema de relações inválido: %v", err)
+	}
+	policyEngine, err := authz.NewEngineFromEnv()
+	if err != nil {
+		log.Fatalf("Configuração das políticas de autorização inválida: %v", err)
+	}
+	policyEngine.StartReloader()
+	userService := user.NewUserService(userRepo, webAuthn, mailer, smsSender, emailPolicy, reservedNames, relationSchema)
 
 	// Inicialize o repositório e serviço de usuário
 
@@ -47,21 +91,176 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 	{
 		authRoutes.POST("/register", userService.Register)
 		authRoutes.POST("/login", userService.Login)
+		authRoutes.POST("/login/mfa", userService.LoginMFA) // Segunda etapa do login com MFA
+		authRoutes.POST("/login/mfa/webauthn/begin", userService.BeginWebAuthnMFA)
+		authRoutes.POST("/login/mfa/webauthn/finish", userService.FinishWebAuthnMFA)
+		authRoutes.POST("/login/mfa/sms/send", userService.SendSMSMFACode)
+
+		// Login sem senha com passkey
+		authRoutes.POST("/webauthn/login/begin", userService.BeginWebAuthnLogin)
+		authRoutes.POST("/webauthn/login/finish", userService.FinishWebAuthnLogin)
+
+		// Login sem senha por link mágico ou código enviado por email
+		authRoutes.POST("/magic-link", userService.RequestMagicLink)
+		authRoutes.POST("/magic-link/verify", userService.VerifyMagicLink)
+
+		// Confirmação de email
+		authRoutes.POST("/verify-email", userService.VerifyEmail)
+		authRoutes.POST("/verify-email/resend", userService.ResendVerificationEmail)
+
+		// Troca de email: links enviados ao novo e ao antigo endereço
+		authRoutes.POST("/email-change/confirm", userService.ConfirmEmailChange)
+		authRoutes.POST("/email-change/cancel", userService.CancelEmailChange)
+
+		// Restauração de conta excluída (dentro do prazo)
+		authRoutes.POST("/restore", userService.RestoreAccount)
 	}
 
+	// Download da exportação de dados pessoais (link enviado por email, protegido por token)
+	r.GET("/exports/:id/download", userService.DownloadDataExport)
+
+	// Documentos legais em vigor (exibidos no cadastro)
+	r.GET("/legal/documents", userService.ListCurrentLegalDocuments)
+
 	// Rotas protegidas (exigem JWT)
-	authMiddleware := middlewares.AuthMiddleware() // Instancie o middleware
-	privateRoutes := r.Group("/api", authMiddleware)
-	{
-		// ... (outras rotas existentes)
-		privateRoutes.GET("/users/:id", userService.GetUserByID)
-		privateRoutes.PUT("/users/:id", userService.UpdateUser)
-		privateRoutes.DELETE("/users/:id", userService.DeleteUser)
+	authMiddleware := middlewares.AuthMiddleware(userRepo) // Instancie o middleware
+	// Políticas CEL (POLICY_FILE) das rotas protegidas, avaliadas depois da autenticação
+	policyMiddleware := middlewares.RequirePolicies(policyEngine)
 
+	// Rotas liberadas mesmo sem o aceite da versão atual dos documentos legais:
+	// o usuário precisa poder ler o perfil, aceitar, exportar os dados ou apagar a conta
+	accountRoutes := r.Group("/api", authMiddleware, policyMiddleware)
+	{
 		// --- NOVA ROTA PROTEGIDA PARA BUSCAR O USUÁRIO LOGADO ---
-		privateRoutes.GET("/perfil", userService.GetCurrentUser) // <--- ADICIONE ESTA LINHA
+		accountRoutes.GET("/perfil", userService.GetCurrentUser) // <--- ADICIONE ESTA LINHA
 		// Agora o frontend pode chamar /api/perfil
+
+		// Aceite de documentos legais
+		accountRoutes.GET("/legal/pending", userService.GetPendingLegalDocuments)
+		accountRoutes.POST("/legal/accept", userService.AcceptLegalDocuments)
+
+		// Exportação dos dados pessoais (gerada em segundo plano)
+		accountRoutes.POST("/perfil/export", userService.RequestDataExport)
+		accountRoutes.GET("/perfil/export/:id", userService.GetDataExport)
+
+		// Apagamento definitivo dos dados pessoais (direito ao esquecimento)
+		accountRoutes.POST("/perfil/erase", userService.EraseAccount)
+	}
+
+	privateRoutes := r.Group("/api", authMiddleware, policyMiddleware, middlewares.RequireLegalAcceptance(userRepo))
+	{
+		// ... (outras rotas existentes)
+		// Com EMAIL_VERIFICATION_MODE=restrict, só contas com email confirmado acessam estas rotas
+		verifiedRoutes := privateRoutes.Group("", middlewares.RequireVerifiedEmail())
+		// Cada usuário acessa a própria conta; as demais exigem a permissão correspondente
+		verifiedRoutes.GET("/users", middlewares.RequirePermission(user.PermUsersRead), userService.ListUsers)
+		verifiedRoutes.GET("/users/:id", middlewares.RequireSelfOrPermission("id", user.PermUsersRead), userService.GetUserByID)
+		verifiedRoutes.PUT("/users/:id", middlewares.RequireSelfOrPermission("id", user.PermUsersUpdate), userService.UpdateUser)
+		verifiedRoutes.DELETE("/users/:id", middlewares.RequireSelfOrPermission("id", user.PermUsersDelete), userService.DeleteUser)
+
+		// Autenticação em dois fatores (TOTP)
+		privateRoutes.POST("/mfa/totp/enroll", userService.EnrollTOTP)
+		privateRoutes.POST("/mfa/totp/confirm", userService.ConfirmTOTP)
+		privateRoutes.POST("/mfa/totp/disable", userService.DisableTOTP)
+		privateRoutes.POST("/mfa/recovery-codes/regenerate", userService.RegenerateRecoveryCodes)
+		privateRoutes.POST("/mfa/sms/enable", userService.EnableSMSMFA)
+		privateRoutes.POST("/mfa/sms/disable", userService.DisableSMSMFA)
+
+		// Telefone do usuário logado
+		privateRoutes.PUT("/perfil/phone", userService.UpdatePhoneNumber)
+		privateRoutes.POST("/perfil/phone/verify", userService.VerifyPhoneNumber)
+
+		// Campos de perfil (nome de exibição, idioma, fuso, bio, avatar) com JSON Merge Patch
+		privateRoutes.PATCH("/perfil", userService.PatchCurrentUserProfile)
+
+		// Dispositivos confiáveis (dispensam o segundo fator)
+		privateRoutes.GET("/perfil/devices", userService.ListTrustedDevices)
+		privateRoutes.DELETE("/perfil/devices/:id", userService.RevokeTrustedDevice)
+		privateRoutes.DELETE("/perfil/devices", userService.RevokeAllTrustedDevices)
+
+		// Convites de cadastro
+		privateRoutes.POST("/invitations", userService.CreateInvitation)
+		privateRoutes.GET("/invitations", userService.ListInvitations)
+		privateRoutes.DELETE("/invitations/:id", userService.RevokeInvitation)
+
+		// Organizações do usuário logado
+		privateRoutes.GET("/organizations", userService.ListMyOrganizations)
+		privateRoutes.POST("/organizations", userService.CreateOrganization)
+		privateRoutes.POST("/organizations/join", userService.JoinOrganization)
+		privateRoutes.POST("/organizations/:id/switch", userService.SwitchOrganization)
+
+		// Organização ativa (claim org_id do token); membros e convites apenas dela
+		privateRoutes.GET("/org", userService.GetActiveOrganization)
+		orgAdminRoutes := privateRoutes.Group("/org", middlewares.RequireOrgRole(user.OrgRoleAdmin))
+		orgAdminRoutes.GET("/members", userService.ListOrganizationMembers)
+		orgAdminRoutes.PUT("/members/:userId", userService.UpdateOrganizationMember)
+		orgAdminRoutes.DELETE("/members/:userId", userService.RemoveOrganizationMember)
+		orgAdminRoutes.POST("/invitations", userService.CreateOrganizationInvitation)
+
+		// Relações no estilo Zanzibar (RELATION_SCHEMA_FILE): check e list-objects do próprio
+		// usuário são livres; consultar outros sujeitos, expand e gravar tuplas exigem permissão
+		relationRoutes := privateRoutes.Group("/relations")
+		relationRoutes.GET("/schema", userService.GetRelationSchema)
+		relationRoutes.POST("/check", userService.CheckRelation)
+		relationRoutes.POST("/list-objects", userService.ListRelationObjects)
+		relationRoutes.POST("/expand", middlewares.RequirePermission(user.PermRelationsRead), userService.ExpandRelation)
+		relationRoutes.GET("/tuples", middlewares.RequirePermission(user.PermRelationsRead), userService.ListRelationTuples)
+		relationRoutes.POST("/tuples", middlewares.RequirePermission(user.PermRelationsWrite), userService.WriteRelationTuple)
+		relationRoutes.DELETE("/tuples", middlewares.RequirePermission(user.PermRelationsWrite), userService.DeleteRelationTuple)
+
+		// Passkeys (WebAuthn)
+		privateRoutes.POST("/webauthn/register/begin", userService.BeginWebAuthnRegistration)
+		privateRoutes.POST("/webauthn/register/finish", userService.FinishWebAuthnRegistration)
+		privateRoutes.GET("/webauthn/credentials", userService.ListWebAuthnCredentials)
+		privateRoutes.DELETE("/webauthn/credentials/:id", userService.DeleteWebAuthnCredential)
+	}
+
+	// Rotas de administração (cada uma exige a permissão correspondente, recebida por papel)
+	adminRoutes := r.Group("/api/admin", authMiddleware, policyMiddleware)
+	{
+		adminRoutes.POST("/users/:id/unlock", middlewares.RequirePermission(user.PermUsersUnlock), userService.UnlockUser)
+		adminRoutes.POST("/users/:id/restore", middlewares.RequirePermission(user.PermUsersRestore), userService.AdminRestoreUser)
+		adminRoutes.POST("/users/:id/suspend", middlewares.RequirePermission(user.PermUsersSuspend), userService.SuspendUser)
+		adminRoutes.POST("/users/:id/reactivate", middlewares.RequirePermission(user.PermUsersSuspend), userService.ReactivateUser)
+		adminRoutes.POST("/users/:id/erase", middlewares.RequirePermission(user.PermUsersErase), userService.AdminEraseUser)
+		adminRoutes.PATCH("/users/:id/profile", middlewares.RequirePermission(user.PermUsersUpdate), userService.AdminPatchUserProfile)
+		adminRoutes.GET("/invitations", middlewares.RequirePermission(user.PermInvitationsManage), userService.AdminListInvitations)
+		adminRoutes.DELETE("/invitations/:id", middlewares.RequirePermission(user.PermInvitationsManage), userService.AdminRevokeInvitation)
+		adminRoutes.GET("/legal-documents", middlewares.RequirePermission(user.PermLegalManage), userService.AdminListLegalDocuments)
+		adminRoutes.POST("/legal-documents", middlewares.RequirePermission(user.PermLegalManage), userService.AdminCreateLegalDocument)
+
+		// Papéis e permissões
+		roleRoutes := adminRoutes.Group("", middlewares.RequirePermission(user.PermRolesManage))
+		roleRoutes.GET("/permissions", userService.AdminListPermissions)
+		roleRoutes.GET("/roles", userService.AdminListRoles)
+		roleRoutes.POST("/roles", userService.AdminCreateRole)
+		roleRoutes.PUT("/roles/:id", userService.AdminUpdateRole)
+		roleRoutes.DELETE("/roles/:id", userService.AdminDeleteRole)
+		roleRoutes.GET("/users/:id/roles", userService.AdminListUserRoles)
+		roleRoutes.POST("/users/:id/roles", userService.AdminAssignRole)
+		roleRoutes.DELETE("/users/:id/roles/:roleId", userService.AdminRevokeRole)
+
+		groupRoutes := adminRoutes.Group("", middlewares.RequirePermission(user.PermGroupsManage))
+		groupRoutes.GET("/groups", userService.AdminListGroups)
+		groupRoutes.POST("/groups", userService.AdminCreateGroup)
+		groupRoutes.GET("/groups/:id", userService.AdminGetGroup)
+		groupRoutes.PUT("/groups/:id", userService.AdminUpdateGroup)
+		groupRoutes.DELETE("/groups/:id", userService.AdminDeleteGroup)
+		groupRoutes.POST("/groups/:id/users/:userId", userService.AdminAddGroupUser)
+		groupRoutes.DELETE("/groups/:id/users/:userId", userService.AdminRemoveGroupUser)
+		groupRoutes.POST("/groups/:id/groups/:childId", userService.AdminAddSubgroup)
+		groupRoutes.DELETE("/groups/:id/groups/:childId", userService.AdminRemoveSubgroup)
+		groupRoutes.GET("/users/:id/groups", userService.AdminListUserGroups)
+	}
+
+	// Só as rotas de /api passam pelo middleware de políticas
+	var policyRoutes []authz.Route
+	for _, route := range r.Routes() {
+		if strings.HasPrefix(route.Path, "/api/") {
+			policyRoutes = append(policyRoutes, authz.Route{Method: route.Method, Path: route.Path})
+		}
 	}
+	policyEngine.SetRoutes(policyRoutes)
 
 	return r
 }
@@ -0,0 +1,70 @@
+// internal/sms/sender.go
+package sms
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"api_authentication/configs"
+)
+
+// SMSSender define a interface para provedores de SMS. Novos provedores
+// (Twilio, SNS...) só precisam implementar este método.
+type SMSSender interface {
+	SendSMS(to, body string) error // to no formato E.164
+}
+
+// NewSenderFromEnv cria o SMSSender configurado em SMS_DRIVER:
+//   - log (padrão): escreve as mensagens no log
+//   - file: acrescenta as mensagens ao arquivo SMS_FILE_PATH, útil em testes
+func NewSenderFromEnv() (SMSSender, error) {
+	switch driver := configs.GetEnv("SMS_DRIVER", "log"); driver {
+	case "log":
+		return NewLogSender(), nil
+	case "file":
+		return NewFileSender(configs.GetEnv("SMS_FILE_PATH", "sms.log")), nil
+	default:
+		return nil, fmt.Errorf("SMS_DRIVER desconhecido: %s", driver)
+	}
+}
+
+// logSender é um provedor falso que apenas registra as mensagens no log
+type logSender struct{}
+
+// NewLogSender cria um SMSSender que escreve as mensagens no log
+func NewLogSender() SMSSender {
+	return &logSender{}
+}
+
+func (s *logSender) SendSMS(to, body string) error {
+	log.Printf("SMS para %s: %s", to, body)
+	return nil
+}
+
+// fileSender é um provedor falso que grava as mensagens em um arquivo local
+type fileSender struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileSender cria um SMSSender que grava as mensagens no arquivo informado
+func NewFileSender(path string) SMSSender {
+	return &fileSender{path: path}
+}
+
+func (s *fileSender) SendSMS(to, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("falha ao abrir arquivo de SMS: %w", err)
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\n", time.Now().Format(time.RFC3339), to, body)
+	return err
+}
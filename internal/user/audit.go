@@ -0,0 +1,50 @@
+package user
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ações registradas no histórico de auditoria (AuditEvent.Action)
+const (
+	AuditLoginSucceeded       = "login.succeeded"
+	AuditLoginFailed          = "login.failed"
+	AuditAccountLocked        = "account.locked"
+	AuditAccountUnlocked      = "account.unlocked"
+	AuditAccountSuspended     = "account.suspended"
+	AuditAccountReactivated   = "account.reactivated"
+	AuditAccountDeleted       = "account.deleted"
+	AuditAccountRestored      = "account.restored"
+	AuditEmailChangeRequested = "email.change_requested"
+	AuditEmailChanged         = "email.changed"
+	AuditDataExportRequested  = "data_export.requested"
+	AuditWebAuthnCloneWarning = "webauthn.clone_warning"
+)
+
+// audit registra um evento sobre a conta userID. O autor é o usuário logado, se houver e
+// for outro (ex.: administrador). Falhas são apenas logadas para não interromper a operação.
+func (s *userServiceImpl) audit(c *gin.Context, userID uint, action string, details map[string]interface{}) {
+	event := &AuditEvent{
+		UserID:    userID,
+		Action:    action,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if actorID, exists := c.Get("userID"); exists && actorID.(uint) != userID {
+		id := actorID.(uint)
+		event.ActorID = &id
+	}
+	if len(details) > 0 {
+		data, err := json.Marshal(details)
+		if err != nil {
+			log.Printf("Erro ao serializar detalhes de auditoria (%s): %v", action, err)
+		}
+		event.Details = string(data)
+	}
+
+	if err := s.repo.CreateAuditEvent(event); err != nil {
+		log.Printf("Erro ao registrar evento de auditoria %s para userID %d: %v", action, userID, err)
+	}
+}
@@ -0,0 +1,176 @@
+package user
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api_authentication/configs"
+	"api_authentication/internal/auth"
+)
+
+// purgeBatchSize limita quantas contas são expurgadas por execução do job
+const purgeBatchSize = 100
+
+// deletionGracePeriod é o prazo em que uma conta excluída ainda pode ser restaurada
+func deletionGracePeriod() time.Duration {
+	return configs.GetEnvDuration("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour)
+}
+
+// restoreDeadlinePassed indica se o prazo de restauração da conta excluída terminou. A conta
+// pode ainda não ter sido expurgada, pois o job roda a cada ACCOUNT_PURGE_INTERVAL.
+func restoreDeadlinePassed(user *User) bool {
+	return time.Since(user.DeletedAt.Time) > deletionGracePeriod()
+}
+
+// RestoreAccount restaura a própria conta excluída, dentro do prazo, com nome de usuário (ou email) e senha.
+// Não emite token: depois de restaurada, a conta passa pelo login normal (inclusive MFA).
+func (s *userServiceImpl) RestoreAccount(c *gin.Context) {
+	var req RestoreAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	user, err := s.repo.GetDeletedUserByUsernameOrEmail(req.Username)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			auth.CheckPasswordHash(req.Password, dummyPasswordHash())
+			respondInvalidCredentials(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuário."})
+		return
+	}
+
+	// Mesmas proteções do login contra tentativas repetidas
+	passwordOK := auth.CheckPasswordHash(req.Password, user.Password)
+	if isLoginLocked(user, time.Now()) {
+		respondInvalidCredentials(c)
+		return
+	}
+	if !passwordOK {
+		if err := s.registerFailedLogin(c, user); err != nil {
+			log.Printf("Erro ao registrar falha de login para userID %d: %v", user.ID, err)
+		}
+		respondInvalidCredentials(c)
+		return
+	}
+
+	if restoreDeadlinePassed(user) {
+		c.JSON(http.StatusGone, gin.H{"message": "O prazo para restaurar esta conta expirou."})
+		return
+	}
+
+	s.restoreUser(c, user)
+}
+
+// AdminRestoreUser (rota de administrador) restaura uma conta excluída dentro do prazo de
+// restauração. Vale o mesmo prazo da restauração pelo próprio usuário: depois dele a conta
+// aguarda o expurgo, mesmo que o job ainda não tenha passado.
+func (s *userServiceImpl) AdminRestoreUser(c *gin.Context) {
+	idParam := c.Param("id")
+	userID, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de usuário inválido."})
+		return
+	}
+
+	user, err := s.repo.GetDeletedUserByID(uint(userID))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Nenhuma conta excluída e restaurável com este ID."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuário."})
+		return
+	}
+
+	if restoreDeadlinePassed(user) {
+		c.JSON(http.StatusGone, gin.H{"message": "O prazo para restaurar esta conta expirou."})
+		return
+	}
+
+	s.restoreUser(c, user)
+}
+
+// restoreUser desfaz a exclusão devolvendo a conta ao estado anterior a ela: uma conta suspensa
+// e depois excluída volta suspensa
+func (s *userServiceImpl) restoreUser(c *gin.Context, user *User) {
+	status := user.StatusBeforeDeletion
+	if !CanTransition(StatusDeleted, status) {
+		status = baseStatus(user) // Excluída antes de o estado anterior ser guardado
+	}
+
+	restored, err := s.repo.RestoreUser(user.ID, status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao restaurar conta."})
+		return
+	}
+	if !restored {
+		// Expurgada ou restaurada por outra requisição entre a busca e a atualização
+		c.JSON(http.StatusConflict, gin.H{"message": "A conta não está mais disponível para restauração."})
+		return
+	}
+
+	s.audit(c, user.ID, AuditAccountRestored, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Conta restaurada com sucesso!"})
+}
+
+// PurgeExpiredAccounts expurga as contas excluídas há mais tempo que o prazo de restauração
+// e retorna quantas foram processadas
+func PurgeExpiredAccounts(repo UserRepository) (int, error) {
+	cutoff := time.Now().Add(-deletionGracePeriod())
+	purged := 0
+	for {
+		users, err := repo.GetUsersToPurge(cutoff, purgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		for _, u := range users {
+			// gorm.ErrRecordNotFound: outra instância já expurgou a conta
+			if _, err := eraseUser(repo, u.ID, ErasureRetentionExpired, nil); err != nil && err != gorm.ErrRecordNotFound {
+				return purged, err
+			}
+			purged++
+		}
+		if len(users) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// StartPurgeJob executa PurgeExpiredAccounts e PurgeExpiredDataExports periodicamente
+// (ACCOUNT_PURGE_INTERVAL) em segundo plano
+func StartPurgeJob(repo UserRepository) {
+	interval := configs.GetEnvDuration("ACCOUNT_PURGE_INTERVAL", time.Hour)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			purged, err := PurgeExpiredAccounts(repo)
+			if err != nil {
+				log.Printf("Erro no expurgo de contas excluídas: %v", err)
+			} else if purged > 0 {
+				log.Printf("%d conta(s) excluída(s) expurgada(s) definitivamente", purged)
+			}
+
+			removed, err := PurgeExpiredDataExports(repo)
+			if err != nil {
+				log.Printf("Erro ao remover exportações de dados vencidas: %v", err)
+			} else if removed > 0 {
+				log.Printf("%d exportação(ões) de dados vencida(s) removida(s)", removed)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,120 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// deleteTestUser exclui a conta como DeleteUser e recua a data da exclusão em age
+func deleteTestUser(t *testing.T, db *gorm.DB, repo UserRepository, user *User, age time.Duration) {
+	t.Helper()
+	if err := repo.DeleteUser(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Unscoped().Model(&User{}).Where("id = ?", user.ID).Update("deleted_at", time.Now().Add(-age)).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newRestoreTestServer(s *userServiceImpl) *gin.Engine {
+	r := gin.New()
+	r.POST("/users/:id/restore", s.AdminRestoreUser)
+	return r
+}
+
+func TestAdminRestoreUserRespectsDeadline(t *testing.T) {
+	t.Setenv("ACCOUNT_DELETION_GRACE_PERIOD", "24h")
+	db, s := newTestService(t)
+	r := newRestoreTestServer(s)
+
+	expired := createTestUser(t, s.repo, "expired")
+	deleteTestUser(t, db, s.repo, expired, 48*time.Hour)
+	if code, _ := doJSON(t, r, "POST", fmt.Sprintf("/users/%d/restore", expired.ID), nil); code != http.StatusGone {
+		t.Errorf("conta fora do prazo: esperado 410, obtido %d", code)
+	}
+
+	recent := createTestUser(t, s.repo, "recent")
+	deleteTestUser(t, db, s.repo, recent, time.Hour)
+	if code, body := doJSON(t, r, "POST", fmt.Sprintf("/users/%d/restore", recent.ID), nil); code != http.StatusOK {
+		t.Errorf("conta dentro do prazo: esperado 200, obtido %d %v", code, body)
+	}
+}
+
+func TestRestoreKeepsStatusBeforeDeletion(t *testing.T) {
+	db, s := newTestService(t)
+	r := newRestoreTestServer(s)
+
+	user := createTestUser(t, s.repo, "suspended")
+	if ok, err := s.transitionStatus(user, StatusSuspended, map[string]interface{}{"suspension_reason": "spam"}); !ok || err != nil {
+		t.Fatalf("suspensão: %v %v", ok, err)
+	}
+	deleteTestUser(t, db, s.repo, user, time.Hour)
+
+	if code, body := doJSON(t, r, "POST", fmt.Sprintf("/users/%d/restore", user.ID), nil); code != http.StatusOK {
+		t.Fatalf("restauração: %d %v", code, body)
+	}
+	restored, err := s.repo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Status != StatusSuspended {
+		t.Errorf("esperado estado %q após a restauração, obtido %q", StatusSuspended, restored.Status)
+	}
+}
+
+func TestMarkEmailVerifiedKeepsConcurrentSuspension(t *testing.T) {
+	_, s := newTestService(t)
+	user := createTestUser(t, s.repo, "pending")
+	if err := s.repo.UpdateUserProfile(user.ID, map[string]interface{}{"email_verified_at": nil, "status": StatusPending}); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := s.repo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Suspensão aplicada depois que a confirmação de email leu a conta
+	current := *stale
+	if ok, err := s.transitionStatus(&current, StatusSuspended, nil); !ok || err != nil {
+		t.Fatalf("suspensão: %v %v", ok, err)
+	}
+	if err := s.markEmailVerified(stale); err != nil {
+		t.Fatal(err)
+	}
+
+	if stale.Status != StatusSuspended || stale.EmailVerifiedAt == nil {
+		t.Errorf("esperado email confirmado com a conta ainda suspensa: status %q, verificado em %v", stale.Status, stale.EmailVerifiedAt)
+	}
+}
+
+func TestFailedRestoreKeepsDeletedStatus(t *testing.T) {
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "3")
+	t.Setenv("LOGIN_BACKOFF_BASE", "0s")
+	db, s := newTestService(t)
+	user := createTestUser(t, s.repo, "deleted")
+	deleteTestUser(t, db, s.repo, user, time.Hour)
+	r := gin.New()
+	r.POST("/auth/restore", s.RestoreAccount)
+
+	for i := 0; i < 3; i++ {
+		if code, _ := doJSON(t, r, "POST", "/auth/restore", RestoreAccountRequest{Username: "deleted", Password: "errada"}); code != http.StatusUnauthorized {
+			t.Fatalf("senha errada %d: esperado 401, obtido %d", i+1, code)
+		}
+	}
+
+	var stored User
+	if err := db.Unscoped().First(&stored, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != StatusDeleted {
+		t.Errorf("conta excluída mudou de estado após falhas na restauração: %q", stored.Status)
+	}
+	if stored.LockedUntil == nil || !stored.LockedUntil.After(time.Now()) {
+		t.Error("falhas na restauração deveriam bloquear novas tentativas")
+	}
+}
@@ -0,0 +1,140 @@
+package user
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"api_authentication/configs"
+	"api_authentication/internal/auth"
+)
+
+// Cookie e cabeçalho que carregam o token do dispositivo confiável
+const (
+	trustedDeviceCookie = "trusted_device"
+	trustedDeviceHeader = "X-Trusted-Device"
+)
+
+// maxUserAgentLength limita o tamanho do User-Agent guardado com o dispositivo
+const maxUserAgentLength = 255
+
+// trustedDeviceTTL é por quanto tempo um dispositivo dispensa o segundo fator
+func trustedDeviceTTL() time.Duration {
+	return configs.GetEnvDuration("TRUSTED_DEVICE_TTL", 30*24*time.Hour)
+}
+
+// trustDevice registra o dispositivo atual como confiável e envia o token no cookie
+func (s *userServiceImpl) trustDevice(c *gin.Context, user *User, name string) (string, error) {
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	if name == "" {
+		name = userAgent
+	}
+
+	ttl := trustedDeviceTTL()
+	device := &TrustedDevice{
+		UserID:    user.ID,
+		Name:      name,
+		UserAgent: userAgent,
+		IPAddress: c.ClientIP(),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.repo.CreateTrustedDevice(device); err != nil {
+		return "", err
+	}
+
+	token, err := auth.GenerateTrustedDeviceToken(user.ID, device.ID, device.ExpiresAt)
+	if err != nil {
+		return "", err
+	}
+
+	// O front-end roda em outra origem, por isso SameSite=None (que exige Secure)
+	c.SetSameSite(http.SameSiteNoneMode)
+	c.SetCookie(trustedDeviceCookie, token, int(ttl.Seconds()), "/auth", "", true, true)
+	return token, nil
+}
+
+// isTrustedDevice indica se a requisição traz um token válido e não revogado de
+// dispositivo confiável deste usuário
+func (s *userServiceImpl) isTrustedDevice(c *gin.Context, user *User) bool {
+	token, err := c.Cookie(trustedDeviceCookie)
+	if err != nil || token == "" {
+		token = c.GetHeader(trustedDeviceHeader)
+	}
+	if token == "" {
+		return false
+	}
+
+	claims, deviceID, err := auth.ValidateTrustedDeviceToken(token)
+	if err != nil || claims.UserID != user.ID {
+		return false
+	}
+
+	if _, err := s.repo.GetActiveTrustedDevice(user.ID, deviceID); err != nil {
+		return false // Revogado, expirado ou erro de banco: exige o segundo fator
+	}
+
+	_ = s.repo.TouchTrustedDevice(deviceID)
+	return true
+}
+
+// ListTrustedDevices lista os dispositivos confiáveis do usuário logado
+func (s *userServiceImpl) ListTrustedDevices(c *gin.Context) {
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	devices, err := s.repo.GetTrustedDevicesByUserID(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar dispositivos confiáveis."})
+		return
+	}
+
+	c.JSON(http.StatusOK, devices)
+}
+
+// RevokeTrustedDevice revoga um dispositivo confiável do usuário logado
+func (s *userServiceImpl) RevokeTrustedDevice(c *gin.Context) {
+	deviceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de dispositivo inválido."})
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	deleted, err := s.repo.DeleteTrustedDevice(user.ID, uint(deviceID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao revogar dispositivo."})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Dispositivo não encontrado."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Dispositivo revogado com sucesso!"})
+}
+
+// RevokeAllTrustedDevices revoga todos os dispositivos confiáveis do usuário logado
+func (s *userServiceImpl) RevokeAllTrustedDevices(c *gin.Context) {
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	if err := s.repo.DeleteTrustedDevices(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao revogar dispositivos."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Todos os dispositivos confiáveis foram revogados."})
+}
@@ -0,0 +1,141 @@
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTrustedDeviceTestServer monta o login e as rotas de dispositivos do usuário informado
+func newTrustedDeviceTestServer(s *userServiceImpl, user *User) *gin.Engine {
+	r := gin.New()
+	r.POST("/login", s.Login)
+	r.POST("/login/mfa", s.LoginMFA)
+	private := r.Group("/", func(c *gin.Context) { c.Set("userID", user.ID) })
+	private.DELETE("/devices/:id", s.RevokeTrustedDevice)
+	private.DELETE("/devices", s.RevokeAllTrustedDevices)
+	return r
+}
+
+// rememberTestDevice conclui um login MFA pedindo para lembrar o dispositivo e retorna o token dele
+func rememberTestDevice(t *testing.T, s *userServiceImpl, r *gin.Engine, user *User, secret string) string {
+	t.Helper()
+	req := MFALoginRequest{MFAToken: newMFAChallenge(t, s, user), Code: currentTOTPCode(t, secret), RememberDevice: true, DeviceName: "notebook"}
+	code, body := doJSON(t, r, "POST", "/login/mfa", req)
+	if code != http.StatusOK || body["trusted_device_token"] == nil {
+		t.Fatalf("login MFA lembrando o dispositivo: %d %v", code, body)
+	}
+	return body["trusted_device_token"].(string)
+}
+
+// loginFromDevice faz o login por senha enviando o token do dispositivo no cabeçalho
+func loginFromDevice(t *testing.T, r *gin.Engine, username, deviceToken string) map[string]interface{} {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(fmt.Sprintf(`{"username":%q,"password":"senha123"}`, username)))
+	req.Header.Set("Content-Type", "application/json")
+	if deviceToken != "" {
+		req.Header.Set(trustedDeviceHeader, deviceToken)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: esperado 200, obtido %d (%s)", rec.Code, rec.Body.String())
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestTrustedDeviceSkipsMFAUntilRevoked(t *testing.T) {
+	_, s := newTestService(t)
+	user := createTestUser(t, s.repo, "alice")
+	secret := enableTestTOTP(t, s, user, "senha123")
+	r := newTrustedDeviceTestServer(s, user)
+	deviceToken := rememberTestDevice(t, s, r, user, secret)
+
+	if body := loginFromDevice(t, r, "alice", deviceToken); body["mfa_required"] == true || body["token"] == nil {
+		t.Errorf("dispositivo confiável: esperado token sem desafio MFA, obtido %v", body)
+	}
+	if body := loginFromDevice(t, r, "alice", ""); body["mfa_required"] != true {
+		t.Errorf("sem o dispositivo: esperado desafio MFA, obtido %v", body)
+	}
+
+	devices, err := s.repo.GetTrustedDevicesByUserID(user.ID)
+	if err != nil || len(devices) != 1 {
+		t.Fatalf("dispositivos: %v (%v)", devices, err)
+	}
+	if devices[0].Name != "notebook" || devices[0].LastUsedAt == nil {
+		t.Errorf("dispositivo registrado: nome %q, último uso %v", devices[0].Name, devices[0].LastUsedAt)
+	}
+	if code, _ := doJSON(t, r, "DELETE", fmt.Sprintf("/devices/%d", devices[0].ID), nil); code != http.StatusOK {
+		t.Fatalf("revogar: esperado 200, obtido %d", code)
+	}
+	if body := loginFromDevice(t, r, "alice", deviceToken); body["mfa_required"] != true {
+		t.Errorf("dispositivo revogado: esperado desafio MFA, obtido %v", body)
+	}
+}
+
+func TestTrustedDeviceBoundToUserAndExpiry(t *testing.T) {
+	db, s := newTestService(t)
+	alice := createTestUser(t, s.repo, "alice")
+	aliceSecret := enableTestTOTP(t, s, alice, "senha123")
+	bob := createTestUser(t, s.repo, "bob")
+	enableTestTOTP(t, s, bob, "senha123")
+	r := newTrustedDeviceTestServer(s, alice)
+	deviceToken := rememberTestDevice(t, s, r, alice, aliceSecret)
+
+	// O token de um dispositivo de alice não dispensa o segundo fator de bob
+	if body := loginFromDevice(t, r, "bob", deviceToken); body["mfa_required"] != true {
+		t.Errorf("dispositivo de outro usuário: esperado desafio MFA, obtido %v", body)
+	}
+
+	if err := db.Model(&TrustedDevice{}).Where("user_id = ?", alice.ID).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if body := loginFromDevice(t, r, "alice", deviceToken); body["mfa_required"] != true {
+		t.Errorf("dispositivo vencido: esperado desafio MFA, obtido %v", body)
+	}
+}
+
+func TestRevokeTrustedDevicesOfCurrentUserOnly(t *testing.T) {
+	_, s := newTestService(t)
+	alice := createTestUser(t, s.repo, "alice")
+	bob := createTestUser(t, s.repo, "bob")
+	for _, owner := range []*User{alice, alice, bob} {
+		if err := s.repo.CreateTrustedDevice(&TrustedDevice{UserID: owner.ID, Name: "celular", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bobDevices, err := s.repo.GetTrustedDevicesByUserID(bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTrustedDeviceTestServer(s, alice)
+
+	if code, _ := doJSON(t, r, "DELETE", fmt.Sprintf("/devices/%d", bobDevices[0].ID), nil); code != http.StatusNotFound {
+		t.Errorf("dispositivo de outro usuário: esperado 404, obtido %d", code)
+	}
+	if code, _ := doJSON(t, r, "DELETE", "/devices", nil); code != http.StatusOK {
+		t.Fatalf("revogar todos: esperado 200, obtido %d", code)
+	}
+	for _, tc := range []struct {
+		user *User
+		want int
+	}{{alice, 0}, {bob, 1}} {
+		devices, err := s.repo.GetTrustedDevicesByUserID(tc.user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(devices) != tc.want {
+			t.Errorf("%s: %d dispositivo(s), esperados %d", tc.user.Username, len(devices), tc.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package user
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api_authentication/configs"
+	"api_authentication/internal/mail"
+)
+
+// requestEmailChange registra o novo email como pendente, envia o link de confirmação ao novo
+// endereço e o aviso com link de cancelamento ao endereço atual. Se um dos envios falhar, a troca
+// é desfeita: o email pendente é limpo e os links deixam de valer.
+func (s *userServiceImpl) requestEmailChange(user *User, newEmail string) error {
+	ttl := configs.GetEnvDuration("EMAIL_CHANGE_TTL", 24*time.Hour)
+
+	confirmToken, _, err := s.issueOneTimeToken(user.ID, PurposeEmailChange, ttl, false)
+	if err != nil {
+		return err
+	}
+	cancelToken, _, err := s.issueOneTimeToken(user.ID, PurposeEmailChangeCancel, ttl, false)
+	if err != nil {
+		return err
+	}
+
+	// O endereço fica reservado antes do envio, para que outra conta não o tome no meio tempo
+	if err := s.repo.SetPendingEmail(user.ID, newEmail); err != nil {
+		return err
+	}
+	if err := s.sendEmailChangeMessages(user, newEmail, confirmToken, cancelToken, ttl); err != nil {
+		if rollbackErr := s.repo.SetPendingEmail(user.ID, ""); rollbackErr != nil {
+			log.Printf("Erro ao desfazer troca de email do userID %d: %v", user.ID, rollbackErr)
+		}
+		for _, purpose := range []string{PurposeEmailChange, PurposeEmailChangeCancel} {
+			if rollbackErr := s.repo.InvalidateOneTimeTokens(user.ID, purpose); rollbackErr != nil {
+				log.Printf("Erro ao invalidar links de troca de email do userID %d: %v", user.ID, rollbackErr)
+			}
+		}
+		return err
+	}
+
+	user.PendingEmail = newEmail
+	return nil
+}
+
+// sendEmailChangeMessages envia o link de confirmação ao novo endereço e o aviso com link de
+// cancelamento ao endereço atual
+func (s *userServiceImpl) sendEmailChangeMessages(user *User, newEmail, confirmToken, cancelToken string, ttl time.Duration) error {
+	appURL := configs.GetEnv("APP_URL", "http://localhost:5500")
+	if err := s.mailer.Send(mail.Message{
+		To:      newEmail,
+		Subject: "Confirme seu novo email",
+		Body: fmt.Sprintf("Olá, %s!\n\nConfirme a troca do email da sua conta para este endereço pelo link abaixo:\n%s\n\n"+
+			"O link expira em %s. Se você não pediu esta troca, ignore este email.",
+			user.Username, appURL+"/email-change/confirm?token="+url.QueryEscape(confirmToken), ttl),
+	}); err != nil {
+		return err
+	}
+
+	return s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Pedido de troca de email",
+		Body: fmt.Sprintf("Olá, %s!\n\nFoi pedida a troca do email da sua conta para %s. "+
+			"A troca só acontece depois da confirmação no novo endereço.\n\n"+
+			"Se não foi você, cancele pelo link abaixo e troque sua senha:\n%s",
+			user.Username, newEmail, appURL+"/email-change/cancel?token="+url.QueryEscape(cancelToken)),
+	})
+}
+
+// emailChangeUser resgata o token da finalidade e retorna o usuário com troca de email pendente
+func (s *userServiceImpl) emailChangeUser(c *gin.Context, purpose string) *User {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return nil
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return nil
+	}
+
+	record, err := s.redeemOneTimeToken(purpose, req.Token)
+	if err != nil {
+		if err == errInvalidOneTimeToken {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Link inválido ou expirado."})
+			return nil
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar link."})
+		return nil
+	}
+
+	user, err := s.repo.GetUserByID(record.UserID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Link inválido ou expirado."})
+			return nil
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuário."})
+		return nil
+	}
+
+	if user.PendingEmail == "" {
+		c.JSON(http.StatusConflict, gin.H{"message": "Não há troca de email pendente."})
+		return nil
+	}
+	return user
+}
+
+// ConfirmEmailChange aplica a troca de email com o token enviado ao novo endereço
+func (s *userServiceImpl) ConfirmEmailChange(c *gin.Context) {
+	user := s.emailChangeUser(c, PurposeEmailChange)
+	if user == nil {
+		return
+	}
+
+	// O endereço ficou reservado, mas outra conta pode ter sido criada antes desta proteção
+	taken, err := s.repo.IsEmailReserved(user.PendingEmail, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar email."})
+		return
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"message": "Email já em uso."})
+		return
+	}
+
+	if !s.checkEmailPolicy(c, user.PendingEmail, user.ID) {
+		return
+	}
+
+	// O link prova o controle do novo endereço, que fica confirmado
+	oldEmail := user.Email
+	changed, err := s.repo.ApplyEmailChange(user.ID, user.PendingEmail, s.emailPolicy.Canonicalize(user.PendingEmail), time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao trocar email."})
+		return
+	}
+	if !changed {
+		c.JSON(http.StatusConflict, gin.H{"message": "Não há troca de email pendente."})
+		return
+	}
+	user.Email = user.PendingEmail
+
+	if err := s.repo.InvalidateOneTimeTokens(user.ID, PurposeEmailChangeCancel); err != nil {
+		log.Printf("Erro ao invalidar cancelamento de troca de email do userID %d: %v", user.ID, err)
+	}
+	if err := s.mailer.Send(mail.Message{
+		To:      oldEmail,
+		Subject: "Email da conta alterado",
+		Body: fmt.Sprintf("Olá, %s!\n\nO email da sua conta foi alterado para %s. "+
+			"Se não foi você, entre em contato com o suporte imediatamente.", user.Username, user.Email),
+	}); err != nil {
+		log.Printf("Erro ao avisar troca de email para userID %d: %v", user.ID, err)
+	}
+
+	s.audit(c, user.ID, AuditEmailChanged, map[string]interface{}{"old_email": oldEmail, "new_email": user.Email})
+	c.JSON(http.StatusOK, gin.H{"message": "Email alterado com sucesso!"})
+}
+
+// CancelEmailChange descarta a troca de email pendente com o token enviado ao endereço atual
+func (s *userServiceImpl) CancelEmailChange(c *gin.Context) {
+	user := s.emailChangeUser(c, PurposeEmailChangeCancel)
+	if user == nil {
+		return
+	}
+
+	// Só descarta a troca lida agora: se ela acabou de ser confirmada, o email novo fica
+	cancelled, err := s.repo.CancelEmailChange(user.ID, user.PendingEmail)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao cancelar troca de email."})
+		return
+	}
+	if !cancelled {
+		c.JSON(http.StatusConflict, gin.H{"message": "Não há troca de email pendente."})
+		return
+	}
+	if err := s.repo.InvalidateOneTimeTokens(user.ID, PurposeEmailChange); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao cancelar troca de email."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Troca de email cancelada."})
+}
@@ -0,0 +1,134 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"api_authentication/internal/mail"
+)
+
+// failingMailer falha a partir do envio de número failAt (1 = o primeiro)
+type failingMailer struct {
+	sent   int
+	failAt int
+}
+
+func (m *failingMailer) Send(mail.Message) error {
+	m.sent++
+	if m.sent >= m.failAt {
+		return errors.New("servidor de email indisponível")
+	}
+	return nil
+}
+
+func TestRequestEmailChangeRollsBackWhenSendingFails(t *testing.T) {
+	for _, failAt := range []int{1, 2} { // Confirmação ao novo endereço, aviso ao atual
+		_, s := newTestService(t)
+		s.mailer = &failingMailer{failAt: failAt}
+		user := createTestUser(t, s.repo, "dave")
+
+		if err := s.requestEmailChange(user, "novo@example.com"); err == nil {
+			t.Fatalf("envio %d: esperado erro", failAt)
+		}
+
+		stored, err := s.repo.GetUserByID(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.PendingEmail != "" || user.PendingEmail != "" {
+			t.Errorf("envio %d: email pendente mantido após a falha: %q", failAt, stored.PendingEmail)
+		}
+		for _, purpose := range []string{PurposeEmailChange, PurposeEmailChangeCancel} {
+			if _, err := s.repo.GetLatestActiveOneTimeToken(user.ID, purpose); err == nil {
+				t.Errorf("envio %d: link %s continua válido", failAt, purpose)
+			}
+		}
+	}
+}
+
+func TestRequestEmailChangeKeepsPendingWhenSent(t *testing.T) {
+	_, s := newTestService(t)
+	s.mailer = &failingMailer{failAt: 3}
+	user := createTestUser(t, s.repo, "dave")
+
+	if err := s.requestEmailChange(user, "novo@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := s.repo.GetUserByID(user.ID)
+	if stored.PendingEmail != "novo@example.com" {
+		t.Errorf("email pendente não gravado: %q", stored.PendingEmail)
+	}
+}
+
+// confirmOnLoadRepository confirma a troca de email logo depois de carregar o usuário,
+// simulando uma confirmação concorrente com o cancelamento
+type confirmOnLoadRepository struct {
+	UserRepository
+	t *testing.T
+}
+
+func (r confirmOnLoadRepository) GetUserByID(id uint) (*User, error) {
+	user, err := r.UserRepository.GetUserByID(id)
+	if err == nil && user.PendingEmail != "" {
+		if _, err := r.ApplyEmailChange(id, user.PendingEmail, user.PendingEmail, time.Now()); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+	return user, err
+}
+
+func TestCancelEmailChangeKeepsConcurrentConfirmation(t *testing.T) {
+	_, s := newTestService(t)
+	user := createTestUser(t, s.repo, "dave")
+	if err := s.repo.SetPendingEmail(user.ID, "novo@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	cancelToken, _, err := s.issueOneTimeToken(user.ID, PurposeEmailChangeCancel, time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := s.repo
+	s.repo = confirmOnLoadRepository{UserRepository: repo, t: t}
+	r := gin.New()
+	r.POST("/email-change/cancel", s.CancelEmailChange)
+
+	if code, _ := doJSON(t, r, "POST", "/email-change/cancel", VerifyEmailRequest{Token: cancelToken}); code != http.StatusConflict {
+		t.Errorf("cancelamento de troca já confirmada: esperado 409, obtido %d", code)
+	}
+	stored, err := repo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Email != "novo@example.com" {
+		t.Errorf("cancelamento desfez a troca confirmada: email=%q", stored.Email)
+	}
+}
+
+func TestCancelEmailChange(t *testing.T) {
+	_, s := newTestService(t)
+	user := createTestUser(t, s.repo, "dave")
+	if err := s.repo.SetPendingEmail(user.ID, "novo@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	cancelToken, _, err := s.issueOneTimeToken(user.ID, PurposeEmailChangeCancel, time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.POST("/email-change/cancel", s.CancelEmailChange)
+
+	if code, _ := doJSON(t, r, "POST", "/email-change/cancel", VerifyEmailRequest{Token: cancelToken}); code != http.StatusOK {
+		t.Fatalf("cancelamento: esperado 200, obtido %d", code)
+	}
+	stored, err := s.repo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.PendingEmail != "" || stored.Email != "dave@example.com" {
+		t.Errorf("troca não cancelada: email=%q pendente=%q", stored.Email, stored.PendingEmail)
+	}
+}
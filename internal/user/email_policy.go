@@ -0,0 +1,61 @@
+package user
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"api_authentication/internal/emailpolicy"
+)
+
+// canonicalBackfillBatch é o tamanho do lote do preenchimento de emails canônicos
+const canonicalBackfillBatch = 500
+
+// checkEmailPolicy aplica a política de domínios e recusa endereços que caem na mesma caixa
+// postal de outra conta. Responde e retorna false quando o email não pode ser usado.
+func (s *userServiceImpl) checkEmailPolicy(c *gin.Context, email string, exceptID uint) bool {
+	if err := s.emailPolicy.Check(email); err != nil {
+		switch err {
+		case emailpolicy.ErrDomainNotAllowed:
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Este domínio de email não é aceito para cadastro."})
+		case emailpolicy.ErrDomainBlocked:
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Este domínio de email está bloqueado."})
+		case emailpolicy.ErrDisposableEmail:
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Endereços de email descartáveis não são aceitos."})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar email."})
+		}
+		return false
+	}
+
+	taken, err := s.repo.IsCanonicalEmailReserved(s.emailPolicy.Canonicalize(email), exceptID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar email."})
+		return false
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"message": "Este endereço de email já está associado a uma conta."})
+		return false
+	}
+	return true
+}
+
+// BackfillCanonicalEmails preenche o email canônico das contas criadas antes dessa coluna existir
+func BackfillCanonicalEmails(repo UserRepository, policy *emailpolicy.Policy) (int, error) {
+	filled := 0
+	for {
+		users, err := repo.GetUsersWithoutCanonicalEmail(canonicalBackfillBatch)
+		if err != nil {
+			return filled, err
+		}
+		for _, u := range users {
+			if err := repo.SetCanonicalEmail(u.ID, policy.Canonicalize(u.Email)); err != nil {
+				return filled, err
+			}
+			filled++
+		}
+		if len(users) < canonicalBackfillBatch {
+			return filled, nil
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package user
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api_authentication/internal/auth"
+)
+
+// Motivos registrados em ErasureReceipt.Reason
+const (
+	ErasureUserRequest      = "user_request"
+	ErasureAdminRequest     = "admin_request"
+	ErasureRetentionExpired = "retention_expired"
+)
+
+// erasureCategories descreve, no recibo, o que EraseUser faz com cada categoria de dados
+var erasureCategories = []string{
+	"profile:anonymised",
+	"credentials:deleted",
+	"mfa:deleted",
+	"trusted_devices:deleted",
+	"one_time_tokens:deleted",
+	"user_roles:deleted",
+	"memberships:deleted",
+	"group_memberships:deleted",
+	"relation_tuples:deleted",
+	"audit_events:scrubbed",
+	"legal_acceptances:scrubbed",
+	"invitations:scrubbed",
+	"data_exports:deleted",
+}
+
+// eraseUser apaga os dados pessoais da conta e grava o recibo
+func eraseUser(repo UserRepository, userID uint, reason string, requestedByID *uint) (*ErasureReceipt, error) {
+	receipt := &ErasureReceipt{
+		Reason:        reason,
+		RequestedByID: requestedByID,
+		Categories:    strings.Join(erasureCategories, ","),
+	}
+	if err := repo.EraseUser(userID, receipt); err != nil {
+		return nil, err
+	}
+
+	if _, err := PurgeExpiredDataExports(repo); err != nil {
+		log.Printf("Erro ao remover exportações do userID %d apagado: %v", userID, err)
+	}
+	return receipt, nil
+}
+
+// EraseAccount apaga imediatamente os dados pessoais do usuário logado (direito ao esquecimento).
+// Diferente da exclusão, não há prazo de restauração.
+func (s *userServiceImpl) EraseAccount(c *gin.Context) {
+	var req EraseAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	// Mesmas proteções do login contra tentativas repetidas
+	passwordOK := auth.CheckPasswordHash(req.Password, user.Password)
+	if isLoginLocked(user, time.Now()) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"message": "Muitas tentativas incorretas. Tente novamente mais tarde."})
+		return
+	}
+	if !passwordOK {
+		if err := s.registerFailedAttempt(c, user, map[string]interface{}{"action": "erase_account"}); err != nil {
+			log.Printf("Erro ao registrar falha de login para userID %d: %v", user.ID, err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Senha incorreta."})
+		return
+	}
+
+	s.respondErasure(c, user.ID, ErasureUserRequest, nil)
+}
+
+// AdminEraseUser (rota de administrador) apaga os dados pessoais de uma conta, inclusive já excluída
+func (s *userServiceImpl) AdminEraseUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de usuário inválido."})
+		return
+	}
+
+	adminID := c.MustGet("userID").(uint)
+	if uint(userID) == adminID {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Use /api/perfil/erase para apagar a própria conta."})
+		return
+	}
+
+	s.respondErasure(c, uint(userID), ErasureAdminRequest, &adminID)
+}
+
+func (s *userServiceImpl) respondErasure(c *gin.Context, userID uint, reason string, requestedByID *uint) {
+	receipt, err := eraseUser(s.repo, userID, reason, requestedByID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado ou já apagado."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao apagar dados do usuário."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Dados pessoais apagados com sucesso.", "receipt": receipt})
+}
@@ -0,0 +1,134 @@
+package user
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"api_authentication/internal/auth"
+)
+
+func TestEraseUserScrubsRedeemedInvitation(t *testing.T) {
+	db, s := newTestService(t)
+	inviter := createTestUser(t, s.repo, "inviter")
+	invitation := &Invitation{CodeHash: "hash", Email: "invitee@example.com", CreatedByID: inviter.ID}
+	if err := s.repo.CreateInvitation(invitation); err != nil {
+		t.Fatal(err)
+	}
+	invitee := createTestUser(t, s.repo, "invitee")
+	if err := db.Model(&User{}).Where("id = ?", invitee.ID).Update("invitation_id", invitation.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := eraseUser(s.repo, invitee.ID, ErasureUserRequest, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored Invitation
+	if err := db.First(&stored, invitation.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Email != "" {
+		t.Errorf("email do convite usado no cadastro mantido após o apagamento: %q", stored.Email)
+	}
+}
+
+func TestEraseAccountWrongPasswordCountsAsFailedLogin(t *testing.T) {
+	_, s := newTestService(t)
+	user := createTestUser(t, s.repo, "erase")
+	hash, err := auth.HashPassword("correta123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.repo.UpdateUserProfile(user.ID, map[string]interface{}{"password": hash}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.POST("/erase", func(c *gin.Context) { c.Set("userID", user.ID) }, s.EraseAccount)
+	if code, _ := doJSON(t, r, "POST", "/erase", EraseAccountRequest{Password: "errada", Confirm: true}); code != http.StatusUnauthorized {
+		t.Fatalf("senha errada: esperado 401, obtido %d", code)
+	}
+
+	stored, err := s.repo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.FailedLoginAttempts != 1 {
+		t.Errorf("esperada 1 falha de login registrada, obtidas %d", stored.FailedLoginAttempts)
+	}
+}
+
+func TestFinishDataExportAfterErasure(t *testing.T) {
+	db, s := newTestService(t)
+	user := createTestUser(t, s.repo, "export")
+	export := &DataExport{UserID: user.ID, Status: DataExportPending}
+	if err := s.repo.CreateDataExport(export); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := eraseUser(s.repo, user.ID, ErasureUserRequest, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// A geração concluída depois do apagamento não pode reabrir o link de download
+	export.Status = DataExportReady
+	export.TokenHash = "token"
+	ok, err := s.repo.FinishDataExport(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("exportação invalidada pelo apagamento foi marcada como pronta")
+	}
+	var ready int64
+	if err := db.Model(&DataExport{}).Where("user_id = ? AND status = ?", user.ID, DataExportReady).Count(&ready).Error; err != nil {
+		t.Fatal(err)
+	}
+	if ready != 0 {
+		t.Errorf("exportação do usuário apagado ficou disponível para download")
+	}
+}
+
+// eraseOnLoadRepository apaga o usuário logo depois de carregá-lo, simulando um apagamento
+// concorrente com uma requisição que já leu a linha
+type eraseOnLoadRepository struct {
+	UserRepository
+	t *testing.T
+}
+
+func (r eraseOnLoadRepository) GetUserByID(id uint) (*User, error) {
+	user, err := r.UserRepository.GetUserByID(id)
+	if err == nil {
+		if _, err := eraseUser(r.UserRepository, id, ErasureAdminRequest, nil); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+	return user, err
+}
+
+func TestStaleUpdateDoesNotUndoErasure(t *testing.T) {
+	db, s := newTestService(t)
+	user := createTestUser(t, s.repo, "vitima")
+	s.repo = eraseOnLoadRepository{UserRepository: s.repo, t: t}
+
+	r := gin.New()
+	r.PUT("/users/:id", s.UpdateUser)
+	password := "novasenha123"
+	if code, _ := doJSON(t, r, "PUT", "/users/"+strconv.FormatUint(uint64(user.ID), 10), UpdateUserRequest{Password: &password}); code != http.StatusNotFound {
+		t.Errorf("atualização de conta apagada: esperado 404, obtido %d", code)
+	}
+
+	var stored User
+	if err := db.Unscoped().First(&stored, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Username == "vitima" || stored.Email == "vitima@example.com" || stored.Password != "" {
+		t.Errorf("dados apagados foram regravados: username=%q email=%q", stored.Username, stored.Email)
+	}
+	if !stored.DeletedAt.Valid || stored.PurgedAt == nil || stored.Status != StatusDeleted {
+		t.Errorf("conta apagada voltou a ficar ativa: status=%q", stored.Status)
+	}
+}
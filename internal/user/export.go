@@ -0,0 +1,354 @@
+package user
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api_authentication/configs"
+	"api_authentication/internal/auth"
+	"api_authentication/internal/mail"
+	"api_authentication/internal/relations"
+)
+
+// Estados de DataExport.Status
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// dataExportFormatVersion identifica o formato do arquivo exportado
+const dataExportFormatVersion = 1
+
+// dataExportStaleAfter é o tempo após o qual uma exportação ainda pendente é considerada abandonada
+const dataExportStaleAfter = time.Hour
+
+// exportedToken é a forma exportada de um OneTimeToken (sem os hashes)
+type exportedToken struct {
+	Purpose   string     `json:"purpose"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func dataExportDir() string {
+	return configs.GetEnv("DATA_EXPORT_DIR", "exports")
+}
+
+// RequestDataExport inicia a geração, em segundo plano, do arquivo com os dados do usuário logado
+func (s *userServiceImpl) RequestDataExport(c *gin.Context) {
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	pending, err := s.repo.GetPendingDataExport(user.ID)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"message": "Já existe uma exportação em andamento.", "export": pending})
+		return
+	}
+	if err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar exportações."})
+		return
+	}
+
+	export := &DataExport{UserID: user.ID, Status: DataExportPending}
+	if err := s.repo.CreateDataExport(export); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao solicitar exportação."})
+		return
+	}
+	s.audit(c, user.ID, AuditDataExportRequested, map[string]interface{}{"export_id": export.ID})
+
+	go s.buildDataExport(export)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Exportação iniciada. Você receberá um email com o link de download quando estiver pronta.",
+		"export":  export,
+	})
+}
+
+// GetDataExport consulta o andamento de uma exportação do usuário logado
+func (s *userServiceImpl) GetDataExport(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "ID do usuário não encontrado no contexto."})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de exportação inválido."})
+		return
+	}
+
+	export, err := s.repo.GetDataExport(userID.(uint), uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Exportação não encontrada."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar exportação."})
+		return
+	}
+
+	c.JSON(http.StatusOK, export) // O link de download só é enviado por email
+}
+
+// DownloadDataExport entrega o arquivo pelo link enviado por email (público, protegido pelo token)
+func (s *userServiceImpl) DownloadDataExport(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	token := c.Query("token")
+	if err != nil || token == "" {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Link de download inválido ou expirado."})
+		return
+	}
+
+	export, err := s.repo.GetDataExportByID(uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Link de download inválido ou expirado."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar exportação."})
+		return
+	}
+
+	if export.Status != DataExportReady || export.ExpiresAt == nil || time.Now().After(*export.ExpiresAt) ||
+		export.TokenHash != auth.HashToken(token) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Link de download inválido ou expirado."})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.FileAttachment(export.FilePath, fmt.Sprintf("dados-pessoais-%d.zip", export.UserID))
+}
+
+// buildDataExport gera o zip, marca a exportação como pronta e envia o link por email
+func (s *userServiceImpl) buildDataExport(export *DataExport) {
+	user, err := s.repo.GetUserByID(export.UserID)
+	if err == nil {
+		err = s.writeDataExport(export, user)
+	}
+	if err != nil {
+		log.Printf("Erro ao gerar exportação %d do userID %d: %v", export.ID, export.UserID, err)
+		expiresAt := time.Now().Add(configs.GetEnvDuration("DATA_EXPORT_TTL", 24*time.Hour))
+		export.Status = DataExportFailed
+		export.Error = "Não foi possível gerar a exportação. Tente novamente."
+		export.ExpiresAt = &expiresAt // O registro da falha some junto com as exportações vencidas
+		if export.FilePath != "" {
+			os.Remove(export.FilePath)
+			export.FilePath = ""
+		}
+		if _, err := s.repo.FinishDataExport(export); err != nil {
+			log.Printf("Erro ao atualizar exportação %d: %v", export.ID, err)
+		}
+		return
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		log.Printf("Erro ao gerar token da exportação %d: %v", export.ID, err)
+		return
+	}
+	now := time.Now()
+	expiresAt := now.Add(configs.GetEnvDuration("DATA_EXPORT_TTL", 24*time.Hour))
+	export.Status = DataExportReady
+	export.TokenHash = auth.HashToken(token)
+	export.CompletedAt = &now
+	export.ExpiresAt = &expiresAt
+	ok, err := s.repo.FinishDataExport(export)
+	if err != nil || !ok {
+		// Sem o registro o arquivo nunca seria expurgado; os dados do usuário podem ter sido apagados enquanto era gerado
+		if err != nil {
+			log.Printf("Erro ao atualizar exportação %d: %v", export.ID, err)
+		}
+		os.Remove(export.FilePath)
+		return
+	}
+
+	link := fmt.Sprintf("%s/exports/%d/download?token=%s",
+		configs.GetEnv("API_URL", "http://localhost:8080"), export.ID, url.QueryEscape(token))
+	if err := s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Seus dados estão prontos para download",
+		Body: fmt.Sprintf("Olá, %s!\n\nA cópia dos seus dados pessoais está pronta:\n%s\n\n"+
+			"O link expira em %s. Se você não pediu esta exportação, troque sua senha.",
+			user.Username, link, expiresAt.Format(time.RFC1123)),
+	}); err != nil {
+		log.Printf("Erro ao enviar link da exportação %d: %v", export.ID, err)
+	}
+}
+
+// writeDataExport grava o zip com um arquivo JSON por categoria de dados
+func (s *userServiceImpl) writeDataExport(export *DataExport, user *User) error {
+	dir := dataExportDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	name, err := auth.GenerateOpaqueToken() // Nome imprevisível para o arquivo
+	if err != nil {
+		return err
+	}
+	export.FilePath = filepath.Join(dir, name+".zip")
+
+	files, err := s.collectUserData(user)
+	if err != nil {
+		return err
+	}
+	files["export.json"] = map[string]interface{}{
+		"format_version": dataExportFormatVersion,
+		"export_id":      export.ID,
+		"user_id":        user.ID,
+		"generated_at":   time.Now(),
+	}
+
+	f, err := os.OpenFile(export.FilePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	zw := zip.NewWriter(f)
+	for _, name := range names {
+		data := files[name]
+		w, err := zw.Create(name)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(data); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// collectUserData reúne todos os registros pessoais do usuário, indexados pelo nome do arquivo no zip
+func (s *userServiceImpl) collectUserData(user *User) (map[string]interface{}, error) {
+	files := map[string]interface{}{"profile.json": user}
+
+	devices, err := s.repo.GetAllTrustedDevicesByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	files["sessions/trusted_devices.json"] = devices
+
+	credentials, err := s.repo.GetWebAuthnCredentialsByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	files["security/passkeys.json"] = credentials
+
+	codes, err := s.repo.GetRecoveryCodesByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	files["security/recovery_codes.json"] = codes
+
+	tokens, err := s.repo.GetOneTimeTokensByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	exportedTokens := make([]exportedToken, 0, len(tokens))
+	for _, t := range tokens {
+		exportedTokens = append(exportedTokens, exportedToken{Purpose: t.Purpose, ExpiresAt: t.ExpiresAt, UsedAt: t.UsedAt, CreatedAt: t.CreatedAt})
+	}
+	files["security/one_time_tokens.json"] = exportedTokens
+
+	roles, err := s.repo.GetUserRoles(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	files["security/roles.json"] = roles
+
+	groups, err := EffectiveGroups(s.repo, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	files["security/groups.json"] = groups
+
+	events, err := s.repo.GetAuditEventsByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	logins := make([]AuditEvent, 0)
+	for _, e := range events {
+		if strings.HasPrefix(e.Action, "login.") {
+			logins = append(logins, e)
+		}
+	}
+	files["activity/login_history.json"] = logins
+	files["activity/audit_events.json"] = events
+
+	memberships, err := s.repo.GetUserMemberships(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	files["organizations.json"] = memberships
+
+	tuples, err := s.repo.GetRelationTuples(RelationTuple{SubjectNamespace: relations.UserNamespace, SubjectObjectID: strconv.FormatUint(uint64(user.ID), 10)}, 0)
+	if err != nil {
+		return nil, err
+	}
+	files["relations.json"] = tuples
+
+	acceptances, err := s.repo.GetLegalAcceptancesByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	files["legal_acceptances.json"] = acceptances
+
+	invitations, err := s.repo.GetInvitations(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	files["invitations.json"] = invitations
+
+	return files, nil
+}
+
+// PurgeExpiredDataExports remove os arquivos e registros de exportações vencidas, além das que
+// ficaram pendentes por mais de dataExportStaleAfter (ex.: instância reiniciada durante a geração)
+func PurgeExpiredDataExports(repo UserRepository) (int, error) {
+	now := time.Now()
+	exports, err := repo.GetExpiredDataExports(now, now.Add(-dataExportStaleAfter))
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range exports {
+		if e.FilePath != "" {
+			if err := os.Remove(e.FilePath); err != nil && !os.IsNotExist(err) {
+				return 0, err
+			}
+		}
+		if err := repo.DeleteDataExport(e.ID); err != nil {
+			return 0, err
+		}
+	}
+	return len(exports), nil
+}
@@ -0,0 +1,166 @@
+package user
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var dataExportLinkPattern = regexp.MustCompile(`/exports/(\d+)/download\?token=(\S+)`)
+
+// newDataExportTestServer prepara o serviço para gerar exportações num diretório temporário
+func newDataExportTestServer(t *testing.T, s *userServiceImpl, userID uint) (*recordingMailer, *gin.Engine) {
+	t.Helper()
+	t.Setenv("DATA_EXPORT_DIR", t.TempDir())
+	mailer := &recordingMailer{}
+	s.mailer = mailer
+
+	r := gin.New()
+	r.GET("/exports/:id/download", s.DownloadDataExport)
+	private := r.Group("/", func(c *gin.Context) { c.Set("userID", userID) })
+	private.POST("/perfil/export", s.RequestDataExport)
+	private.GET("/perfil/export/:id", s.GetDataExport)
+	return mailer, r
+}
+
+// buildTestDataExport gera a exportação do usuário e retorna o link de download enviado por email
+func buildTestDataExport(t *testing.T, s *userServiceImpl, mailer *recordingMailer, userID uint) (*DataExport, string) {
+	t.Helper()
+	export := &DataExport{UserID: userID, Status: DataExportPending}
+	if err := s.repo.CreateDataExport(export); err != nil {
+		t.Fatal(err)
+	}
+	s.buildDataExport(export)
+	if export.Status != DataExportReady || len(mailer.messages) == 0 {
+		t.Fatalf("exportação não concluída: status=%q, erro=%q", export.Status, export.Error)
+	}
+	match := dataExportLinkPattern.FindStringSubmatch(mailer.messages[len(mailer.messages)-1].Body)
+	if match == nil {
+		t.Fatalf("email sem link de download: %q", mailer.messages[len(mailer.messages)-1].Body)
+	}
+	token, err := url.QueryUnescape(match[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return export, token
+}
+
+func download(t *testing.T, r *gin.Engine, id uint, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/exports/%d/download?token=%s", id, url.QueryEscape(token)), nil))
+	return rec
+}
+
+func TestDataExportDownload(t *testing.T) {
+	_, s := newTestService(t)
+	user := createTestUser(t, s.repo, "alice")
+	mailer, r := newDataExportTestServer(t, s, user.ID)
+	export, token := buildTestDataExport(t, s, mailer, user.ID)
+
+	rec := download(t, r, export.ID, token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("download: esperado 200, obtido %d", rec.Code)
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("download sem Cache-Control: no-store")
+	}
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var profile map[string]interface{}
+	for _, f := range archive.File {
+		if f.Name != "profile.json" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.NewDecoder(rc).Decode(&profile)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if profile["username"] != "alice" {
+		t.Errorf("profile.json sem os dados do usuário: %v", profile)
+	}
+	if _, ok := profile["password"]; ok {
+		t.Error("profile.json contém a senha")
+	}
+
+	for name, rec := range map[string]*httptest.ResponseRecorder{
+		"token errado":           download(t, r, export.ID, "errado"),
+		"exportação inexistente": download(t, r, export.ID+1, token),
+	} {
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: esperado 404, obtido %d", name, rec.Code)
+		}
+	}
+}
+
+func TestDataExportExpiry(t *testing.T) {
+	db, s := newTestService(t)
+	user := createTestUser(t, s.repo, "alice")
+	mailer, r := newDataExportTestServer(t, s, user.ID)
+	export, token := buildTestDataExport(t, s, mailer, user.ID)
+
+	if err := db.Model(&DataExport{}).Where("id = ?", export.ID).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if rec := download(t, r, export.ID, token); rec.Code != http.StatusNotFound {
+		t.Errorf("link vencido: esperado 404, obtido %d", rec.Code)
+	}
+
+	purged, err := PurgeExpiredDataExports(s.repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 {
+		t.Errorf("expurgadas %d exportações, esperada 1", purged)
+	}
+	if _, err := os.Stat(export.FilePath); !os.IsNotExist(err) {
+		t.Errorf("arquivo da exportação vencida mantido: %v", err)
+	}
+	if code, _ := doJSON(t, r, "GET", fmt.Sprintf("/perfil/export/%d", export.ID), nil); code != http.StatusNotFound {
+		t.Errorf("registro da exportação vencida: esperado 404, obtido %d", code)
+	}
+}
+
+func TestDataExportRequestAndStatus(t *testing.T) {
+	_, s := newTestService(t)
+	alice := createTestUser(t, s.repo, "alice")
+	bob := createTestUser(t, s.repo, "bob")
+	_, r := newDataExportTestServer(t, s, alice.ID)
+
+	pending := &DataExport{UserID: alice.ID, Status: DataExportPending}
+	if err := s.repo.CreateDataExport(pending); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := doJSON(t, r, "POST", "/perfil/export", nil); code != http.StatusConflict {
+		t.Errorf("com exportação em andamento: esperado 409, obtido %d", code)
+	}
+	if code, body := doJSON(t, r, "GET", fmt.Sprintf("/perfil/export/%d", pending.ID), nil); code != http.StatusOK || body["status"] != DataExportPending {
+		t.Errorf("consulta da própria exportação: %d %v", code, body)
+	}
+
+	other := &DataExport{UserID: bob.ID, Status: DataExportPending}
+	if err := s.repo.CreateDataExport(other); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := doJSON(t, r, "GET", fmt.Sprintf("/perfil/export/%d", other.ID), nil); code != http.StatusNotFound {
+		t.Errorf("exportação de outro usuário: esperado 404, obtido %d", code)
+	}
+}
@@ -0,0 +1,551 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api_authentication/configs"
+)
+
+// Ações de auditoria sobre grupos
+const (
+	AuditGroupJoined = "group.joined"
+	AuditGroupLeft   = "group.left"
+)
+
+// errGroupCycle indica que o subgrupo conteria, direta ou indiretamente, o próprio grupo
+var errGroupCycle = errors.New("ciclo de grupos")
+
+// groupsKey guarda no contexto os nomes dos grupos efetivos do usuário (preenchido por LoadAuthorization)
+const groupsKey = "groups"
+
+// membershipCacheMaxEntries limita o número de usuários no cache de grupos efetivos
+const membershipCacheMaxEntries = 10000
+
+// membershipCache guarda os grupos efetivos (diretos e herdados) de cada usuário por GROUP_CACHE_TTL.
+// Qualquer mudança de grupos nesta instância limpa o cache; outras instâncias enxergam a mudança
+// quando o prazo vence. Entradas vencidas saem na leitura e, quando o cache enche, numa varredura.
+// A geração conta as limpezas: um resultado calculado antes de uma delas não volta para o cache.
+type membershipCache struct {
+	mu         sync.Mutex
+	entries    map[uint]membershipCacheEntry
+	generation uint64
+}
+
+type membershipCacheEntry struct {
+	groups    []Group
+	expiresAt time.Time
+}
+
+var effectiveGroupsCache = &membershipCache{entries: make(map[uint]membershipCacheEntry)}
+
+func (m *membershipCache) get(userID uint) ([]Group, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[userID]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(entry.expiresAt) {
+		delete(m.entries, userID)
+		return nil, false
+	}
+	return entry.groups, true
+}
+
+// currentGeneration retorna a geração a informar em set para o resultado calculado a seguir
+func (m *membershipCache) currentGeneration() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.generation
+}
+
+// set guarda os grupos do usuário, a menos que o cache tenha sido limpo desde a geração informada
+func (m *membershipCache) set(userID uint, groups []Group, generation uint64) {
+	ttl := configs.GetEnvDuration("GROUP_CACHE_TTL", time.Minute)
+	if ttl <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if generation != m.generation {
+		return
+	}
+	now := time.Now()
+	if _, exists := m.entries[userID]; !exists && len(m.entries) >= membershipCacheMaxEntries {
+		for id, entry := range m.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(m.entries, id)
+			}
+		}
+		// Todas ainda válidas: recomeça do zero em vez de crescer sem limite
+		if len(m.entries) >= membershipCacheMaxEntries {
+			m.entries = make(map[uint]membershipCacheEntry)
+		}
+	}
+	m.entries[userID] = membershipCacheEntry{groups: groups, expiresAt: now.Add(ttl)}
+}
+
+func (m *membershipCache) invalidate() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = make(map[uint]membershipCacheEntry)
+	m.generation++
+}
+
+// EffectiveGroups retorna os grupos do usuário: os diretos e todos os que os contêm, em qualquer nível
+func EffectiveGroups(repo UserRepository, userID uint) ([]Group, error) {
+	if groups, ok := effectiveGroupsCache.get(userID); ok {
+		return groups, nil
+	}
+
+	generation := effectiveGroupsCache.currentGeneration()
+	direct, err := repo.GetUserGroupIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := closure(direct, repo.GetParentGroupIDs)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := repo.GetGroupsByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	effectiveGroupsCache.set(userID, groups, generation)
+	return groups, nil
+}
+
+// closure percorre o grafo de grupos a partir de start (inclusive), seguindo next nível a nível.
+// Grupos já visitados não são expandidos de novo, então um ciclo vindo do banco não trava a busca.
+func closure(start []uint, next func([]uint) ([]uint, error)) ([]uint, error) {
+	seen := make(map[uint]bool, len(start))
+	frontier := make([]uint, 0, len(start))
+	for _, id := range start {
+		if !seen[id] {
+			seen[id] = true
+			frontier = append(frontier, id)
+		}
+	}
+
+	for len(frontier) > 0 {
+		found, err := next(frontier)
+		if err != nil {
+			return nil, err
+		}
+		frontier = frontier[:0]
+		for _, id := range found {
+			if !seen[id] {
+				seen[id] = true
+				frontier = append(frontier, id)
+			}
+		}
+	}
+
+	ids := make([]uint, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// createsCycle indica se colocar childID dentro de parentID fecharia um ciclo, isto é,
+// se parentID já está contido (em qualquer nível) em childID ou é o próprio childID
+func createsCycle(repo UserRepository, parentID, childID uint) (bool, error) {
+	descendants, err := closure([]uint{childID}, repo.GetChildGroupIDs)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range descendants {
+		if id == parentID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// groupNames retorna os nomes dos grupos, na ordem recebida
+func groupNames(groups []Group) []string {
+	names := make([]string, 0, len(groups))
+	for _, g := range groups {
+		names = append(names, g.Name)
+	}
+	return names
+}
+
+// contextGroups retorna os nomes dos grupos efetivos do usuário logado
+func contextGroups(c *gin.Context) []string {
+	if value, exists := c.Get(groupsKey); exists {
+		return value.([]string)
+	}
+	return []string{}
+}
+
+// AdminListGroups (rota de administrador) lista os grupos com seus papéis
+func (s *userServiceImpl) AdminListGroups(c *gin.Context) {
+	groups, err := s.repo.GetGroups()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao listar grupos."})
+		return
+	}
+	c.JSON(http.StatusOK, groups)
+}
+
+// AdminGetGroup (rota de administrador) mostra um grupo com seus membros diretos e subgrupos
+func (s *userServiceImpl) AdminGetGroup(c *gin.Context) {
+	group := s.targetGroup(c, "id")
+	if group == nil {
+		return
+	}
+
+	users, err := s.repo.GetGroupUsers(group.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao listar membros do grupo."})
+		return
+	}
+	subgroups, err := s.repo.GetSubgroups(group.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao listar subgrupos."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"group": group, "users": users, "groups": subgroups})
+}
+
+// AdminCreateGroup (rota de administrador) cria um grupo
+func (s *userServiceImpl) AdminCreateGroup(c *gin.Context) {
+	var req CreateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	name := strings.ToLower(strings.TrimSpace(req.Name))
+	if _, err := s.repo.GetGroupByName(name); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"message": "Já existe um grupo com este nome."})
+		return
+	} else if err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar grupo existente."})
+		return
+	}
+
+	if len(req.RoleIDs) > 0 && !s.canGrantRoles(c) {
+		return
+	}
+	roles, ok := s.resolveRoles(c, req.RoleIDs)
+	if !ok {
+		return
+	}
+
+	group := &Group{Name: name, Description: req.Description, Roles: roles}
+	if err := s.repo.CreateGroup(group); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao criar grupo."})
+		return
+	}
+	c.JSON(http.StatusCreated, group)
+}
+
+// AdminUpdateGroup (rota de administrador) altera a descrição e/ou os papéis de um grupo
+func (s *userServiceImpl) AdminUpdateGroup(c *gin.Context) {
+	var req UpdateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	group := s.targetGroup(c, "id")
+	if group == nil {
+		return
+	}
+
+	roles := group.Roles
+	if req.RoleIDs != nil {
+		if addsRoles(group.Roles, req.RoleIDs) && !s.canGrantRoles(c) {
+			return
+		}
+		var ok bool
+		if roles, ok = s.resolveRoles(c, req.RoleIDs); !ok {
+			return
+		}
+	}
+	if req.Description != nil {
+		group.Description = *req.Description
+	}
+
+	if err := s.repo.UpdateGroup(group, roles); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atualizar grupo."})
+		return
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+// AdminDeleteGroup (rota de administrador) remove um grupo; seus membros perdem os papéis dele
+func (s *userServiceImpl) AdminDeleteGroup(c *gin.Context) {
+	group := s.targetGroup(c, "id")
+	if group == nil {
+		return
+	}
+
+	if err := s.repo.DeleteGroup(group.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao remover grupo."})
+		return
+	}
+	effectiveGroupsCache.invalidate()
+	c.JSON(http.StatusOK, gin.H{"message": "Grupo removido com sucesso!"})
+}
+
+// AdminAddGroupUser (rota de administrador) coloca um usuário diretamente no grupo
+func (s *userServiceImpl) AdminAddGroupUser(c *gin.Context) {
+	group := s.targetGroup(c, "id")
+	if group == nil {
+		return
+	}
+	user := s.groupTargetUser(c)
+	if user == nil {
+		return
+	}
+	if !s.canJoinGroup(c, group.ID) {
+		return
+	}
+
+	added, err := s.repo.AddGroupUser(group.ID, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao adicionar usuário ao grupo."})
+		return
+	}
+	if !added {
+		c.JSON(http.StatusOK, gin.H{"message": "O usuário já está no grupo."})
+		return
+	}
+
+	effectiveGroupsCache.invalidate()
+	s.audit(c, user.ID, AuditGroupJoined, map[string]interface{}{"group": group.Name})
+	c.JSON(http.StatusOK, gin.H{"message": "Usuário adicionado ao grupo com sucesso!"})
+}
+
+// AdminRemoveGroupUser (rota de administrador) retira um usuário do grupo
+func (s *userServiceImpl) AdminRemoveGroupUser(c *gin.Context) {
+	group := s.targetGroup(c, "id")
+	if group == nil {
+		return
+	}
+	user := s.groupTargetUser(c)
+	if user == nil {
+		return
+	}
+
+	removed, err := s.repo.RemoveGroupUser(group.ID, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao retirar usuário do grupo."})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"message": "O usuário não está diretamente neste grupo."})
+		return
+	}
+
+	effectiveGroupsCache.invalidate()
+	s.audit(c, user.ID, AuditGroupLeft, map[string]interface{}{"group": group.Name})
+	c.JSON(http.StatusOK, gin.H{"message": "Usuário retirado do grupo com sucesso!"})
+}
+
+// AdminAddSubgroup (rota de administrador) coloca um grupo dentro de outro, recusando ciclos
+func (s *userServiceImpl) AdminAddSubgroup(c *gin.Context) {
+	parent := s.targetGroup(c, "id")
+	if parent == nil {
+		return
+	}
+	child := s.targetGroup(c, "childId")
+	if child == nil {
+		return
+	}
+
+	if !s.canJoinGroup(c, parent.ID) {
+		return
+	}
+
+	added, err := s.repo.AddSubgroup(parent.ID, child.ID)
+	if err == errGroupCycle {
+		c.JSON(http.StatusConflict, gin.H{"message": "Um grupo não pode conter a si mesmo, direta ou indiretamente."})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao adicionar subgrupo."})
+		return
+	}
+	if !added {
+		c.JSON(http.StatusOK, gin.H{"message": "O grupo já está contido neste grupo."})
+		return
+	}
+
+	effectiveGroupsCache.invalidate()
+	c.JSON(http.StatusOK, gin.H{"message": "Subgrupo adicionado com sucesso!"})
+}
+
+// AdminRemoveSubgroup (rota de administrador) retira um grupo de dentro de outro
+func (s *userServiceImpl) AdminRemoveSubgroup(c *gin.Context) {
+	parentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de grupo inválido."})
+		return
+	}
+	childID, err := strconv.ParseUint(c.Param("childId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de grupo inválido."})
+		return
+	}
+
+	removed, err := s.repo.RemoveSubgroup(uint(parentID), uint(childID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao retirar subgrupo."})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"message": "O grupo não está contido neste grupo."})
+		return
+	}
+
+	effectiveGroupsCache.invalidate()
+	c.JSON(http.StatusOK, gin.H{"message": "Subgrupo retirado com sucesso!"})
+}
+
+// AdminListUserGroups (rota de administrador) lista os grupos efetivos de um usuário
+func (s *userServiceImpl) AdminListUserGroups(c *gin.Context) {
+	user := s.adminTargetUser(c)
+	if user == nil {
+		return
+	}
+
+	groups, err := EffectiveGroups(s.repo, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao listar grupos do usuário."})
+		return
+	}
+	c.JSON(http.StatusOK, groups)
+}
+
+// targetGroup carrega o grupo do parâmetro de rota param; responde e retorna nil se não houver
+func (s *userServiceImpl) targetGroup(c *gin.Context, param string) *Group {
+	id, err := strconv.ParseUint(c.Param(param), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de grupo inválido."})
+		return nil
+	}
+
+	group, err := s.repo.GetGroupByID(uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Grupo não encontrado."})
+			return nil
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar grupo."})
+		return nil
+	}
+	return group
+}
+
+// groupTargetUser carrega o usuário do parâmetro :userId; responde e retorna nil se não houver
+func (s *userServiceImpl) groupTargetUser(c *gin.Context) *User {
+	id, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de usuário inválido."})
+		return nil
+	}
+
+	user, err := s.repo.GetUserByID(uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado."})
+			return nil
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuário."})
+		return nil
+	}
+	return user
+}
+
+// canGrantRoles responde 403 e retorna false se o usuário logado não tem roles:manage.
+// Quem tem apenas groups:manage organiza os grupos, mas não decide quem recebe papéis por meio deles.
+func (s *userServiceImpl) canGrantRoles(c *gin.Context) bool {
+	if HasPermission(c, PermRolesManage) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"message": "Conceder papéis por meio de grupos exige a permissão " + PermRolesManage + "."})
+	return false
+}
+
+// canJoinGroup verifica se o usuário logado pode colocar membros (usuários ou subgrupos) no grupo:
+// se o grupo concede papéis, dele ou dos grupos que o contêm, é preciso roles:manage
+func (s *userServiceImpl) canJoinGroup(c *gin.Context, groupID uint) bool {
+	if HasPermission(c, PermRolesManage) {
+		return true
+	}
+	ids, err := closure([]uint{groupID}, s.repo.GetParentGroupIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar grupos."})
+		return false
+	}
+	roles, err := s.repo.GetGroupRoles(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar papéis do grupo."})
+		return false
+	}
+	if len(roles) == 0 {
+		return true
+	}
+	return s.canGrantRoles(c)
+}
+
+// addsRoles indica se ids contém algum papel que o grupo ainda não tem
+func addsRoles(current []Role, ids []uint) bool {
+	has := make(map[uint]bool, len(current))
+	for _, r := range current {
+		has[r.ID] = true
+	}
+	for _, id := range ids {
+		if !has[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveRoles busca os papéis pelos IDs; responde 400 se algum não existir
+func (s *userServiceImpl) resolveRoles(c *gin.Context, ids []uint) ([]Role, bool) {
+	roles, err := s.repo.GetRolesByIDs(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar papéis."})
+		return nil, false
+	}
+
+	found := make(map[uint]bool, len(roles))
+	for _, r := range roles {
+		found[r.ID] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Papel desconhecido: " + strconv.FormatUint(uint64(id), 10)})
+			return nil, false
+		}
+	}
+	return roles, true
+}
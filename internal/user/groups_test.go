@@ -0,0 +1,145 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newGroupTestServer monta as rotas de grupos para um usuário logado com as permissões informadas
+func newGroupTestServer(s *userServiceImpl, userID uint, permissions ...string) *gin.Engine {
+	granted := make(map[string]struct{}, len(permissions))
+	for _, p := range permissions {
+		granted[p] = struct{}{}
+	}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("userID", userID)
+		c.Set(permissionsKey, granted)
+	})
+	r.POST("/groups", s.AdminCreateGroup)
+	r.PUT("/groups/:id", s.AdminUpdateGroup)
+	r.POST("/groups/:id/users/:userId", s.AdminAddGroupUser)
+	r.POST("/groups/:id/groups/:childId", s.AdminAddSubgroup)
+	return r
+}
+
+func TestGroupsManageCannotGrantRoles(t *testing.T) {
+	_, s := newTestService(t)
+	role := adminRole(t, s)
+	manager := createTestUser(t, s.repo, "manager")
+	r := newGroupTestServer(s, manager.ID, PermGroupsManage)
+
+	if code, _ := doJSON(t, r, "POST", "/groups", CreateGroupRequest{Name: "admins", RoleIDs: []uint{role.ID}}); code != http.StatusForbidden {
+		t.Errorf("criar grupo com papel: esperado 403, obtido %d", code)
+	}
+
+	code, body := doJSON(t, r, "POST", "/groups", CreateGroupRequest{Name: "plain"})
+	if code != http.StatusCreated {
+		t.Fatalf("criar grupo sem papel: %d %v", code, body)
+	}
+	plainID := uint(body["id"].(float64))
+	if code, _ := doJSON(t, r, "PUT", fmt.Sprintf("/groups/%d", plainID), UpdateGroupRequest{RoleIDs: []uint{role.ID}}); code != http.StatusForbidden {
+		t.Errorf("dar papel ao grupo: esperado 403, obtido %d", code)
+	}
+
+	// Grupo que concede admin, criado por quem tem roles:manage
+	admins := &Group{Name: "admins", Roles: []Role{*role}}
+	if err := s.repo.CreateGroup(admins); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := doJSON(t, r, "POST", fmt.Sprintf("/groups/%d/users/%d", admins.ID, manager.ID), nil); code != http.StatusForbidden {
+		t.Errorf("entrar no grupo admin: esperado 403, obtido %d", code)
+	}
+	if code, _ := doJSON(t, r, "POST", fmt.Sprintf("/groups/%d/groups/%d", admins.ID, plainID), nil); code != http.StatusForbidden {
+		t.Errorf("subgrupo no grupo admin: esperado 403, obtido %d", code)
+	}
+	if code, body := doJSON(t, r, "POST", fmt.Sprintf("/groups/%d/users/%d", plainID, manager.ID), nil); code != http.StatusOK {
+		t.Errorf("entrar em grupo sem papéis: %d %v", code, body)
+	}
+
+	full := newGroupTestServer(s, manager.ID, PermGroupsManage, PermRolesManage)
+	if code, body := doJSON(t, full, "PUT", fmt.Sprintf("/groups/%d", plainID), UpdateGroupRequest{RoleIDs: []uint{role.ID}}); code != http.StatusOK {
+		t.Errorf("dar papel ao grupo com roles:manage: %d %v", code, body)
+	}
+}
+
+func TestMembershipCacheBounded(t *testing.T) {
+	t.Setenv("GROUP_CACHE_TTL", "1m")
+	cache := &membershipCache{entries: make(map[uint]membershipCacheEntry)}
+
+	cache.entries[1] = membershipCacheEntry{expiresAt: time.Now().Add(-time.Second)}
+	if _, ok := cache.get(1); ok {
+		t.Error("entrada vencida devolvida")
+	}
+	if _, ok := cache.entries[1]; ok {
+		t.Error("entrada vencida mantida após a leitura")
+	}
+
+	for id := uint(1); id <= membershipCacheMaxEntries+10; id++ {
+		cache.set(id, nil, cache.currentGeneration())
+	}
+	if len(cache.entries) > membershipCacheMaxEntries {
+		t.Errorf("cache com %d entradas, limite %d", len(cache.entries), membershipCacheMaxEntries)
+	}
+}
+
+func TestMembershipCacheDropsResultComputedBeforeInvalidate(t *testing.T) {
+	t.Setenv("GROUP_CACHE_TTL", "1m")
+	cache := &membershipCache{entries: make(map[uint]membershipCacheEntry)}
+
+	// Resultado lido do banco antes de uma mudança de grupos que limpou o cache
+	generation := cache.currentGeneration()
+	cache.invalidate()
+	cache.set(1, []Group{{Name: "antigo"}}, generation)
+	if _, ok := cache.get(1); ok {
+		t.Error("resultado anterior à limpeza voltou para o cache")
+	}
+
+	cache.set(1, []Group{{Name: "atual"}}, cache.currentGeneration())
+	if groups, ok := cache.get(1); !ok || groups[0].Name != "atual" {
+		t.Error("resultado calculado depois da limpeza não foi guardado")
+	}
+}
+
+// reverseSubgroupRepository inclui o subgrupo inverso logo antes da inclusão pedida, simulando
+// uma inclusão concorrente que fecharia um ciclo com ela
+type reverseSubgroupRepository struct {
+	UserRepository
+	t *testing.T
+}
+
+func (r reverseSubgroupRepository) AddSubgroup(parentID, childID uint) (bool, error) {
+	if _, err := r.UserRepository.AddSubgroup(childID, parentID); err != nil {
+		r.t.Fatal(err)
+	}
+	return r.UserRepository.AddSubgroup(parentID, childID)
+}
+
+func TestAddSubgroupRefusesConcurrentCycle(t *testing.T) {
+	_, s := newTestService(t)
+	manager := createTestUser(t, s.repo, "manager")
+	a := &Group{Name: "a"}
+	b := &Group{Name: "b"}
+	for _, g := range []*Group{a, b} {
+		if err := s.repo.CreateGroup(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo := s.repo
+	s.repo = reverseSubgroupRepository{UserRepository: repo, t: t}
+	r := newGroupTestServer(s, manager.ID, PermGroupsManage)
+
+	if code, _ := doJSON(t, r, "POST", fmt.Sprintf("/groups/%d/groups/%d", a.ID, b.ID), nil); code != http.StatusConflict {
+		t.Errorf("subgrupo que fecha ciclo: esperado 409, obtido %d", code)
+	}
+	if cycle, err := createsCycle(repo, a.ID, b.ID); err != nil || !cycle {
+		t.Fatalf("inclusão concorrente ausente: %v", err)
+	}
+	if parents, err := repo.GetParentGroupIDs([]uint{b.ID}); err != nil || len(parents) != 0 {
+		t.Errorf("ciclo gravado: b contido em %v (%v)", parents, err)
+	}
+}
@@ -0,0 +1,88 @@
+package user
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestRepository cria um repositório sobre um SQLite em memória com todas as tabelas
+func newTestRepository(t *testing.T) (*gorm.DB, UserRepository) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1) // Cada conexão teria o seu próprio banco em memória
+	t.Cleanup(func() { sqlDB.Close() })
+
+	err = db.AutoMigrate(
+		&User{}, &RecoveryCode{}, &WebAuthnCredential{}, &WebAuthnSession{}, &OneTimeToken{},
+		&TrustedDevice{}, &Invitation{}, &AuditEvent{}, &DataExport{}, &ErasureReceipt{},
+		&LegalDocument{}, &LegalAcceptance{}, &Permission{}, &Role{}, &UserRole{},
+		&Organization{}, &Membership{}, &Group{}, &GroupUser{}, &GroupSubgroup{}, &RelationTuple{}, &DataMigration{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, NewUserRepository(db)
+}
+
+// newTestService cria o serviço sobre um repositório de teste, sem email nem SMS
+func newTestService(t *testing.T) (*gorm.DB, *userServiceImpl) {
+	t.Helper()
+	db, repo := newTestRepository(t)
+	return db, &userServiceImpl{repo: repo, validate: validator.New()}
+}
+
+// createTestUser grava um usuário ativo com email confirmado
+func createTestUser(t *testing.T, repo UserRepository, username string) *User {
+	t.Helper()
+	now := time.Now()
+	user := &User{Username: username, Email: username + "@example.com", Password: "-", Status: StatusActive, EmailVerifiedAt: &now}
+	if err := repo.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// doJSON envia uma requisição JSON ao engine e decodifica a resposta
+func doJSON(t *testing.T, r http.Handler, method, path string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	var payload string
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload = string(data)
+	}
+	req := httptest.NewRequest(method, path, strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	var out map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &out)
+	return rec.Code, out
+}
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Setenv("JWT_SECRET", "segredo-dos-testes")
+	os.Exit(m.Run())
+}
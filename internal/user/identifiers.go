@@ -0,0 +1,101 @@
+package user
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"api_authentication/internal/identifier"
+)
+
+// identifierBackfillBatch é o tamanho do lote da normalização de contas antigas
+const identifierBackfillBatch = 500
+
+// normalizeIdentifiers normaliza no lugar o nome de usuário e o email informados (nil é ignorado).
+// Responde e retorna false quando algum deles não pode ser normalizado.
+func (s *userServiceImpl) normalizeIdentifiers(c *gin.Context, username, email *string) bool {
+	if username != nil {
+		normalized, err := identifier.NormalizeUsername(*username)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Nome de usuário inválido: use letras, números e símbolos, sem espaços."})
+			return false
+		}
+		*username = normalized
+	}
+	if email != nil {
+		normalized, err := identifier.NormalizeEmail(*email)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Email inválido."})
+			return false
+		}
+		*email = normalized
+	}
+	return true
+}
+
+// checkUsername recusa nomes reservados e nomes confundíveis com o de outra conta
+// (mesmo esqueleto). Responde e retorna false quando o nome não pode ser usado.
+func (s *userServiceImpl) checkUsername(c *gin.Context, username string, exceptID uint) bool {
+	if s.reservedNames.Contains(username) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Este nome de usuário é reservado."})
+		return false
+	}
+
+	taken, err := s.repo.IsUsernameSkeletonReserved(identifier.Skeleton(username), exceptID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar nome de usuário."})
+		return false
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"message": "Este nome de usuário é parecido demais com o de outra conta."})
+		return false
+	}
+	return true
+}
+
+// BackfillNormalizedIdentifiers normaliza o nome de usuário e o email das contas criadas antes
+// da normalização e grava o esqueleto do nome. Quando a forma normalizada já pertence a outra
+// conta (ex.: "Admin" e "admin"), o valor antigo é mantido e o conflito é registrado no log; as
+// buscas por identificador também aceitam o valor exato, então a conta continua acessível.
+// Roda uma única vez, como migração de dados (ver migrations.go), antes de BackfillCanonicalEmails, que recalcula o email canônico dos emails alterados.
+func BackfillNormalizedIdentifiers(repo UserRepository) (int, error) {
+	filled := 0
+	for {
+		users, err := repo.GetUsersWithoutUsernameSkeleton(identifierBackfillBatch)
+		if err != nil {
+			return filled, err
+		}
+		for _, u := range users {
+			username := u.Username
+			if normalized, err := identifier.NormalizeUsername(u.Username); err != nil {
+				log.Printf("Nome de usuário do userID %d não pôde ser normalizado; mantido como está", u.ID)
+			} else if taken, err := repo.IsUsernameReserved(normalized, u.ID); err != nil {
+				return filled, err
+			} else if taken {
+				log.Printf("Nome de usuário normalizado do userID %d já pertence a outra conta; mantido como está", u.ID)
+			} else {
+				username = normalized
+			}
+
+			email := u.Email
+			if normalized, err := identifier.NormalizeEmail(u.Email); err != nil {
+				log.Printf("Email do userID %d não pôde ser normalizado; mantido como está", u.ID)
+			} else if taken, err := repo.IsEmailReserved(normalized, u.ID); err != nil {
+				return filled, err
+			} else if taken {
+				log.Printf("Email normalizado do userID %d já pertence a outra conta; mantido como está", u.ID)
+			} else {
+				email = normalized
+			}
+
+			if err := repo.SetNormalizedIdentifiers(u.ID, username, email, identifier.Skeleton(username)); err != nil {
+				return filled, err
+			}
+			filled++
+		}
+		if len(users) < identifierBackfillBatch {
+			return filled, nil
+		}
+	}
+}
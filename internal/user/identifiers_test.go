@@ -0,0 +1,48 @@
+package user
+
+import "testing"
+
+func TestLegacyCollidingAccountStaysReachable(t *testing.T) {
+	_, s := newTestService(t)
+	legacy := createTestUser(t, s.repo, "Admin") // Criada antes da normalização
+	current := createTestUser(t, s.repo, "admin")
+
+	if _, err := BackfillNormalizedIdentifiers(s.repo); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := s.repo.GetUserByID(legacy.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Username != "Admin" {
+		t.Fatalf("nome em conflito alterado para %q", stored.Username)
+	}
+
+	tests := []struct {
+		identifier string
+		want       uint
+	}{
+		{"Admin", legacy.ID},
+		{"admin", current.ID},
+		{"ADMIN", current.ID},
+		{"Admin@example.com", legacy.ID},
+		{"admin@example.com", current.ID},
+	}
+	for _, tt := range tests {
+		user, err := s.repo.GetUserByUsernameOrEmail(tt.identifier)
+		if err != nil {
+			t.Errorf("%q: %v", tt.identifier, err)
+			continue
+		}
+		if user.ID != tt.want {
+			t.Errorf("%q: encontrado userID %d, esperado %d", tt.identifier, user.ID, tt.want)
+		}
+	}
+
+	if user, err := s.repo.GetUserByUsername("Admin"); err != nil || user.ID != legacy.ID {
+		t.Errorf("GetUserByUsername(\"Admin\"): %v %v", user, err)
+	}
+	if user, err := s.repo.GetUserByEmail("Admin@example.com"); err != nil || user.ID != legacy.ID {
+		t.Errorf("GetUserByEmail(\"Admin@example.com\"): %v %v", user, err)
+	}
+}
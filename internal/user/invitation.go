@@ -0,0 +1,209 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api_authentication/configs"
+	"api_authentication/internal/auth"
+	"api_authentication/internal/mail"
+)
+
+// Modos de REGISTRATION_MODE
+const (
+	RegistrationOpen   = "open"   // Qualquer pessoa pode se cadastrar (padrão)
+	RegistrationInvite = "invite" // Cadastro exige um convite válido
+	RegistrationClosed = "closed" // Cadastro desativado
+)
+
+// errInvalidInvitation é o erro único para convite inexistente, esgotado, expirado,
+// revogado ou de outro email
+var errInvalidInvitation = errors.New("convite inválido ou expirado")
+
+// RegistrationMode retorna o modo configurado em REGISTRATION_MODE
+func RegistrationMode() string {
+	switch mode := configs.GetEnv("REGISTRATION_MODE", RegistrationOpen); mode {
+	case RegistrationInvite, RegistrationClosed:
+		return mode
+	default:
+		return RegistrationOpen
+	}
+}
+
+// findInvitation valida o código de convite para o email informado, sem consumi-lo
+func (s *userServiceImpl) findInvitation(code, email string) (*Invitation, error) {
+	invitation, err := s.repo.GetInvitationByCodeHash(auth.HashToken(auth.NormalizeRecoveryCode(code)))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errInvalidInvitation
+		}
+		return nil, err
+	}
+
+	if invitation.RevokedAt != nil ||
+		invitation.Uses >= invitation.MaxUses ||
+		(invitation.ExpiresAt != nil && !time.Now().Before(*invitation.ExpiresAt)) ||
+		(invitation.Email != "" && !strings.EqualFold(invitation.Email, email)) {
+		return nil, errInvalidInvitation
+	}
+	return invitation, nil
+}
+
+// CreateInvitation cria um convite. Administradores definem livremente usos e prazo;
+// os demais usuários criam convites de uso único com o prazo padrão.
+func (s *userServiceImpl) CreateInvitation(c *gin.Context) {
+	var req CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	if req.Email != "" && !s.normalizeIdentifiers(c, nil, &req.Email) {
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	s.createInvitation(c, user, req, HasPermission(c, PermInvitationsManage), nil, "")
+}
+
+// createInvitation gera, grava e envia um convite. Com canCustomize, usos e prazo do pedido são
+// respeitados; sem, o convite é de uso único com o prazo padrão. Convites com organização
+// também fazem o convidado entrar nela, com o papel orgRole.
+func (s *userServiceImpl) createInvitation(c *gin.Context, user *User, req CreateInvitationRequest, canCustomize bool, org *Organization, orgRole string) {
+	now := time.Now()
+	expiresAt := now.Add(configs.GetEnvDuration("INVITATION_TTL", 7*24*time.Hour))
+	maxUses := 1
+	if canCustomize {
+		if req.MaxUses > 0 {
+			maxUses = req.MaxUses
+		}
+		if req.ExpiresAt != nil {
+			expiresAt = *req.ExpiresAt
+		}
+	} else if req.MaxUses > 1 || req.ExpiresAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Apenas administradores podem definir usos e prazo do convite."})
+		return
+	}
+	if !expiresAt.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "O prazo do convite deve estar no futuro."})
+		return
+	}
+
+	code, err := auth.GenerateInviteCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar convite."})
+		return
+	}
+
+	invitation := &Invitation{
+		CodeHash:    auth.HashToken(auth.NormalizeRecoveryCode(code)),
+		Email:       req.Email,
+		MaxUses:     maxUses,
+		ExpiresAt:   &expiresAt,
+		CreatedByID: user.ID,
+	}
+	target := "criar uma conta"
+	if org != nil {
+		invitation.OrganizationID = &org.ID
+		invitation.OrgRole = orgRole
+		target = fmt.Sprintf("participar da organização %s (se já tiver conta, entre nela usando o código)", org.Name)
+	}
+	if err := s.repo.CreateInvitation(invitation); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao criar convite."})
+		return
+	}
+
+	if invitation.Email != "" {
+		link := configs.GetEnv("APP_URL", "http://localhost:5500") + "/register?invite=" + url.QueryEscape(code)
+		if err := s.mailer.Send(mail.Message{
+			To:      invitation.Email,
+			Subject: "Você foi convidado",
+			Body: fmt.Sprintf("Olá!\n\n%s convidou você para %s. Cadastre-se pelo link abaixo:\n%s\n\n"+
+				"Código do convite: %s\nO convite expira em %s.",
+				user.Username, target, link, code, expiresAt.Format(time.RFC1123)),
+		}); err != nil {
+			log.Printf("Erro ao enviar convite %d: %v", invitation.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusCreated, CreateInvitationResponse{Invitation: invitation, Code: code})
+}
+
+// ListInvitations lista os convites criados pelo usuário logado
+func (s *userServiceImpl) ListInvitations(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "ID do usuário não encontrado no contexto."})
+		return
+	}
+
+	s.respondInvitations(c, userID.(uint))
+}
+
+// RevokeInvitation revoga um convite criado pelo usuário logado
+func (s *userServiceImpl) RevokeInvitation(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "ID do usuário não encontrado no contexto."})
+		return
+	}
+
+	s.revokeInvitation(c, userID.(uint))
+}
+
+// AdminListInvitations (rota de administrador) lista todos os convites
+func (s *userServiceImpl) AdminListInvitations(c *gin.Context) {
+	s.respondInvitations(c, 0)
+}
+
+// AdminRevokeInvitation (rota de administrador) revoga qualquer convite
+func (s *userServiceImpl) AdminRevokeInvitation(c *gin.Context) {
+	s.revokeInvitation(c, 0)
+}
+
+func (s *userServiceImpl) respondInvitations(c *gin.Context, createdByID uint) {
+	invitations, err := s.repo.GetInvitations(createdByID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao listar convites."})
+		return
+	}
+	c.JSON(http.StatusOK, invitations)
+}
+
+func (s *userServiceImpl) revokeInvitation(c *gin.Context, createdByID uint) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de convite inválido."})
+		return
+	}
+
+	revoked, err := s.repo.RevokeInvitation(uint(id), createdByID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao revogar convite."})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Convite não encontrado."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Convite revogado com sucesso!"})
+}
@@ -0,0 +1,196 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"api_authentication/internal/auth"
+	"api_authentication/internal/emailpolicy"
+	"api_authentication/internal/identifier"
+)
+
+// newRegisterTestServer prepara o serviço para o cadastro e monta as rotas de convite
+func newRegisterTestServer(t *testing.T, s *userServiceImpl) *gin.Engine {
+	t.Helper()
+	policy, err := emailpolicy.NewPolicyFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reserved, err := identifier.NewReservedNamesFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.emailPolicy = policy
+	s.reservedNames = reserved
+	s.mailer = &recordingMailer{}
+
+	r := gin.New()
+	r.POST("/register", s.Register)
+	return r
+}
+
+// createTestInvitation grava um convite com o código retornado
+func createTestInvitation(t *testing.T, repo UserRepository, invitation *Invitation) string {
+	t.Helper()
+	code, err := auth.GenerateInviteCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	invitation.CodeHash = auth.HashToken(auth.NormalizeRecoveryCode(code))
+	if invitation.MaxUses == 0 {
+		invitation.MaxUses = 1
+	}
+	if err := repo.CreateInvitation(invitation); err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// invitationUses retorna quantos usos do convite já foram consumidos
+func invitationUses(t *testing.T, repo UserRepository, invitation *Invitation) int {
+	t.Helper()
+	stored, err := repo.GetInvitationByCodeHash(invitation.CodeHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored.Uses
+}
+
+func registerRequest(username, code string) RegisterRequest {
+	return RegisterRequest{Username: username, Email: username + "@example.com", Password: "senha123", InviteCode: code}
+}
+
+func TestRegisterConsumesInvitation(t *testing.T) {
+	t.Setenv("REGISTRATION_MODE", RegistrationInvite)
+	_, s := newTestService(t)
+	r := newRegisterTestServer(t, s)
+	inviter := createTestUser(t, s.repo, "inviter")
+	invitation := &Invitation{CreatedByID: inviter.ID}
+	code := createTestInvitation(t, s.repo, invitation)
+
+	if status, _ := doJSON(t, r, "POST", "/register", registerRequest("alice", "")); status != http.StatusForbidden {
+		t.Errorf("sem convite: esperado 403, obtido %d", status)
+	}
+	if status, body := doJSON(t, r, "POST", "/register", registerRequest("alice", code)); status != http.StatusCreated {
+		t.Fatalf("com convite: %d %v", status, body)
+	}
+	if uses := invitationUses(t, s.repo, invitation); uses != 1 {
+		t.Errorf("convite com %d uso(s), esperado 1", uses)
+	}
+	alice, err := s.repo.GetUserByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.InvitationID == nil || *alice.InvitationID != invitation.ID {
+		t.Errorf("cadastro sem o convite usado: %v", alice.InvitationID)
+	}
+
+	if status, _ := doJSON(t, r, "POST", "/register", registerRequest("bob", code)); status != http.StatusBadRequest {
+		t.Errorf("convite esgotado: esperado 400, obtido %d", status)
+	}
+}
+
+func TestRegisterRefusesInvalidInvitations(t *testing.T) {
+	_, s := newTestService(t)
+	r := newRegisterTestServer(t, s)
+	inviter := createTestUser(t, s.repo, "inviter")
+	past := time.Now().Add(-time.Hour)
+
+	for name, invitation := range map[string]*Invitation{
+		"de outro email": {CreatedByID: inviter.ID, Email: "outra@example.com"},
+		"expirado":       {CreatedByID: inviter.ID, ExpiresAt: &past},
+		"revogado":       {CreatedByID: inviter.ID, RevokedAt: &past},
+	} {
+		code := createTestInvitation(t, s.repo, invitation)
+		if status, _ := doJSON(t, r, "POST", "/register", registerRequest("alice", code)); status != http.StatusBadRequest {
+			t.Errorf("convite %s: esperado 400, obtido %d", name, status)
+		}
+		if uses := invitationUses(t, s.repo, invitation); uses != 0 {
+			t.Errorf("convite %s consumido: %d uso(s)", name, uses)
+		}
+	}
+	if status, _ := doJSON(t, r, "POST", "/register", registerRequest("alice", "aaaaa-bbbbb-ccccc-ddddd")); status != http.StatusBadRequest {
+		t.Errorf("convite inexistente: esperado 400, obtido %d", status)
+	}
+}
+
+// failingCreateUserRepository falha ao gravar o usuário, depois de o convite ter sido consumido
+type failingCreateUserRepository struct {
+	UserRepository
+}
+
+func (r failingCreateUserRepository) CreateUser(*User) error {
+	return errors.New("banco indisponível")
+}
+
+func TestRegisterReleasesInvitationWhenCreateFails(t *testing.T) {
+	_, s := newTestService(t)
+	r := newRegisterTestServer(t, s)
+	inviter := createTestUser(t, s.repo, "inviter")
+	invitation := &Invitation{CreatedByID: inviter.ID}
+	code := createTestInvitation(t, s.repo, invitation)
+	repo := s.repo
+	s.repo = failingCreateUserRepository{UserRepository: repo}
+
+	if status, _ := doJSON(t, r, "POST", "/register", registerRequest("alice", code)); status != http.StatusInternalServerError {
+		t.Fatalf("falha ao gravar: esperado 500, obtido %d", status)
+	}
+	if uses := invitationUses(t, repo, invitation); uses != 0 {
+		t.Errorf("uso do convite não devolvido: %d uso(s)", uses)
+	}
+
+	s.repo = repo
+	if status, body := doJSON(t, r, "POST", "/register", registerRequest("alice", code)); status != http.StatusCreated {
+		t.Errorf("convite devolvido: esperado 201, obtido %d %v", status, body)
+	}
+}
+
+// concurrentJoinRepository faz o usuário entrar na organização pouco antes da gravação do
+// vínculo, simulando dois pedidos de entrada simultâneos
+type concurrentJoinRepository struct {
+	UserRepository
+	t *testing.T
+}
+
+func (r concurrentJoinRepository) AddMembership(membership *Membership) (bool, error) {
+	if _, err := r.UserRepository.AddMembership(&Membership{OrganizationID: membership.OrganizationID, UserID: membership.UserID, Role: membership.Role}); err != nil {
+		r.t.Fatal(err)
+	}
+	return r.UserRepository.AddMembership(membership)
+}
+
+func TestJoinOrganizationReleasesInvitationWhenAlreadyMember(t *testing.T) {
+	_, s := newTestService(t)
+	owner := createTestUser(t, s.repo, "owner")
+	alice := createTestUser(t, s.repo, "alice")
+	org := &Organization{Name: "Acme", Slug: "acme"}
+	if err := s.repo.CreateOrganization(org, owner.ID); err != nil {
+		t.Fatal(err)
+	}
+	invitation := &Invitation{CreatedByID: owner.ID, MaxUses: 5, OrganizationID: &org.ID, OrgRole: OrgRoleMember}
+	code := createTestInvitation(t, s.repo, invitation)
+	repo := s.repo
+	s.repo = concurrentJoinRepository{UserRepository: repo, t: t}
+
+	r := gin.New()
+	r.POST("/organizations/join", func(c *gin.Context) { c.Set("userID", alice.ID) }, s.JoinOrganization)
+	if status, _ := doJSON(t, r, "POST", "/organizations/join", JoinOrganizationRequest{Code: code}); status != http.StatusConflict {
+		t.Fatalf("entrada simultânea: esperado 409, obtido %d", status)
+	}
+	if uses := invitationUses(t, repo, invitation); uses != 0 {
+		t.Errorf("uso do convite não devolvido: %d uso(s)", uses)
+	}
+
+	// Já membro: recusado antes de consumir o convite
+	s.repo = repo
+	if status, _ := doJSON(t, r, "POST", "/organizations/join", JoinOrganizationRequest{Code: code}); status != http.StatusConflict {
+		t.Errorf("já membro: esperado 409, obtido %d", status)
+	}
+	if uses := invitationUses(t, repo, invitation); uses != 0 {
+		t.Errorf("convite consumido por quem já era membro: %d uso(s)", uses)
+	}
+}
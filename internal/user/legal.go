@@ -0,0 +1,207 @@
+package user
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tipos de documento legal (LegalDocument.Kind)
+const (
+	LegalTerms   = "terms"
+	LegalPrivacy = "privacy"
+)
+
+// CurrentLegalDocuments retorna a versão em vigor de cada tipo de documento legal
+func CurrentLegalDocuments(repo UserRepository, now time.Time) ([]LegalDocument, error) {
+	documents, err := repo.GetEffectiveLegalDocuments(now)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make([]LegalDocument, 0, 2)
+	seen := make(map[string]bool)
+	for _, d := range documents { // Ordenados do mais recente ao mais antigo
+		if !seen[d.Kind] {
+			seen[d.Kind] = true
+			current = append(current, d)
+		}
+	}
+	return current, nil
+}
+
+// PendingLegalDocuments retorna as versões em vigor que o usuário ainda não aceitou
+func PendingLegalDocuments(repo UserRepository, userID uint) ([]LegalDocument, error) {
+	current, err := CurrentLegalDocuments(repo, time.Now())
+	if err != nil || len(current) == 0 {
+		return nil, err
+	}
+
+	accepted, err := repo.GetAcceptedDocumentIDs(userID, documentIDs(current))
+	if err != nil {
+		return nil, err
+	}
+
+	return missingDocuments(current, accepted), nil
+}
+
+// missingDocuments retorna os documentos cujo ID não está em accepted
+func missingDocuments(documents []LegalDocument, accepted []uint) []LegalDocument {
+	acceptedSet := make(map[uint]bool, len(accepted))
+	for _, id := range accepted {
+		acceptedSet[id] = true
+	}
+
+	missing := make([]LegalDocument, 0)
+	for _, d := range documents {
+		if !acceptedSet[d.ID] {
+			missing = append(missing, d)
+		}
+	}
+	return missing
+}
+
+// recordLegalAcceptances registra o aceite dos documentos com o IP e o navegador da requisição
+func (s *userServiceImpl) recordLegalAcceptances(c *gin.Context, userID uint, documents []LegalDocument) error {
+	if len(documents) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	acceptances := make([]LegalAcceptance, len(documents))
+	for i, d := range documents {
+		acceptances[i] = LegalAcceptance{
+			UserID:     userID,
+			DocumentID: d.ID,
+			IPAddress:  c.ClientIP(),
+			UserAgent:  c.Request.UserAgent(),
+			AcceptedAt: now,
+		}
+	}
+	return s.repo.CreateLegalAcceptances(acceptances)
+}
+
+// ListCurrentLegalDocuments (pública) lista as versões em vigor, para exibição no cadastro
+func (s *userServiceImpl) ListCurrentLegalDocuments(c *gin.Context) {
+	current, err := CurrentLegalDocuments(s.repo, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar documentos legais."})
+		return
+	}
+	c.JSON(http.StatusOK, current)
+}
+
+// GetPendingLegalDocuments lista as versões em vigor que o usuário logado ainda precisa aceitar
+func (s *userServiceImpl) GetPendingLegalDocuments(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "ID do usuário não encontrado no contexto."})
+		return
+	}
+
+	pending, err := PendingLegalDocuments(s.repo, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar documentos legais."})
+		return
+	}
+	c.JSON(http.StatusOK, pending)
+}
+
+// AcceptLegalDocuments registra o aceite, pelo usuário logado, de versões em vigor
+func (s *userServiceImpl) AcceptLegalDocuments(c *gin.Context) {
+	var req AcceptLegalDocumentsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "ID do usuário não encontrado no contexto."})
+		return
+	}
+
+	current, err := CurrentLegalDocuments(s.repo, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar documentos legais."})
+		return
+	}
+
+	// Só versões em vigor podem ser aceitas: aceitar uma versão antiga ou futura não tem efeito
+	currentByID := make(map[uint]LegalDocument, len(current))
+	for _, d := range current {
+		currentByID[d.ID] = d
+	}
+	accepted := make([]LegalDocument, 0, len(req.DocumentIDs))
+	for _, id := range req.DocumentIDs {
+		d, ok := currentByID[id]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Apenas as versões em vigor dos documentos podem ser aceitas.", "documents": current})
+			return
+		}
+		accepted = append(accepted, d)
+	}
+	if err := s.recordLegalAcceptances(c, userID.(uint), accepted); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao registrar aceite."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Aceite registrado com sucesso!"})
+}
+
+// AdminCreateLegalDocument (rota de administrador) publica uma nova versão de documento legal
+func (s *userServiceImpl) AdminCreateLegalDocument(c *gin.Context) {
+	var req CreateLegalDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	effectiveAt := time.Now()
+	if req.EffectiveAt != nil {
+		effectiveAt = *req.EffectiveAt
+	}
+
+	document := &LegalDocument{
+		Kind:        req.Kind,
+		Version:     req.Version,
+		Title:       req.Title,
+		URL:         req.URL,
+		EffectiveAt: effectiveAt,
+	}
+	if err := s.repo.CreateLegalDocument(document); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"message": "Erro ao publicar documento: verifique se a versão já existe."})
+		return
+	}
+
+	c.JSON(http.StatusCreated, document)
+}
+
+// AdminListLegalDocuments (rota de administrador) lista todas as versões publicadas
+func (s *userServiceImpl) AdminListLegalDocuments(c *gin.Context) {
+	documents, err := s.repo.GetLegalDocuments()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar documentos legais."})
+		return
+	}
+	c.JSON(http.StatusOK, documents)
+}
+
+func documentIDs(documents []LegalDocument) []uint {
+	ids := make([]uint, len(documents))
+	for i, d := range documents {
+		ids[i] = d.ID
+	}
+	return ids
+}
@@ -0,0 +1,195 @@
+package user
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Padrões da listagem de usuários
+const (
+	defaultUserListLimit = 50
+	defaultUserListSort  = "-created_at"
+)
+
+var errInvalidCursor = errors.New("cursor inválido")
+
+// UserListFilter são os critérios da listagem de usuários; campos vazios não filtram
+type UserListFilter struct {
+	Statuses     []string
+	CreatedFrom  *time.Time
+	CreatedTo    *time.Time
+	Verified     *bool
+	RoleID       *uint
+	RoleGroupIDs []uint // Grupos cujos membros herdam o papel RoleID
+	Search       string
+}
+
+// UserListPage é a posição e a ordem de uma página da listagem de usuários
+type UserListPage struct {
+	Sort  string // Coluna de ordenação; o ID desempata
+	Desc  bool
+	After *userCursor // Último usuário da página anterior
+	Limit int
+}
+
+// userCursor identifica o último usuário de uma página: o valor da coluna de ordenação e o ID.
+// Vai ao cliente em base64 como next_cursor e só vale para a mesma ordenação.
+type userCursor struct {
+	Sort  string      `json:"s"`
+	Value interface{} `json:"v,omitempty"`
+	ID    uint        `json:"id"`
+}
+
+// ListUsers (rota de administrador) lista os usuários com filtros, busca, ordenação e paginação por cursor
+func (s *userServiceImpl) ListUsers(c *gin.Context) {
+	var req ListUsersRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Parâmetros de consulta inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Parâmetros de consulta ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	filter, ok := s.userListFilter(c, req)
+	if !ok {
+		return
+	}
+
+	if req.Sort == "" {
+		req.Sort = defaultUserListSort
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultUserListLimit
+	}
+	page := UserListPage{Sort: strings.TrimPrefix(req.Sort, "-"), Desc: strings.HasPrefix(req.Sort, "-"), Limit: req.Limit + 1}
+	if req.Cursor != "" {
+		after, err := decodeUserCursor(req.Cursor, req.Sort)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Cursor inválido ou de outra ordenação."})
+			return
+		}
+		page.After = after
+	}
+
+	users, err := s.repo.ListUsers(filter, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao listar usuários."})
+		return
+	}
+	total, err := s.repo.CountUsers(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao contar usuários."})
+		return
+	}
+
+	response := UserListResponse{Users: users, TotalEstimate: total}
+	if len(users) > req.Limit {
+		response.Users = users[:req.Limit]
+		next := encodeUserCursor(&response.Users[req.Limit-1], req.Sort)
+		response.NextCursor = &next
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// userListFilter converte os parâmetros de consulta no filtro do repositório; responde e
+// retorna false quando algum deles é inválido
+func (s *userServiceImpl) userListFilter(c *gin.Context, req ListUsersRequest) (UserListFilter, bool) {
+	filter := UserListFilter{
+		CreatedFrom: req.CreatedFrom,
+		CreatedTo:   req.CreatedTo,
+		Verified:    req.Verified,
+		Search:      strings.TrimSpace(req.Q),
+	}
+
+	if req.Status != "" {
+		for _, status := range strings.Split(req.Status, ",") {
+			status = strings.TrimSpace(status)
+			if _, known := statusTransitions[status]; !known {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "Estado de conta desconhecido: " + status})
+				return filter, false
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	if req.Role != "" {
+		role, err := s.repo.GetRoleByName(strings.ToLower(strings.TrimSpace(req.Role)))
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "Papel desconhecido: " + req.Role})
+				return filter, false
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar papel."})
+			return filter, false
+		}
+
+		// Quem está num subgrupo herda os papéis dos grupos que o contêm
+		groupIDs, err := s.repo.GetGroupIDsWithRole(role.ID)
+		if err == nil {
+			groupIDs, err = closure(groupIDs, s.repo.GetChildGroupIDs)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar grupos do papel."})
+			return filter, false
+		}
+		filter.RoleID = &role.ID
+		filter.RoleGroupIDs = groupIDs
+	}
+	return filter, true
+}
+
+// encodeUserCursor gera o cursor que continua a listagem logo após o usuário
+func encodeUserCursor(user *User, sort string) string {
+	cursor := userCursor{Sort: sort, ID: user.ID}
+	switch strings.TrimPrefix(sort, "-") {
+	case "created_at":
+		cursor.Value = user.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case "username":
+		cursor.Value = user.Username
+	case "email":
+		cursor.Value = user.Email
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeUserCursor lê o cursor e confere se ele foi gerado para a mesma ordenação
+func decodeUserCursor(encoded, sort string) (*userCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	var cursor userCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	if cursor.Sort != sort {
+		return nil, errInvalidCursor
+	}
+
+	if strings.TrimPrefix(sort, "-") == "id" {
+		return &cursor, nil
+	}
+	value, ok := cursor.Value.(string)
+	if !ok {
+		return nil, errInvalidCursor
+	}
+	if strings.TrimPrefix(sort, "-") == "created_at" {
+		createdAt, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, err
+		}
+		cursor.Value = createdAt
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,112 @@
+package user
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUserCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2026, 3, 1, 12, 30, 45, 123456789, time.FixedZone("BRT", -3*60*60))
+	user := &User{ID: 42, Username: "maria", Email: "maria@example.com", CreatedAt: createdAt}
+
+	tests := []struct {
+		sort string
+		want interface{}
+	}{
+		{"id", nil},
+		{"-id", nil},
+		{"created_at", createdAt.UTC()},
+		{"-created_at", createdAt.UTC()},
+		{"username", "maria"},
+		{"-username", "maria"},
+		{"email", "maria@example.com"},
+		{"-email", "maria@example.com"},
+	}
+	for _, tt := range tests {
+		cursor, err := decodeUserCursor(encodeUserCursor(user, tt.sort), tt.sort)
+		if err != nil {
+			t.Errorf("%s: %v", tt.sort, err)
+			continue
+		}
+		if cursor.ID != user.ID || cursor.Sort != tt.sort {
+			t.Errorf("%s: cursor %+v", tt.sort, cursor)
+		}
+		if got, ok := cursor.Value.(time.Time); ok {
+			if !got.Equal(tt.want.(time.Time)) {
+				t.Errorf("%s: data %v, esperado %v", tt.sort, got, tt.want)
+			}
+		} else if cursor.Value != tt.want {
+			t.Errorf("%s: valor %v, esperado %v", tt.sort, cursor.Value, tt.want)
+		}
+	}
+}
+
+func TestDecodeUserCursorRejects(t *testing.T) {
+	user := &User{ID: 1, Username: "ana", CreatedAt: time.Now()}
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+
+	tests := []struct {
+		name, cursor, sort string
+	}{
+		{"outra ordenação", encodeUserCursor(user, "username"), "email"},
+		{"outra direção", encodeUserCursor(user, "username"), "-username"},
+		{"base64 inválido", "não é base64!", "id"},
+		{"json inválido", encode("{"), "id"},
+		{"sem valor", encode(`{"s":"username","id":1}`), "username"},
+		{"valor de outro tipo", encode(`{"s":"username","v":7,"id":1}`), "username"},
+		{"data inválida", encode(`{"s":"created_at","v":"ontem","id":1}`), "created_at"},
+	}
+	for _, tt := range tests {
+		if _, err := decodeUserCursor(tt.cursor, tt.sort); err == nil {
+			t.Errorf("%s: cursor aceito", tt.name)
+		}
+	}
+}
+
+func TestListUsersPaginatesWithoutGapsOrRepeats(t *testing.T) {
+	_, s := newTestService(t)
+	for _, name := range []string{"carol", "alice", "erin", "bob", "dave"} {
+		createTestUser(t, s.repo, name)
+	}
+	r := gin.New()
+	r.GET("/users", s.ListUsers)
+
+	for _, sort := range []string{"id", "-created_at", "username", "-email"} {
+		var seen []string
+		cursor := ""
+		for page := 0; page < 10; page++ {
+			query := url.Values{"sort": {sort}, "limit": {"2"}}
+			if cursor != "" {
+				query.Set("cursor", cursor)
+			}
+			code, body := doJSON(t, r, "GET", "/users?"+query.Encode(), nil)
+			if code != http.StatusOK {
+				t.Fatalf("%s: %d %v", sort, code, body)
+			}
+			for _, u := range body["users"].([]interface{}) {
+				seen = append(seen, u.(map[string]interface{})["username"].(string))
+			}
+			next, ok := body["next_cursor"].(string)
+			if !ok {
+				break
+			}
+			cursor = next
+		}
+
+		if len(seen) != 5 {
+			t.Errorf("%s: %d usuários listados: %v", sort, len(seen), seen)
+		}
+		if sort == "username" && fmt.Sprint(seen) != "[alice bob carol dave erin]" {
+			t.Errorf("username: ordem %v", seen)
+		}
+		if sort == "-email" && fmt.Sprint(seen) != "[erin dave carol bob alice]" {
+			t.Errorf("-email: ordem %v", seen)
+		}
+	}
+}
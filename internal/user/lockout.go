@@ -0,0 +1,128 @@
+package user
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api_authentication/configs"
+	"api_authentication/internal/auth"
+)
+
+// Configuração do bloqueio por tentativas de login malsucedidas
+type lockoutPolicy struct {
+	maxAttempts int           // Falhas seguidas até o bloqueio temporário
+	backoffBase time.Duration // Espera após a primeira falha; dobra a cada nova falha
+	lockout     time.Duration // Duração do bloqueio após maxAttempts falhas
+	window      time.Duration // Falhas mais antigas que isso deixam de contar
+}
+
+func loadLockoutPolicy() lockoutPolicy {
+	maxAttempts, err := strconv.Atoi(configs.GetEnv("LOGIN_MAX_ATTEMPTS", "5"))
+	if err != nil || maxAttempts < 1 {
+		maxAttempts = 5
+	}
+	return lockoutPolicy{
+		maxAttempts: maxAttempts,
+		backoffBase: configs.GetEnvDuration("LOGIN_BACKOFF_BASE", time.Second),
+		lockout:     configs.GetEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		window:      configs.GetEnvDuration("LOGIN_ATTEMPT_WINDOW", 24*time.Hour),
+	}
+}
+
+// delayAfter retorna por quanto tempo o login fica recusado após a n-ésima falha seguida
+func (p lockoutPolicy) delayAfter(attempts int) time.Duration {
+	if attempts >= p.maxAttempts {
+		return p.lockout
+	}
+	delay := time.Duration(float64(p.backoffBase) * math.Pow(2, float64(attempts-1)))
+	if delay > p.lockout {
+		return p.lockout
+	}
+	return delay
+}
+
+// dummyPasswordHash é comparado quando o usuário não existe, para que o tempo de
+// resposta não revele se a conta existe
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := auth.HashPassword("senha-inexistente")
+	if err != nil {
+		log.Printf("Erro ao gerar hash de senha fictício: %v", err)
+	}
+	return hash
+})
+
+// isLoginLocked indica se o login por senha está temporariamente recusado
+func isLoginLocked(user *User, now time.Time) bool {
+	return user.LockedUntil != nil && now.Before(*user.LockedUntil)
+}
+
+// registerFailedLogin contabiliza uma senha incorreta e aplica a espera progressiva
+// ou o bloqueio temporário
+func (s *userServiceImpl) registerFailedLogin(c *gin.Context, user *User) error {
+	return s.registerFailedAttempt(c, user, nil)
+}
+
+// registerFailedAttempt contabiliza uma senha ou segundo fator incorreto como registerFailedLogin.
+// details é acrescentado ao evento de auditoria.
+func (s *userServiceImpl) registerFailedAttempt(c *gin.Context, user *User, details map[string]interface{}) error {
+	policy := loadLockoutPolicy()
+	now := time.Now()
+
+	attempts, err := s.repo.RecordFailedLogin(user.ID, now, policy.window)
+	if err != nil {
+		return err
+	}
+	event := map[string]interface{}{"attempts": attempts}
+	for k, v := range details {
+		event[k] = v
+	}
+	s.audit(c, user.ID, AuditLoginFailed, event)
+	if attempts >= policy.maxAttempts {
+		log.Printf("Login bloqueado por %s para userID %d após %d falhas", policy.lockout, user.ID, attempts)
+		s.audit(c, user.ID, AuditAccountLocked, map[string]interface{}{"duration": policy.lockout.String()})
+		if _, err := s.transitionStatus(user, StatusLocked, nil); err != nil {
+			return err
+		}
+	}
+	return s.repo.LockUser(user.ID, now.Add(policy.delayAfter(attempts)))
+}
+
+// respondInvalidCredentials é a resposta única para usuário inexistente, senha incorreta
+// ou conta bloqueada
+func respondInvalidCredentials(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, gin.H{"message": "Credenciais inválidas ou muitas tentativas. Tente novamente mais tarde."})
+}
+
+// UnlockUser (rota de administrador) remove o bloqueio de login e zera as falhas de um usuário
+func (s *userServiceImpl) UnlockUser(c *gin.Context) {
+	idParam := c.Param("id")
+	userID, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de usuário inválido."})
+		return
+	}
+
+	if _, err := s.repo.GetUserByID(uint(userID)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuário."})
+		return
+	}
+
+	if err := s.repo.ResetFailedLogins(uint(userID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao desbloquear usuário."})
+		return
+	}
+
+	s.audit(c, uint(userID), AuditAccountUnlocked, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Usuário desbloqueado com sucesso!"})
+}
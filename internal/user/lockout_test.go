@@ -0,0 +1,139 @@
+package user
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"api_authentication/internal/auth"
+)
+
+// createTestUserWithPassword cria um usuário ativo com a senha informada
+func createTestUserWithPassword(t *testing.T, repo UserRepository, username, password string) *User {
+	t.Helper()
+	user := createTestUser(t, repo, username)
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateUserFields(user.ID, map[string]interface{}{"password": hash}); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// newLockoutTestServer monta as rotas de login e de desbloqueio
+func newLockoutTestServer(s *userServiceImpl) *gin.Engine {
+	r := gin.New()
+	r.POST("/login", s.Login)
+	r.POST("/users/:id/unlock", s.UnlockUser)
+	return r
+}
+
+// lockedFor retorna por quanto tempo, a partir de agora, o login do usuário está recusado
+func lockedFor(t *testing.T, repo UserRepository, id uint) time.Duration {
+	t.Helper()
+	stored, err := repo.GetUserByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.LockedUntil == nil {
+		return 0
+	}
+	return time.Until(*stored.LockedUntil)
+}
+
+func TestLoginBackoffDoublesAfterEachFailure(t *testing.T) {
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "5")
+	t.Setenv("LOGIN_BACKOFF_BASE", "1m")
+	t.Setenv("LOGIN_LOCKOUT_DURATION", "1h")
+	_, s := newTestService(t)
+	user := createTestUserWithPassword(t, s.repo, "alice", "senha123")
+	r := newLockoutTestServer(s)
+
+	for attempt, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		if code, _ := doJSON(t, r, "POST", "/login", LoginRequest{Username: "alice", Password: "errada"}); code != http.StatusUnauthorized {
+			t.Fatalf("falha %d: esperado 401, obtido %d", attempt+1, code)
+		}
+		if got := lockedFor(t, s.repo, user.ID); got > want || got < want-time.Minute/2 {
+			t.Errorf("falha %d: espera de %s, esperada %s", attempt+1, got.Round(time.Second), want)
+		}
+
+		// Durante a espera, nem a senha certa entra
+		if code, _ := doJSON(t, r, "POST", "/login", LoginRequest{Username: "alice", Password: "senha123"}); code != http.StatusUnauthorized {
+			t.Fatalf("senha certa durante a espera: esperado 401, obtido %d", code)
+		}
+		if err := s.repo.UpdateUserFields(user.ID, map[string]interface{}{"locked_until": nil}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stored, err := s.repo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.FailedLoginAttempts != 3 {
+		t.Errorf("esperadas 3 falhas registradas (a senha certa durante a espera não conta), obtidas %d", stored.FailedLoginAttempts)
+	}
+}
+
+func TestLoginLockoutAndUnlock(t *testing.T) {
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "3")
+	t.Setenv("LOGIN_BACKOFF_BASE", "0s")
+	t.Setenv("LOGIN_LOCKOUT_DURATION", "15m")
+	_, s := newTestService(t)
+	user := createTestUserWithPassword(t, s.repo, "alice", "senha123")
+	r := newLockoutTestServer(s)
+
+	for i := 0; i < 3; i++ {
+		if code, _ := doJSON(t, r, "POST", "/login", LoginRequest{Username: "alice", Password: "errada"}); code != http.StatusUnauthorized {
+			t.Fatalf("falha %d: esperado 401, obtido %d", i+1, code)
+		}
+	}
+	stored, err := s.repo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != StatusLocked {
+		t.Errorf("após o limite de falhas: status=%q, esperado %q", stored.Status, StatusLocked)
+	}
+	if got := lockedFor(t, s.repo, user.ID); got < 14*time.Minute {
+		t.Errorf("bloqueio de %s, esperado 15m", got.Round(time.Second))
+	}
+	code, body := doJSON(t, r, "POST", "/login", LoginRequest{Username: "alice", Password: "senha123"})
+	if code != http.StatusUnauthorized {
+		t.Fatalf("senha certa com a conta bloqueada: esperado 401, obtido %d", code)
+	}
+	// A resposta não distingue conta bloqueada de senha errada
+	if _, wrong := doJSON(t, r, "POST", "/login", LoginRequest{Username: "ninguem", Password: "x"}); body["message"] != wrong["message"] {
+		t.Errorf("conta bloqueada respondida de forma distinta: %v", body["message"])
+	}
+
+	if code, _ := doJSON(t, r, "POST", "/users/"+strconv.FormatUint(uint64(user.ID), 10)+"/unlock", nil); code != http.StatusOK {
+		t.Fatalf("desbloqueio: esperado 200, obtido %d", code)
+	}
+	if stored, err = s.repo.GetUserByID(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != StatusActive || stored.FailedLoginAttempts != 0 || stored.LockedUntil != nil {
+		t.Errorf("após o desbloqueio: status=%q, %d falhas, bloqueio até %v", stored.Status, stored.FailedLoginAttempts, stored.LockedUntil)
+	}
+	if code, body := doJSON(t, r, "POST", "/login", LoginRequest{Username: "alice", Password: "senha123"}); code != http.StatusOK || body["token"] == nil {
+		t.Errorf("login após o desbloqueio: %d %v", code, body)
+	}
+}
+
+func TestUnlockUnknownUser(t *testing.T) {
+	_, s := newTestService(t)
+	r := newLockoutTestServer(s)
+
+	if code, _ := doJSON(t, r, "POST", "/users/999/unlock", nil); code != http.StatusNotFound {
+		t.Errorf("usuário inexistente: esperado 404, obtido %d", code)
+	}
+	if code, _ := doJSON(t, r, "POST", "/users/abc/unlock", nil); code != http.StatusBadRequest {
+		t.Errorf("ID inválido: esperado 400, obtido %d", code)
+	}
+}
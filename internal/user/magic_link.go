@@ -0,0 +1,136 @@
+package user
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api_authentication/configs"
+	"api_authentication/internal/mail"
+)
+
+// magicLinkResendInterval é o intervalo mínimo entre dois envios para o mesmo usuário
+const magicLinkResendInterval = time.Minute
+
+// RequestMagicLink envia por email um link de acesso e um código de 6 dígitos, ambos de
+// uso único. A resposta é sempre a mesma, exista ou não uma conta com o email informado.
+func (s *userServiceImpl) RequestMagicLink(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	accepted := gin.H{"message": "Se o email estiver cadastrado, você receberá um link de acesso em instantes."}
+
+	user, err := s.repo.GetUserByEmail(req.Email)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusAccepted, accepted)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuário."})
+		return
+	}
+
+	recent, err := s.repo.CountOneTimeTokensSince(user.ID, PurposeMagicLink, time.Now().Add(-magicLinkResendInterval))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar link de acesso."})
+		return
+	}
+	if recent > 0 {
+		c.JSON(http.StatusAccepted, accepted) // Limita o envio sem revelar que a conta existe
+		return
+	}
+
+	ttl := configs.GetEnvDuration("MAGIC_LINK_TTL", 15*time.Minute)
+	token, code, err := s.issueOneTimeToken(user.ID, PurposeMagicLink, ttl, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar link de acesso."})
+		return
+	}
+
+	link := configs.GetEnv("APP_URL", "http://localhost:5500") + "/magic-link?token=" + url.QueryEscape(token)
+	err = s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Seu link de acesso",
+		Body: fmt.Sprintf("Olá, %s!\n\nUse o link abaixo para entrar na sua conta:\n%s\n\n"+
+			"Ou informe o código: %s\n\n"+
+			"O link e o código expiram em %s e só podem ser usados uma vez. "+
+			"Se você não solicitou este acesso, ignore este email.",
+			user.Username, link, code, ttl),
+	})
+	if err != nil {
+		log.Printf("Erro ao enviar link mágico para userID %d: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusAccepted, accepted)
+}
+
+// VerifyMagicLink troca o token do link (ou email + código) pelo token de acesso
+func (s *userServiceImpl) VerifyMagicLink(c *gin.Context) {
+	var req MagicLinkVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	var (
+		record *OneTimeToken
+		err    error
+	)
+	if req.Token != "" {
+		record, err = s.redeemOneTimeToken(PurposeMagicLink, req.Token)
+	} else {
+		var user *User
+		user, err = s.repo.GetUserByEmail(req.Email)
+		if err == gorm.ErrRecordNotFound {
+			err = errInvalidOneTimeToken
+		}
+		if err == nil {
+			record, err = s.redeemOneTimeCode(user.ID, PurposeMagicLink, req.Code)
+		}
+	}
+	if err != nil {
+		if err == errInvalidOneTimeToken {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Link ou código inválido ou expirado."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar link de acesso."})
+		return
+	}
+
+	user, err := s.repo.GetUserByID(record.UserID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Link ou código inválido ou expirado."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuário."})
+		return
+	}
+
+	// Receber o link ou o código prova o controle do email
+	if err := s.markEmailVerified(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao confirmar email."})
+		return
+	}
+
+	// Mesmo fluxo do login com senha: se houver MFA ativo, o segundo fator ainda é exigido
+	s.respondLogin(c, user)
+}
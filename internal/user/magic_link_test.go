@@ -0,0 +1,140 @@
+package user
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"api_authentication/internal/mail"
+)
+
+// recordingMailer guarda os emails enviados
+type recordingMailer struct {
+	messages []mail.Message
+}
+
+func (m *recordingMailer) Send(msg mail.Message) error {
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+var (
+	magicLinkTokenPattern = regexp.MustCompile(`token=(\S+)`)
+	magicLinkCodePattern  = regexp.MustCompile(`código: (\d{6})`)
+)
+
+// newMagicLinkTestServer monta as rotas do link mágico sobre um serviço que registra os emails
+func newMagicLinkTestServer(t *testing.T) (*userServiceImpl, *recordingMailer, *gin.Engine) {
+	t.Helper()
+	_, s := newTestService(t)
+	mailer := &recordingMailer{}
+	s.mailer = mailer
+	r := gin.New()
+	r.POST("/magic-link", s.RequestMagicLink)
+	r.POST("/magic-link/verify", s.VerifyMagicLink)
+	return s, mailer, r
+}
+
+// requestMagicLink pede o link e retorna o token e o código do email enviado
+func requestMagicLink(t *testing.T, r *gin.Engine, mailer *recordingMailer, email string) (string, string) {
+	t.Helper()
+	if code, _ := doJSON(t, r, "POST", "/magic-link", MagicLinkRequest{Email: email}); code != http.StatusAccepted {
+		t.Fatalf("pedido do link: esperado 202, obtido %d", code)
+	}
+	if len(mailer.messages) == 0 {
+		t.Fatal("nenhum email enviado")
+	}
+	body := mailer.messages[len(mailer.messages)-1].Body
+	token, code := magicLinkTokenPattern.FindStringSubmatch(body), magicLinkCodePattern.FindStringSubmatch(body)
+	if token == nil || code == nil {
+		t.Fatalf("email sem link ou código: %q", body)
+	}
+	unescaped, err := url.QueryUnescape(token[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return unescaped, code[1]
+}
+
+func TestRequestMagicLinkDoesNotRevealAccounts(t *testing.T) {
+	s, mailer, r := newMagicLinkTestServer(t)
+	createTestUser(t, s.repo, "alice")
+
+	code, unknown := doJSON(t, r, "POST", "/magic-link", MagicLinkRequest{Email: "ninguem@example.com"})
+	if code != http.StatusAccepted || len(mailer.messages) != 0 {
+		t.Fatalf("email desconhecido: %d, %d email(s) enviados", code, len(mailer.messages))
+	}
+	code, known := doJSON(t, r, "POST", "/magic-link", MagicLinkRequest{Email: "alice@example.com"})
+	if code != http.StatusAccepted || len(mailer.messages) != 1 {
+		t.Fatalf("email cadastrado: %d, %d email(s) enviados", code, len(mailer.messages))
+	}
+	if unknown["message"] != known["message"] {
+		t.Errorf("respostas distintas: %v / %v", unknown["message"], known["message"])
+	}
+
+	// Novo pedido dentro do intervalo mínimo: mesma resposta, sem novo email
+	if code, _ := doJSON(t, r, "POST", "/magic-link", MagicLinkRequest{Email: "alice@example.com"}); code != http.StatusAccepted || len(mailer.messages) != 1 {
+		t.Errorf("reenvio imediato: %d, %d email(s) enviados", code, len(mailer.messages))
+	}
+}
+
+func TestVerifyMagicLinkTokenIsSingleUse(t *testing.T) {
+	s, mailer, r := newMagicLinkTestServer(t)
+	user := createTestUser(t, s.repo, "alice")
+	if err := s.repo.UpdateUserFields(user.ID, map[string]interface{}{"email_verified_at": nil}); err != nil {
+		t.Fatal(err)
+	}
+	token, _ := requestMagicLink(t, r, mailer, "alice@example.com")
+
+	if code, body := doJSON(t, r, "POST", "/magic-link/verify", MagicLinkVerifyRequest{Token: token}); code != http.StatusOK || body["token"] == nil {
+		t.Fatalf("link válido: %d %v", code, body)
+	}
+	if code, _ := doJSON(t, r, "POST", "/magic-link/verify", MagicLinkVerifyRequest{Token: token}); code != http.StatusUnauthorized {
+		t.Errorf("link reutilizado: esperado 401, obtido %d", code)
+	}
+
+	// Receber o link prova o controle do email
+	stored, err := s.repo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.EmailVerifiedAt == nil {
+		t.Error("email não confirmado pelo link de acesso")
+	}
+}
+
+func TestVerifyMagicLinkCode(t *testing.T) {
+	s, mailer, r := newMagicLinkTestServer(t)
+	createTestUser(t, s.repo, "alice")
+	createTestUser(t, s.repo, "bob")
+	_, code := requestMagicLink(t, r, mailer, "alice@example.com")
+
+	// O código só vale para o email a que foi enviado
+	if status, _ := doJSON(t, r, "POST", "/magic-link/verify", MagicLinkVerifyRequest{Email: "bob@example.com", Code: code}); status != http.StatusUnauthorized {
+		t.Errorf("código de outro email: esperado 401, obtido %d", status)
+	}
+	if status, _ := doJSON(t, r, "POST", "/magic-link/verify", MagicLinkVerifyRequest{Email: "ninguem@example.com", Code: code}); status != http.StatusUnauthorized {
+		t.Errorf("email desconhecido: esperado 401, obtido %d", status)
+	}
+	if status, body := doJSON(t, r, "POST", "/magic-link/verify", MagicLinkVerifyRequest{Email: "alice@example.com", Code: code}); status != http.StatusOK || body["token"] == nil {
+		t.Fatalf("código válido: %d %v", status, body)
+	}
+	if status, _ := doJSON(t, r, "POST", "/magic-link/verify", MagicLinkVerifyRequest{Email: "alice@example.com", Code: code}); status != http.StatusUnauthorized {
+		t.Errorf("código reutilizado: esperado 401, obtido %d", status)
+	}
+}
+
+func TestVerifyMagicLinkStillRequiresMFA(t *testing.T) {
+	s, mailer, r := newMagicLinkTestServer(t)
+	user := createTestUser(t, s.repo, "alice")
+	enableTestTOTP(t, s, user, "senha123")
+	token, _ := requestMagicLink(t, r, mailer, "alice@example.com")
+
+	code, body := doJSON(t, r, "POST", "/magic-link/verify", MagicLinkVerifyRequest{Token: token})
+	if code != http.StatusOK || body["mfa_required"] != true || body["token"] != nil {
+		t.Errorf("link com TOTP ativo: esperado desafio MFA, obtido %d %v", code, body)
+	}
+}
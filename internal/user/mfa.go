@@ -0,0 +1,538 @@
+package user
+
+import (
+	"encoding/base64"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api_authentication/internal/auth"
+)
+
+// Métodos de segundo fator aceitos no desafio de login
+const (
+	MFAMethodTOTP         = "totp"
+	MFAMethodRecoveryCode = "recovery_code"
+	MFAMethodWebAuthn     = "webauthn"
+	MFAMethodSMS          = "sms"
+)
+
+// mfaChallengeTTL é a validade do desafio MFA emitido após a senha
+const mfaChallengeTTL = 5 * time.Minute
+
+// recoveryCodeCount é quantos códigos de recuperação são gerados por conjunto
+const recoveryCodeCount = 10
+
+// mfaMethods retorna os segundos fatores ativos do usuário (vazio se MFA estiver desativado)
+func (s *userServiceImpl) mfaMethods(user *User) ([]string, error) {
+	var methods []string
+	if user.TOTPEnabled {
+		methods = append(methods, MFAMethodTOTP, MFAMethodRecoveryCode)
+	}
+
+	if user.SMSMFAEnabled && user.PhoneVerifiedAt != nil {
+		methods = append(methods, MFAMethodSMS)
+	}
+
+	passkeys, err := s.repo.CountWebAuthnCredentials(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if passkeys > 0 {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+	return methods, nil
+}
+
+// respondLogin conclui uma autenticação primária bem-sucedida: emite o token de acesso
+// ou, se o usuário tiver MFA ativo e o dispositivo não for confiável, um token de
+// desafio para a segunda etapa
+func (s *userServiceImpl) respondLogin(c *gin.Context, user *User) {
+	if s.loginBlocked(c, user) {
+		return
+	}
+
+	methods, err := s.mfaMethods(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar métodos MFA."})
+		return
+	}
+
+	if len(methods) > 0 && !s.isTrustedDevice(c, user) {
+		mfaToken, _, err := s.issueOneTimeToken(user.ID, PurposeMFAChallenge, mfaChallengeTTL, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar desafio MFA."})
+			return
+		}
+		c.JSON(http.StatusOK, LoginResponse{MFARequired: true, MFAToken: mfaToken, MFAMethods: methods})
+		return
+	}
+
+	s.issueToken(c, user, "")
+}
+
+// completeMFA emite o token de acesso após um segundo fator válido e, se pedido,
+// registra o dispositivo atual como confiável
+func (s *userServiceImpl) completeMFA(c *gin.Context, user *User, rememberDevice bool, deviceName string) {
+	var deviceToken string
+	if rememberDevice {
+		var err error
+		deviceToken, err = s.trustDevice(c, user, deviceName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao registrar dispositivo confiável."})
+			return
+		}
+	}
+
+	s.issueToken(c, user, deviceToken)
+}
+
+// issueToken emite o token de acesso de um usuário já totalmente autenticado. Só aqui as
+// falhas de login são zeradas: a senha correta sozinha não zera as falhas do segundo fator.
+func (s *userServiceImpl) issueToken(c *gin.Context, user *User, trustedDeviceToken string) {
+	if user.FailedLoginAttempts > 0 {
+		if err := s.repo.ResetFailedLogins(user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atualizar usuário."})
+			return
+		}
+	}
+
+	token, err := s.generateAccessToken(user.ID, s.defaultOrganizationID(user.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar token JWT."})
+		return
+	}
+
+	s.audit(c, user.ID, AuditLoginSucceeded, nil)
+
+	c.JSON(http.StatusOK, LoginResponse{Token: token, TrustedDeviceToken: trustedDeviceToken})
+}
+
+// generateAccessToken gera o token de acesso com os papéis e grupos efetivos do usuário
+func (s *userServiceImpl) generateAccessToken(userID, orgID uint) (string, error) {
+	roles, groups, err := EffectiveRoles(s.repo, userID)
+	if err != nil {
+		return "", err
+	}
+
+	roleNames := make([]string, 0, len(roles))
+	for _, r := range roles {
+		roleNames = append(roleNames, r.Name)
+	}
+	return auth.GenerateJWT(userID, orgID, roleNames, groupNames(groups))
+}
+
+// verifyTOTP valida o código contra o segredo do usuário e consome o passo de tempo,
+// de modo que o mesmo código não seja aceito duas vezes
+func (s *userServiceImpl) verifyTOTP(user *User, code string) (bool, error) {
+	if user.TOTPSecret == "" {
+		return false, nil
+	}
+
+	secret, err := auth.DecryptSecret(user.TOTPSecret)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := auth.ValidateTOTPCode(secret, code, user.TOTPLastStep, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	consumed, err := s.repo.ConsumeTOTPStep(user.ID, step)
+	if err != nil {
+		return false, err
+	}
+	if consumed {
+		user.TOTPLastStep = step
+	}
+	return consumed, nil
+}
+
+// generateRecoveryCodes cria um novo conjunto de códigos de recuperação, invalidando o anterior,
+// e retorna os códigos em texto puro (só podem ser exibidos neste momento)
+func (s *userServiceImpl) generateRecoveryCodes(userID uint) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := auth.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = auth.HashToken(auth.NormalizeRecoveryCode(code))
+	}
+
+	if err := s.repo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// useRecoveryCode consome um código de recuperação do usuário
+func (s *userServiceImpl) useRecoveryCode(user *User, code string) (bool, error) {
+	return s.repo.UseRecoveryCode(user.ID, auth.HashToken(auth.NormalizeRecoveryCode(code)))
+}
+
+// mfaChallengeUser carrega o usuário do desafio MFA sem reservar tentativa (ex.: para enviar
+// o código ou iniciar a verificação). Em caso de erro a resposta já é escrita e nil é retornado.
+func (s *userServiceImpl) mfaChallengeUser(c *gin.Context, mfaToken string) *User {
+	user, _ := s.mfaChallenge(c, mfaToken)
+	return user
+}
+
+// mfaChallenge valida o token de desafio MFA e carrega o desafio e o usuário correspondente.
+// Em caso de erro a resposta já é escrita e nil é retornado.
+func (s *userServiceImpl) mfaChallenge(c *gin.Context, mfaToken string) (*User, *OneTimeToken) {
+	challenge, err := s.repo.GetActiveOneTimeTokenByHash(PurposeMFAChallenge, auth.HashToken(mfaToken))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Desafio MFA inválido ou expirado."})
+			return nil, nil
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar desafio MFA."})
+		return nil, nil
+	}
+
+	user, err := s.repo.GetUserByID(challenge.UserID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Desafio MFA inválido ou expirado."})
+			return nil, nil
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuário."})
+		return nil, nil
+	}
+	return user, challenge
+}
+
+// attemptMFAChallenge reserva uma tentativa de segundo fator no desafio. Cada desafio aceita
+// no máximo maxOneTimeCodeAttempts tentativas, e a conta bloqueada por falhas não tenta mais.
+// Em caso de recusa a resposta já é escrita e false é retornado.
+func (s *userServiceImpl) attemptMFAChallenge(c *gin.Context, user *User, challenge *OneTimeToken) bool {
+	if isLoginLocked(user, time.Now()) {
+		s.audit(c, user.ID, AuditLoginFailed, map[string]interface{}{"reason": "locked"})
+		respondInvalidCredentials(c)
+		return false
+	}
+
+	allowed, err := s.repo.IncrementOneTimeTokenAttempts(challenge.ID, maxOneTimeCodeAttempts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar desafio MFA."})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Desafio MFA inválido ou expirado."})
+		return false
+	}
+	return true
+}
+
+// failMFA contabiliza um segundo fator incorreto como falha de login (com espera progressiva
+// e bloqueio) e escreve a resposta
+func (s *userServiceImpl) failMFA(c *gin.Context, user *User, method, message string) {
+	if err := s.registerFailedAttempt(c, user, map[string]interface{}{"mfa_method": method}); err != nil {
+		log.Printf("Erro ao registrar falha de MFA para userID %d: %v", user.ID, err)
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"message": message})
+}
+
+// finishMFAChallenge consome o desafio (uso único) e emite o token de acesso
+func (s *userServiceImpl) finishMFAChallenge(c *gin.Context, user *User, challenge *OneTimeToken, rememberDevice bool, deviceName string) {
+	consumed, err := s.repo.ConsumeOneTimeToken(challenge.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar desafio MFA."})
+		return
+	}
+	if !consumed {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Desafio MFA inválido ou expirado."})
+		return
+	}
+
+	s.completeMFA(c, user, rememberDevice, deviceName)
+}
+
+// confirmTOTPChange exige a senha atual e um código TOTP válido para alterar o segundo fator.
+// Senha ou código incorretos contam como falha de login (espera progressiva e bloqueio), para
+// que um token de acesso roubado não permita adivinhar o código. Em caso de recusa a resposta
+// já é escrita e false é retornado.
+func (s *userServiceImpl) confirmTOTPChange(c *gin.Context, user *User, req TOTPCodeRequest, action string) bool {
+	passwordOK := auth.CheckPasswordHash(req.Password, user.Password)
+	if isLoginLocked(user, time.Now()) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"message": "Muitas tentativas incorretas. Tente novamente mais tarde."})
+		return false
+	}
+	if !passwordOK {
+		if err := s.registerFailedAttempt(c, user, map[string]interface{}{"action": action}); err != nil {
+			log.Printf("Erro ao registrar falha de login para userID %d: %v", user.ID, err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Senha incorreta."})
+		return false
+	}
+
+	ok, err := s.verifyTOTP(user, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar código TOTP."})
+		return false
+	}
+	if !ok {
+		if err := s.registerFailedAttempt(c, user, map[string]interface{}{"action": action, "mfa_method": MFAMethodTOTP}); err != nil {
+			log.Printf("Erro ao registrar falha de MFA para userID %d: %v", user.ID, err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Código TOTP inválido."})
+		return false
+	}
+	return true
+}
+
+// currentUser carrega o usuário autenticado a partir do userID definido pelo AuthMiddleware.
+// Em caso de erro a resposta já é escrita e nil é retornado.
+func (s *userServiceImpl) currentUser(c *gin.Context) *User {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "ID do usuário não encontrado no contexto."})
+		return nil
+	}
+
+	user, err := s.repo.GetUserByID(userID.(uint))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado."})
+			return nil
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuário logado."})
+		return nil
+	}
+	return user
+}
+
+// EnrollTOTP inicia o cadastro do TOTP: gera um novo segredo (ainda inativo) e
+// retorna a URI otpauth:// e o QR code para o aplicativo autenticador
+func (s *userServiceImpl) EnrollTOTP(c *gin.Context) {
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"message": "A autenticação em dois fatores já está ativa."})
+		return
+	}
+
+	key, err := auth.GenerateTOTPKey(user.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar segredo TOTP."})
+		return
+	}
+
+	qrCode, err := auth.TOTPQRCodePNG(key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar QR code."})
+		return
+	}
+
+	encrypted, err := auth.EncryptSecret(key.Secret())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao proteger segredo TOTP."})
+		return
+	}
+
+	if err := s.repo.UpdateUserFields(user.ID, map[string]interface{}{"totp_secret": encrypted, "totp_last_step": 0}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao salvar segredo TOTP."})
+		return
+	}
+
+	c.JSON(http.StatusOK, TOTPEnrollResponse{
+		Secret:     key.Secret(),
+		OTPAuthURL: key.URL(),
+		QRCodePNG:  "data:image/png;base64," + base64.StdEncoding.EncodeToString(qrCode),
+	})
+}
+
+// ConfirmTOTP ativa o TOTP após o usuário confirmar a senha e provar que configurou o autenticador
+func (s *userServiceImpl) ConfirmTOTP(c *gin.Context) {
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"message": "A autenticação em dois fatores já está ativa."})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Nenhum cadastro TOTP pendente. Inicie o cadastro primeiro."})
+		return
+	}
+
+	if !s.confirmTOTPChange(c, user, req, "totp_confirm") {
+		return
+	}
+
+	if err := s.repo.UpdateUserFields(user.ID, map[string]interface{}{"totp_enabled": true}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao ativar TOTP."})
+		return
+	}
+
+	codes, err := s.generateRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar códigos de recuperação."})
+		return
+	}
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{
+		Message:       "Autenticação em dois fatores ativada com sucesso! Guarde os códigos de recuperação em local seguro.",
+		RecoveryCodes: codes,
+	})
+}
+
+// DisableTOTP desativa o TOTP mediante a senha atual e um código válido
+func (s *userServiceImpl) DisableTOTP(c *gin.Context) {
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "A autenticação em dois fatores não está ativa."})
+		return
+	}
+
+	if !s.confirmTOTPChange(c, user, req, "totp_disable") {
+		return
+	}
+
+	if err := s.repo.UpdateUserFields(user.ID, map[string]interface{}{"totp_enabled": false, "totp_secret": ""}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao desativar TOTP."})
+		return
+	}
+
+	if err := s.repo.DeleteRecoveryCodes(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao remover códigos de recuperação."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Autenticação em dois fatores desativada."})
+}
+
+// RegenerateRecoveryCodes gera um novo conjunto de códigos de recuperação mediante a senha
+// atual e um código TOTP válido; os códigos anteriores deixam de funcionar
+func (s *userServiceImpl) RegenerateRecoveryCodes(c *gin.Context) {
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "A autenticação em dois fatores não está ativa."})
+		return
+	}
+
+	if !s.confirmTOTPChange(c, user, req, "recovery_codes_regenerate") {
+		return
+	}
+
+	codes, err := s.generateRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar códigos de recuperação."})
+		return
+	}
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{
+		Message:       "Novos códigos de recuperação gerados. Os códigos anteriores foram invalidados.",
+		RecoveryCodes: codes,
+	})
+}
+
+// LoginMFA conclui o login em duas etapas trocando o token de desafio e um código
+// válido pelo token de acesso
+func (s *userServiceImpl) LoginMFA(c *gin.Context) {
+	var req MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	user, challenge := s.mfaChallenge(c, req.MFAToken)
+	if user == nil {
+		return
+	}
+	if !s.attemptMFAChallenge(c, user, challenge) {
+		return
+	}
+
+	method := req.Method
+	if method == "" {
+		method = MFAMethodTOTP
+	}
+
+	var (
+		ok  bool
+		err error
+	)
+	switch method {
+	case MFAMethodTOTP:
+		if user.TOTPEnabled {
+			ok, err = s.verifyTOTP(user, req.Code)
+		}
+	case MFAMethodRecoveryCode:
+		if user.TOTPEnabled {
+			ok, err = s.useRecoveryCode(user, req.Code)
+		}
+	case MFAMethodSMS:
+		if user.SMSMFAEnabled && user.PhoneVerifiedAt != nil {
+			ok, err = s.verifySMSCode(user, req.Code)
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar código."})
+		return
+	}
+	if !ok {
+		s.failMFA(c, user, method, "Código inválido.")
+		return
+	}
+
+	s.finishMFAChallenge(c, user, challenge, req.RememberDevice, req.DeviceName)
+}
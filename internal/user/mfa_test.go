@@ -0,0 +1,168 @@
+package user
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+
+	"api_authentication/internal/auth"
+)
+
+// enableTestTOTP define a senha e ativa o TOTP do usuário, retornando o segredo em claro
+func enableTestTOTP(t *testing.T, s *userServiceImpl, user *User, password string) string {
+	t.Helper()
+	key, err := auth.GenerateTOTPKey(user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := auth.EncryptSecret(key.Secret())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.repo.UpdateUserFields(user.ID, map[string]interface{}{"password": hash, "totp_secret": encrypted, "totp_enabled": true}); err != nil {
+		t.Fatal(err)
+	}
+	return key.Secret()
+}
+
+// newMFAChallenge emite um desafio MFA como o login por senha faria
+func newMFAChallenge(t *testing.T, s *userServiceImpl, user *User) string {
+	t.Helper()
+	token, _, err := s.issueOneTimeToken(user.ID, PurposeMFAChallenge, mfaChallengeTTL, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func currentTOTPCode(t *testing.T, secret string) string {
+	t.Helper()
+	code, err := totp.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestLoginMFARejectsReusedTOTPStep(t *testing.T) {
+	_, s := newTestService(t)
+	user := createTestUser(t, s.repo, "alice")
+	secret := enableTestTOTP(t, s, user, "senha123")
+	r := gin.New()
+	r.POST("/login/mfa", s.LoginMFA)
+
+	code := currentTOTPCode(t, secret)
+	if status, body := doJSON(t, r, "POST", "/login/mfa", MFALoginRequest{MFAToken: newMFAChallenge(t, s, user), Code: code}); status != http.StatusOK {
+		t.Fatalf("primeiro uso do código: esperado 200, obtido %d (%v)", status, body)
+	}
+	if status, _ := doJSON(t, r, "POST", "/login/mfa", MFALoginRequest{MFAToken: newMFAChallenge(t, s, user), Code: code}); status != http.StatusUnauthorized {
+		t.Errorf("código já usado em outro desafio: esperado 401, obtido %d", status)
+	}
+}
+
+func TestLoginMFAChallengeIsSingleUse(t *testing.T) {
+	_, s := newTestService(t)
+	user := createTestUser(t, s.repo, "alice")
+	secret := enableTestTOTP(t, s, user, "senha123")
+	r := gin.New()
+	r.POST("/login/mfa", s.LoginMFA)
+
+	challenge := newMFAChallenge(t, s, user)
+	if status, _ := doJSON(t, r, "POST", "/login/mfa", MFALoginRequest{MFAToken: challenge, Code: currentTOTPCode(t, secret)}); status != http.StatusOK {
+		t.Fatalf("login MFA: esperado 200, obtido %d", status)
+	}
+	if err := s.repo.UpdateUserFields(user.ID, map[string]interface{}{"totp_last_step": 0}); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := doJSON(t, r, "POST", "/login/mfa", MFALoginRequest{MFAToken: challenge, Code: currentTOTPCode(t, secret)}); status != http.StatusUnauthorized {
+		t.Errorf("desafio reutilizado: esperado 401, obtido %d", status)
+	}
+}
+
+func TestLoginMFAChallengeAttemptCap(t *testing.T) {
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "100")
+	t.Setenv("LOGIN_BACKOFF_BASE", "0s")
+	_, s := newTestService(t)
+	user := createTestUser(t, s.repo, "alice")
+	secret := enableTestTOTP(t, s, user, "senha123")
+	r := gin.New()
+	r.POST("/login/mfa", s.LoginMFA)
+
+	challenge := newMFAChallenge(t, s, user)
+	for i := 0; i < maxOneTimeCodeAttempts; i++ {
+		if status, _ := doJSON(t, r, "POST", "/login/mfa", MFALoginRequest{MFAToken: challenge, Code: "000000"}); status != http.StatusUnauthorized {
+			t.Fatalf("código errado %d: esperado 401, obtido %d", i+1, status)
+		}
+	}
+
+	status, body := doJSON(t, r, "POST", "/login/mfa", MFALoginRequest{MFAToken: challenge, Code: currentTOTPCode(t, secret)})
+	if status != http.StatusUnauthorized {
+		t.Fatalf("código certo após esgotar as tentativas: esperado 401, obtido %d", status)
+	}
+	if body["message"] != "Desafio MFA inválido ou expirado." {
+		t.Errorf("desafio esgotado deveria ser recusado, obtido %v", body["message"])
+	}
+
+	stored, err := s.repo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.FailedLoginAttempts != maxOneTimeCodeAttempts {
+		t.Errorf("esperadas %d falhas de login registradas, obtidas %d", maxOneTimeCodeAttempts, stored.FailedLoginAttempts)
+	}
+}
+
+func TestDisableTOTPRequiresPasswordAndCountsFailures(t *testing.T) {
+	t.Setenv("LOGIN_BACKOFF_BASE", "0s")
+	_, s := newTestService(t)
+	user := createTestUser(t, s.repo, "alice")
+	secret := enableTestTOTP(t, s, user, "senha123")
+	r := gin.New()
+	r.POST("/mfa/totp/disable", func(c *gin.Context) { c.Set("userID", user.ID) }, s.DisableTOTP)
+
+	if status, _ := doJSON(t, r, "POST", "/mfa/totp/disable", TOTPCodeRequest{Password: "errada", Code: currentTOTPCode(t, secret)}); status != http.StatusUnauthorized {
+		t.Fatalf("senha errada: esperado 401, obtido %d", status)
+	}
+	if status, _ := doJSON(t, r, "POST", "/mfa/totp/disable", TOTPCodeRequest{Password: "senha123", Code: "000000"}); status != http.StatusUnauthorized {
+		t.Fatalf("código errado: esperado 401, obtido %d", status)
+	}
+	stored, err := s.repo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.FailedLoginAttempts != 2 || !stored.TOTPEnabled {
+		t.Fatalf("esperadas 2 falhas e TOTP ativo, obtidas %d falhas (ativo=%v)", stored.FailedLoginAttempts, stored.TOTPEnabled)
+	}
+
+	if status, _ := doJSON(t, r, "POST", "/mfa/totp/disable", TOTPCodeRequest{Password: "senha123", Code: currentTOTPCode(t, secret)}); status != http.StatusOK {
+		t.Fatalf("senha e código certos: esperado 200, obtido %d", status)
+	}
+	if stored, err = s.repo.GetUserByID(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if stored.TOTPEnabled || stored.TOTPSecret != "" {
+		t.Error("TOTP continua ativo após a desativação")
+	}
+}
+
+func TestRegenerateRecoveryCodesRefusedWhileLocked(t *testing.T) {
+	_, s := newTestService(t)
+	user := createTestUser(t, s.repo, "alice")
+	secret := enableTestTOTP(t, s, user, "senha123")
+	if err := s.repo.LockUser(user.ID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.POST("/mfa/recovery-codes/regenerate", func(c *gin.Context) { c.Set("userID", user.ID) }, s.RegenerateRecoveryCodes)
+
+	if status, _ := doJSON(t, r, "POST", "/mfa/recovery-codes/regenerate", TOTPCodeRequest{Password: "senha123", Code: currentTOTPCode(t, secret)}); status != http.StatusTooManyRequests {
+		t.Errorf("conta bloqueada: esperado 429, obtido %d", status)
+	}
+}
@@ -0,0 +1,49 @@
+package user
+
+import (
+	"log"
+
+	"api_authentication/internal/emailpolicy"
+)
+
+// dataMigration é um ajuste único nos dados existentes (preenchimento de colunas novas etc.).
+// Cada uma roda uma vez por banco: depois de concluída fica registrada em DataMigration.
+type dataMigration struct {
+	name string
+	run  func() (int, error) // Retorna quantas linhas foram ajustadas
+}
+
+// dataMigrations lista as migrações de dados na ordem em que devem rodar. Nomes já publicados
+// não podem mudar, ou a migração rodaria de novo.
+func dataMigrations(repo UserRepository, emailPolicy *emailpolicy.Policy) []dataMigration {
+	return []dataMigration{
+		{"legacy_admins", func() (int, error) { return MigrateLegacyAdmins(repo) }},
+		{"default_organization", func() (int, error) { return MigrateDefaultOrganization(repo) }},
+		{"normalized_identifiers", func() (int, error) { return BackfillNormalizedIdentifiers(repo) }},
+		{"canonical_emails", func() (int, error) { return BackfillCanonicalEmails(repo, emailPolicy) }},
+	}
+}
+
+// RunDataMigrations executa as migrações de dados ainda não aplicadas neste banco. É chamada na
+// inicialização, depois do AutoMigrate, e pelo subcomando migrate; migrações já registradas são puladas.
+func RunDataMigrations(repo UserRepository, emailPolicy *emailpolicy.Policy) error {
+	for _, m := range dataMigrations(repo, emailPolicy) {
+		applied, err := repo.IsDataMigrationApplied(m.name)
+		if err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+
+		rows, err := m.run()
+		if err != nil {
+			return err
+		}
+		if err := repo.RecordDataMigration(m.name, rows); err != nil {
+			return err
+		}
+		log.Printf("Migração de dados %s aplicada (%d linha(s))", m.name, rows)
+	}
+	return nil
+}
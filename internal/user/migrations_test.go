@@ -0,0 +1,33 @@
+package user
+
+import (
+	"testing"
+
+	"api_authentication/internal/emailpolicy"
+)
+
+func TestRunDataMigrationsRunsOnce(t *testing.T) {
+	_, s := newTestService(t)
+	policy, err := emailpolicy.NewPolicyFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RunDataMigrations(s.repo, policy); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range dataMigrations(s.repo, policy) {
+		applied, err := s.repo.IsDataMigrationApplied(m.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !applied {
+			t.Errorf("migração %s não registrada", m.name)
+		}
+	}
+
+	// Uma segunda execução encontra tudo registrado e não falha
+	if err := RunDataMigrations(s.repo, policy); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,7 +1,12 @@
 // internal/user/models.go
 package user
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
@@ -10,13 +15,288 @@ type User struct {
 	Password  string    `json:"-" gorm:"not null"` // `json:"-"` para não serializar a senha
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// Estado da conta (ver status.go) e suspensão por administrador
+	Status           string     `json:"status" gorm:"not null;default:active;index"`
+	SuspendedAt      *time.Time `json:"suspended_at,omitempty"`
+	SuspendedUntil   *time.Time `json:"suspended_until,omitempty"` // Nulo: suspensão sem prazo
+	SuspensionReason string     `json:"suspension_reason,omitempty"`
+
+	InvitationID *uint `json:"-"` // Convite usado no cadastro, se houver
+
+	// Exclusão lógica: a conta pode ser restaurada até o expurgo definitivo
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	PurgedAt  *time.Time     `json:"-"` // Dados pessoais removidos; a linha fica só como registro anonimizado
+
+	StatusBeforeDeletion string `json:"-"` // Estado da conta antes da exclusão, devolvido na restauração
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`                    // Nulo até o usuário confirmar o email
+	PendingEmail    string     `json:"pending_email,omitempty" gorm:"index"` // Novo email aguardando confirmação (reservado)
+	CanonicalEmail  string     `json:"-" gorm:"index"`                       // Forma canônica (emailpolicy), para detectar a mesma caixa postal
+
+	UsernameSkeleton string `json:"-" gorm:"index"` // Esqueleto do nome (identifier.Skeleton), para detectar nomes confundíveis
+
+	// Bloqueio por tentativas de login malsucedidas
+	FailedLoginAttempts int        `json:"-" gorm:"not null;default:0"`
+	LastFailedLoginAt   *time.Time `json:"-"`
+	LockedUntil         *time.Time `json:"-"` // Login por senha recusado até este instante
+
+	// Autenticação em dois fatores (TOTP)
+	TOTPSecret   string `json:"-"`                                          // Segredo criptografado com auth.EncryptSecret
+	TOTPEnabled  bool   `json:"totp_enabled" gorm:"not null;default:false"` // true somente após a confirmação do cadastro
+	TOTPLastStep int64  `json:"-" gorm:"not null;default:0"`                // Último passo TOTP aceito, para impedir replay
+
+	// Telefone (E.164) e SMS como segundo fator
+	PhoneNumber        string     `json:"phone_number,omitempty"`
+	PhoneVerifiedAt    *time.Time `json:"phone_verified_at"`
+	PendingPhoneNumber string     `json:"-"` // Aguardando confirmação do código enviado por SMS
+	SMSMFAEnabled      bool       `json:"sms_mfa_enabled" gorm:"not null;default:false"`
+
+	// Perfil editável pelo próprio usuário com PATCH /api/perfil (ver profile.go); nulo quando não informado
+	DisplayName *string `json:"display_name"`
+	GivenName   *string `json:"given_name"`
+	FamilyName  *string `json:"family_name"`
+	Locale      *string `json:"locale"`   // Etiqueta BCP 47 canônica (ex.: pt-BR)
+	Timezone    *string `json:"timezone"` // Fuso horário IANA (ex.: America/Sao_Paulo)
+	Bio         *string `json:"bio"`
+	AvatarURL   *string `json:"avatar_url"` // Apenas https
+}
+
+// Invitation é um convite de cadastro. O código é guardado apenas como hash e mostrado uma única vez.
+type Invitation struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	CodeHash    string     `json:"-" gorm:"not null;uniqueIndex"`
+	Email       string     `json:"email,omitempty"` // Se preenchido, só vale para cadastro com este email
+	MaxUses     int        `json:"max_uses" gorm:"not null;default:1"`
+	Uses        int        `json:"uses" gorm:"not null;default:0"`
+	ExpiresAt   *time.Time `json:"expires_at"` // Nulo: sem prazo
+	CreatedByID uint       `json:"created_by_id" gorm:"not null;index"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+
+	OrganizationID *uint  `json:"organization_id,omitempty" gorm:"index"` // Se preenchido, o convidado entra nesta organização
+	OrgRole        string `json:"org_role,omitempty"`                     // Papel do convidado na organização
+}
+
+// Organization é um cliente (empresa) com seus próprios membros
+type Organization struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"not null"`
+	Slug      string    `json:"slug" gorm:"uniqueIndex;not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Membership liga um usuário a uma organização, com o papel dele nela (owner, admin ou member)
+type Membership struct {
+	ID             uint          `json:"id" gorm:"primaryKey"`
+	OrganizationID uint          `json:"organization_id" gorm:"not null;uniqueIndex:idx_membership"`
+	UserID         uint          `json:"user_id" gorm:"not null;uniqueIndex:idx_membership;index"`
+	Role           string        `json:"role" gorm:"not null"`
+	CreatedAt      time.Time     `json:"created_at"`
+	Organization   *Organization `json:"organization,omitempty"`
+	User           *User         `json:"user,omitempty"`
+}
+
+// AuditEvent é um registro do histórico de segurança da conta (logins, bloqueios, suspensões...)
+type AuditEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"` // Conta afetada
+	ActorID   *uint     `json:"actor_id,omitempty"`            // Quem agiu, se não foi o próprio usuário
+	Action    string    `json:"action" gorm:"not null;index"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Details   string    `json:"details,omitempty"` // JSON com dados adicionais da ação
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// DataExport é um pedido de exportação dos dados pessoais do usuário, gerado em segundo plano
+type DataExport struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"-" gorm:"not null;index"`
+	Status      string     `json:"status" gorm:"not null;index"` // pending, ready, failed
+	FilePath    string     `json:"-"`
+	TokenHash   string     `json:"-" gorm:"index"` // Hash do token do link de download
+	Error       string     `json:"error,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at"` // Validade do link de download (definida quando fica pronto)
+	CompletedAt *time.Time `json:"completed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// ErasureReceipt comprova que os dados pessoais de uma conta foram apagados. Não contém dados pessoais.
+type ErasureReceipt struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	UserID        uint      `json:"user_id" gorm:"not null;uniqueIndex"` // Conta anonimizada
+	Reason        string    `json:"reason" gorm:"not null"`              // user_request, admin_request ou retention_expired
+	RequestedByID *uint     `json:"requested_by_id,omitempty"`           // Administrador que pediu o apagamento
+	Categories    string    `json:"categories" gorm:"not null"`          // Categorias de dados tratadas, separadas por vírgula
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Permission é uma permissão do catálogo (ver rbac.go), no formato "recurso:ação"
+type Permission struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	Name        string `json:"name" gorm:"uniqueIndex;not null"`
+	Description string `json:"description"`
+}
+
+// Role agrupa permissões e é atribuído a usuários
+type Role struct {
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	Name        string       `json:"name" gorm:"uniqueIndex;not null"`
+	Description string       `json:"description"`
+	System      bool         `json:"system" gorm:"not null;default:false"` // Papéis do sistema não podem ser alterados nem removidos
+	Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// UserRole atribui um papel a um usuário
+type UserRole struct {
+	UserID       uint      `json:"user_id" gorm:"primaryKey"`
+	RoleID       uint      `json:"role_id" gorm:"primaryKey;index"`
+	AssignedByID *uint     `json:"assigned_by_id"` // Nulo quando atribuído pelo sistema (migração ou CLI)
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Group reúne usuários e outros grupos; seus papéis valem para todos os membros, diretos ou herdados
+type Group struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"uniqueIndex;not null"`
+	Description string    `json:"description"`
+	Roles       []Role    `json:"roles" gorm:"many2many:group_roles"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// GroupUser coloca um usuário diretamente em um grupo
+type GroupUser struct {
+	GroupID   uint      `json:"group_id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"primaryKey;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GroupSubgroup coloca o grupo ChildID dentro do grupo ParentID: os membros do filho também são do pai
+type GroupSubgroup struct {
+	ParentID  uint      `json:"parent_id" gorm:"primaryKey"`
+	ChildID   uint      `json:"child_id" gorm:"primaryKey;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RelationTuple é uma tupla de relação no estilo Zanzibar: o sujeito tem a relação com o objeto
+// (ex.: document:readme#editor@team:eng#member). Usuários deste serviço são o sujeito "user:<id>".
+type RelationTuple struct {
+	ID               uint      `json:"-" gorm:"primaryKey"`
+	Namespace        string    `json:"namespace" gorm:"not null;uniqueIndex:idx_relation_tuple"`
+	ObjectID         string    `json:"object_id" gorm:"not null;uniqueIndex:idx_relation_tuple"`
+	Relation         string    `json:"relation" gorm:"not null;uniqueIndex:idx_relation_tuple"`
+	SubjectNamespace string    `json:"subject_namespace" gorm:"not null;uniqueIndex:idx_relation_tuple;index:idx_relation_subject"`
+	SubjectObjectID  string    `json:"subject_object_id" gorm:"not null;uniqueIndex:idx_relation_tuple;index:idx_relation_subject"`
+	SubjectRelation  string    `json:"subject_relation,omitempty" gorm:"not null;default:'';uniqueIndex:idx_relation_tuple"` // Vazio: o próprio objeto
+	CreatedByID      *uint     `json:"created_by_id,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// DataMigration registra uma migração de dados já aplicada ao banco (ver migrations.go)
+type DataMigration struct {
+	Name      string    `gorm:"primaryKey"`
+	Rows      int       `gorm:"not null;default:0"` // Linhas ajustadas
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// LegalDocument é uma versão de um documento legal (termos de uso, política de privacidade).
+// A versão em vigor de cada tipo é a mais recente com EffectiveAt já alcançado.
+type LegalDocument struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Kind        string    `json:"kind" gorm:"not null;uniqueIndex:idx_legal_kind_version"` // terms ou privacy
+	Version     string    `json:"version" gorm:"not null;uniqueIndex:idx_legal_kind_version"`
+	Title       string    `json:"title" gorm:"not null"`
+	URL         string    `json:"url" gorm:"not null"` // Onde o texto integral desta versão é publicado
+	EffectiveAt time.Time `json:"effective_at" gorm:"not null;index"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// LegalAcceptance registra o aceite de uma versão de documento legal por um usuário
+type LegalAcceptance struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	UserID     uint      `json:"-" gorm:"not null;uniqueIndex:idx_legal_acceptance"`
+	DocumentID uint      `json:"document_id" gorm:"not null;uniqueIndex:idx_legal_acceptance"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	AcceptedAt time.Time `json:"accepted_at"`
+}
+
+// RecoveryCode é um código de recuperação MFA de uso único (armazenado como hash)
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// WebAuthnCredential é uma chave de acesso (passkey) registrada pelo usuário
+type WebAuthnCredential struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	UserID          uint       `json:"user_id" gorm:"not null;index"`
+	Name            string     `json:"name"`
+	CredentialID    []byte     `json:"-" gorm:"not null;uniqueIndex"`
+	PublicKey       []byte     `json:"-" gorm:"not null"` // Chave pública COSE
+	AttestationType string     `json:"attestation_type"`
+	AAGUID          []byte     `json:"-"`
+	SignCount       uint32     `json:"sign_count" gorm:"not null;default:0"`
+	CloneWarning    bool       `json:"clone_warning" gorm:"not null;default:false"` // O último uso teve contador suspeito
+	BackupEligible  bool       `json:"backup_eligible" gorm:"not null;default:false"`
+	BackupState     bool       `json:"backup_state" gorm:"not null;default:false"`
+	Transports      string     `json:"transports"` // Separados por vírgula (usb, nfc, internal...)
+	LastUsedAt      *time.Time `json:"last_used_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// WebAuthnSession guarda o desafio de uma cerimônia WebAuthn em andamento
+type WebAuthnSession struct {
+	ID        string    `gorm:"primaryKey"` // Identificador opaco devolvido ao cliente como session_id
+	UserID    *uint     `gorm:"index"`      // Nulo no login sem senha (credencial descoberta)
+	Purpose   string    `gorm:"not null"`
+	Data      string    `gorm:"not null"` // webauthn.SessionData em JSON
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+// TrustedDevice é um dispositivo em que o usuário pediu para não repetir o segundo fator
+type TrustedDevice struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"-" gorm:"not null;index"`
+	Name       string     `json:"name"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// OneTimeToken é um token de uso único enviado ao usuário (ex.: link mágico), opcionalmente
+// acompanhado de um código numérico curto. Somente os hashes são armazenados.
+type OneTimeToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	Purpose   string    `gorm:"not null;index"`
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	CodeHash  string    // Vazio quando o token não tem código alternativo
+	Target    string    // Hash do destino (ex.: telefone) para o qual o código vale; vazio se não houver
+	Attempts  int       `gorm:"not null;default:0"` // Verificações de código realizadas
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
 }
 
 // Para payload de registro
 type RegisterRequest struct {
-	Username string `json:"username" validate:"required,min=3,max=30"`
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6"`
+	Username   string `json:"username" validate:"required,min=3,max=30"`
+	Email      string `json:"email" validate:"required,email"`
+	Password   string `json:"password" validate:"required,min=6"`
+	InviteCode string `json:"invite_code"` // Obrigatório quando REGISTRATION_MODE=invite
+
+	AcceptedDocuments []uint `json:"accepted_documents"` // IDs das versões em vigor dos documentos legais
 }
 
 // Para payload de login
@@ -25,6 +305,153 @@ type LoginRequest struct {
 	Password string `json:"password" validate:"required"`
 }
 
+// Para payload de criação de convite
+type CreateInvitationRequest struct {
+	Email     string     `json:"email" validate:"omitempty,email"`
+	MaxUses   int        `json:"max_uses" validate:"omitempty,min=1,max=10000"` // Padrão: 1
+	ExpiresAt *time.Time `json:"expires_at"`                                    // Padrão: INVITATION_TTL a partir de agora
+}
+
+// Resposta da criação de convite: o código só aparece aqui
+type CreateInvitationResponse struct {
+	Invitation *Invitation `json:"invitation"`
+	Code       string      `json:"code"`
+}
+
+// Para payload de apagamento da própria conta
+type EraseAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+	Confirm  bool   `json:"confirm" validate:"eq=true"` // Confirmação explícita: a operação é irreversível
+}
+
+// Para payload de aceite de documentos legais
+type AcceptLegalDocumentsRequest struct {
+	DocumentIDs []uint `json:"document_ids" validate:"required,min=1"`
+}
+
+// Para payload de publicação de nova versão de documento legal (administrador)
+type CreateLegalDocumentRequest struct {
+	Kind        string     `json:"kind" validate:"required,oneof=terms privacy"`
+	Version     string     `json:"version" validate:"required,max=50"`
+	Title       string     `json:"title" validate:"required,max=200"`
+	URL         string     `json:"url" validate:"required,url"`
+	EffectiveAt *time.Time `json:"effective_at"` // Padrão: agora
+}
+
+// Para payload de criação de organização
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+	Slug string `json:"slug" validate:"required,min=2,max=50"` // Letras minúsculas, números e hífens
+}
+
+// Para payload de convite para a organização ativa
+type CreateOrganizationInvitationRequest struct {
+	CreateInvitationRequest
+	Role string `json:"role" validate:"omitempty,oneof=owner admin member"` // Padrão: member
+}
+
+// Para payload de alteração do papel de um membro da organização
+type UpdateMembershipRequest struct {
+	Role string `json:"role" validate:"required,oneof=owner admin member"`
+}
+
+// Para payload de entrada em uma organização com código de convite (conta já existente)
+type JoinOrganizationRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// Para payload de criação de grupo (administrador)
+type CreateGroupRequest struct {
+	Name        string `json:"name" validate:"required,min=2,max=50"`
+	Description string `json:"description" validate:"max=200"`
+	RoleIDs     []uint `json:"role_ids"`
+}
+
+// Para payload de alteração de grupo (administrador); campos nulos não são alterados
+type UpdateGroupRequest struct {
+	Description *string `json:"description" validate:"omitempty,max=200"`
+	RoleIDs     []uint  `json:"role_ids"` // Se presente, substitui todos os papéis do grupo
+}
+
+// Para payload de gravação de tupla de relação (e parâmetros de consulta da remoção)
+type RelationTupleRequest struct {
+	Object   string `json:"object" form:"object" validate:"required"`     // namespace:id
+	Relation string `json:"relation" form:"relation" validate:"required"` // Relação definida no esquema
+	Subject  string `json:"subject" form:"subject" validate:"required"`   // namespace:id ou namespace:id#relacao
+}
+
+// Para payload de consulta check (o sujeito padrão é o usuário logado)
+type RelationCheckRequest struct {
+	Object   string `json:"object" validate:"required"`
+	Relation string `json:"relation" validate:"required"`
+	Subject  string `json:"subject"`
+}
+
+// Para payload de consulta expand
+type RelationExpandRequest struct {
+	Object   string `json:"object" validate:"required"`
+	Relation string `json:"relation" validate:"required"`
+}
+
+// Para payload de consulta list-objects (o sujeito padrão é o usuário logado)
+type RelationListObjectsRequest struct {
+	Namespace string `json:"namespace" validate:"required"`
+	Relation  string `json:"relation" validate:"required"`
+	Subject   string `json:"subject"`
+	Limit     int    `json:"limit" validate:"omitempty,min=1,max=1000"` // Padrão: 100
+	Cursor    string `json:"cursor"`                                    // next_cursor da página anterior
+}
+
+// Para parâmetros de consulta da listagem de tuplas de relação; campos vazios não filtram
+type ListRelationTuplesRequest struct {
+	Object   string `form:"object"` // namespace ou namespace:id
+	Relation string `form:"relation"`
+	Subject  string `form:"subject"` // namespace:id ou namespace:id#relacao
+}
+
+// Para parâmetros de consulta da listagem de usuários (administrador)
+type ListUsersRequest struct {
+	Limit       int        `form:"limit" validate:"omitempty,min=1,max=100"`
+	Cursor      string     `form:"cursor"`                                               // next_cursor da página anterior
+	Status      string     `form:"status"`                                               // Um ou mais estados, separados por vírgula
+	CreatedFrom *time.Time `form:"created_from" time_format:"2006-01-02T15:04:05Z07:00"` // Inclusivo
+	CreatedTo   *time.Time `form:"created_to" time_format:"2006-01-02T15:04:05Z07:00"`   // Exclusivo
+	Verified    *bool      `form:"verified"`                                             // Email confirmado ou não
+	Role        string     `form:"role"`                                                 // Nome do papel, direto ou herdado de grupo
+	Sort        string     `form:"sort" validate:"omitempty,oneof=id -id created_at -created_at username -username email -email"`
+	Q           string     `form:"q" validate:"max=100"` // Busca por trecho do nome de usuário ou do email
+}
+
+// Para payload de criação de papel (administrador)
+type CreateRoleRequest struct {
+	Name        string   `json:"name" validate:"required,min=2,max=50"`
+	Description string   `json:"description" validate:"max=200"`
+	Permissions []string `json:"permissions"`
+}
+
+// Para payload de alteração de papel (administrador); campos nulos não são alterados
+type UpdateRoleRequest struct {
+	Description *string  `json:"description" validate:"omitempty,max=200"`
+	Permissions []string `json:"permissions"` // Se presente, substitui todas as permissões do papel
+}
+
+// Para payload de atribuição de papel a um usuário (administrador)
+type AssignRoleRequest struct {
+	RoleID uint `json:"role_id" validate:"required"`
+}
+
+// Para payload de suspensão de conta (administrador)
+type SuspendUserRequest struct {
+	Reason string     `json:"reason" validate:"required,max=500"`
+	Until  *time.Time `json:"until"` // Opcional (RFC 3339); sem prazo, a suspensão vale até a reativação
+}
+
+// Para payload de restauração de uma conta excluída
+type RestoreAccountRequest struct {
+	Username string `json:"username" validate:"required"` // Nome de usuário ou email
+	Password string `json:"password" validate:"required"`
+}
+
 // Para payload de atualização de usuário (campos opcionais)
 type UpdateUserRequest struct {
 	Username *string `json:"username" validate:"omitempty,min=3,max=30"` // Ponteiro para indicar que é opcional
@@ -32,7 +459,127 @@ type UpdateUserRequest struct {
 	Password *string `json:"password" validate:"omitempty,min=6"`
 }
 
+// Para payload de confirmação de email
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// Para payload de reenvio do email de confirmação
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// Para payload de solicitação de login por link mágico
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// Para payload de verificação do link mágico (token do link ou email + código de 6 dígitos)
+type MagicLinkVerifyRequest struct {
+	Token string `json:"token" validate:"required_without=Code"`
+	Email string `json:"email" validate:"required_with=Code,omitempty,email"`
+	Code  string `json:"code" validate:"omitempty,len=6,numeric"`
+}
+
+// Para payload de cadastro/troca de telefone
+type PhoneNumberRequest struct {
+	PhoneNumber string `json:"phone_number" validate:"required,e164"`
+}
+
+// Para payload de confirmação de código recebido por SMS
+type SMSCodeRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// Para payload de confirmação de senha em operações sensíveis
+type PasswordConfirmRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// Para payload de envio do código SMS no desafio MFA
+type SMSMFASendRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+}
+
+// Para payload de confirmação/desativação do TOTP e da troca dos códigos de recuperação
+type TOTPCodeRequest struct {
+	Password string `json:"password" validate:"required"` // Senha atual: o token de acesso sozinho não altera o segundo fator
+	Code     string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// Para payload da segunda etapa do login (desafio MFA)
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Method   string `json:"method" validate:"omitempty,oneof=totp recovery_code sms"` // Padrão: totp (passkeys usam /auth/login/mfa/webauthn)
+	Code     string `json:"code" validate:"required"`
+
+	RememberDevice bool   `json:"remember_device"` // Dispensa o segundo fator neste dispositivo por um período
+	DeviceName     string `json:"device_name" validate:"omitempty,max=64"`
+}
+
+// Para payload de resposta do cadastro TOTP
+type TOTPEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+	QRCodePNG  string `json:"qr_code_png"` // data URI (data:image/png;base64,...)
+}
+
+// Para payload de conclusão do registro de passkey
+type WebAuthnRegisterFinishRequest struct {
+	SessionID  string          `json:"session_id" validate:"required"`
+	Name       string          `json:"name" validate:"omitempty,max=64"` // Apelido para identificar o dispositivo
+	Credential json.RawMessage `json:"credential" validate:"required"`   // Resposta de navigator.credentials.create()
+}
+
+// Para payload de início do login com passkey como segundo fator
+type WebAuthnMFABeginRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+}
+
+// Para payload de conclusão do login com passkey (sem senha ou como segundo fator)
+type WebAuthnLoginFinishRequest struct {
+	MFAToken   string          `json:"mfa_token"` // Somente no uso como segundo fator
+	SessionID  string          `json:"session_id" validate:"required"`
+	Credential json.RawMessage `json:"credential" validate:"required"` // Resposta de navigator.credentials.get()
+
+	RememberDevice bool   `json:"remember_device"` // Somente no uso como segundo fator
+	DeviceName     string `json:"device_name" validate:"omitempty,max=64"`
+}
+
+// Para payload de resposta do início de uma cerimônia WebAuthn
+type WebAuthnBeginResponse struct {
+	SessionID string      `json:"session_id"`
+	Options   interface{} `json:"options"` // Repassar a navigator.credentials.create()/get()
+}
+
+// Para payload de resposta com novos códigos de recuperação (exibidos uma única vez)
+type RecoveryCodesResponse struct {
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Para payload de resposta do perfil do usuário logado
+type ProfileResponse struct {
+	*User
+	RecoveryCodesRemaining int64    `json:"recovery_codes_remaining"`
+	Roles                  []string `json:"roles"`
+	Permissions            []string `json:"permissions"`
+	Groups                 []string `json:"groups"`
+}
+
+// Para payload de resposta da listagem de usuários (administrador)
+type UserListResponse struct {
+	Users         []User  `json:"users"`
+	NextCursor    *string `json:"next_cursor"`    // Nulo na última página
+	TotalEstimate int64   `json:"total_estimate"` // Usuários que atendem aos filtros no momento da consulta
+}
+
 // Para payload de resposta de login
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token       string   `json:"token,omitempty"`
+	MFARequired bool     `json:"mfa_required,omitempty"`
+	MFAToken    string   `json:"mfa_token,omitempty"`   // Deve ser enviado a /auth/login/mfa junto com o código
+	MFAMethods  []string `json:"mfa_methods,omitempty"` // Métodos aceitos no desafio
+
+	TrustedDeviceToken string `json:"trusted_device_token,omitempty"` // Também enviado no cookie trusted_device
 }
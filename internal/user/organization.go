@@ -0,0 +1,447 @@
+package user
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api_authentication/configs"
+)
+
+// Papéis de um membro dentro da organização
+const (
+	OrgRoleOwner  = "owner"  // Administra a organização e seus donos
+	OrgRoleAdmin  = "admin"  // Gerencia membros e convites
+	OrgRoleMember = "member" // Apenas participa
+)
+
+// orgRoleRank ordena os papéis: um papel inclui tudo o que os de menor posição podem fazer
+var orgRoleRank = map[string]int{
+	OrgRoleMember: 1,
+	OrgRoleAdmin:  2,
+	OrgRoleOwner:  3,
+}
+
+// Chaves do contexto preenchidas por LoadOrganization
+const (
+	orgIDKey   = "orgID"
+	orgRoleKey = "orgRole"
+)
+
+// errLastOrganizationOwner indica que a alteração deixaria a organização sem nenhum dono
+var errLastOrganizationOwner = errors.New("último dono da organização")
+
+// organizationSlugPattern restringe o identificador curto a minúsculas, números e hífens
+var organizationSlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// DefaultOrganizationSlug retorna a organização padrão (DEFAULT_ORGANIZATION_SLUG), que recebe
+// as contas antigas e os cadastros sem convite para outra organização
+func DefaultOrganizationSlug() string {
+	return configs.GetEnv("DEFAULT_ORGANIZATION_SLUG", "default")
+}
+
+// EnsureDefaultOrganization cria a organização padrão, se ainda não existir. Contas cadastradas
+// sem convite de organização entram nela (ver joinOrganizationOnRegister).
+func EnsureDefaultOrganization(repo UserRepository) (*Organization, error) {
+	org, err := repo.GetOrganizationBySlug(DefaultOrganizationSlug())
+	if err == gorm.ErrRecordNotFound {
+		org = &Organization{
+			Name: configs.GetEnv("DEFAULT_ORGANIZATION_NAME", "Organização padrão"),
+			Slug: DefaultOrganizationSlug(),
+		}
+		if err := repo.CreateOrganization(org, 0); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// MigrateDefaultOrganization coloca na organização padrão, como membros, as contas criadas antes das
+// organizações (instalações de um só cliente) e torna donos dela os titulares do papel admin.
+// Roda uma única vez, como migração de dados (ver migrations.go): quem for retirado da
+// organização depois não volta a ela.
+func MigrateDefaultOrganization(repo UserRepository) (int, error) {
+	org, err := EnsureDefaultOrganization(repo)
+	if err != nil {
+		return 0, err
+	}
+	added, err := repo.AddUsersWithoutMembership(org.ID, OrgRoleMember)
+	if err != nil {
+		return 0, err
+	}
+
+	role, err := repo.GetRoleByName(AdminRole)
+	if err == gorm.ErrRecordNotFound {
+		return int(added), nil // Sem administradores ainda: bootstrap-admin define o dono
+	} else if err != nil {
+		return int(added), err
+	}
+	return int(added), repo.PromoteRoleHoldersToOwner(org.ID, role.ID)
+}
+
+// LoadOrganization carrega no contexto a organização ativa e o papel do usuário nela.
+// Se o usuário saiu da organização do token (ou o token não tem uma), vale a mais antiga dele.
+func LoadOrganization(c *gin.Context, repo UserRepository, userID, claimedOrgID uint) error {
+	if claimedOrgID != 0 {
+		membership, err := repo.GetMembership(claimedOrgID, userID)
+		if err == nil {
+			c.Set(orgIDKey, membership.OrganizationID)
+			c.Set(orgRoleKey, membership.Role)
+			return nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+	}
+
+	memberships, err := repo.GetUserMemberships(userID)
+	if err != nil {
+		return err
+	}
+	if len(memberships) > 0 {
+		c.Set(orgIDKey, memberships[0].OrganizationID)
+		c.Set(orgRoleKey, memberships[0].Role)
+	}
+	return nil
+}
+
+// ActiveOrganization retorna a organização ativa e o papel do usuário nela (carregados por LoadOrganization)
+func ActiveOrganization(c *gin.Context) (uint, string, bool) {
+	orgID, exists := c.Get(orgIDKey)
+	if !exists {
+		return 0, "", false
+	}
+	return orgID.(uint), c.GetString(orgRoleKey), true
+}
+
+// HasOrgRole indica se o usuário tem, na organização ativa, pelo menos o papel informado.
+// Quem tem a permissão organizations:manage administra qualquer organização.
+func HasOrgRole(c *gin.Context, role string) bool {
+	if HasPermission(c, PermOrgsManage) {
+		return true
+	}
+	_, current, ok := ActiveOrganization(c)
+	return ok && orgRoleRank[current] >= orgRoleRank[role]
+}
+
+// defaultOrganizationID retorna a organização que fica ativa no login (a mais antiga do usuário)
+func (s *userServiceImpl) defaultOrganizationID(userID uint) uint {
+	memberships, err := s.repo.GetUserMemberships(userID)
+	if err != nil {
+		log.Printf("Erro ao buscar organizações do userID %d: %v", userID, err)
+		return 0
+	}
+	if len(memberships) == 0 {
+		return 0
+	}
+	return memberships[0].OrganizationID
+}
+
+// joinOrganizationOnRegister coloca o novo usuário na organização do convite ou, sem ela, na padrão
+func (s *userServiceImpl) joinOrganizationOnRegister(user *User, invitation *Invitation) error {
+	membership := &Membership{UserID: user.ID, Role: OrgRoleMember}
+	if invitation != nil && invitation.OrganizationID != nil {
+		membership.OrganizationID = *invitation.OrganizationID
+		membership.Role = invitation.OrgRole
+	} else {
+		org, err := s.repo.GetOrganizationBySlug(DefaultOrganizationSlug())
+		if err != nil {
+			return err
+		}
+		membership.OrganizationID = org.ID
+	}
+	_, err := s.repo.AddMembership(membership)
+	return err
+}
+
+// ListMyOrganizations lista as organizações do usuário logado, com o papel dele em cada uma
+func (s *userServiceImpl) ListMyOrganizations(c *gin.Context) {
+	memberships, err := s.repo.GetUserMemberships(c.MustGet("userID").(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao listar organizações."})
+		return
+	}
+	c.JSON(http.StatusOK, memberships)
+}
+
+// CreateOrganization cria uma organização tendo o usuário logado como dono
+func (s *userServiceImpl) CreateOrganization(c *gin.Context) {
+	var req CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	slug := strings.ToLower(strings.TrimSpace(req.Slug))
+	if !organizationSlugPattern.MatchString(slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "O identificador deve ter apenas letras minúsculas, números e hífens."})
+		return
+	}
+	if _, err := s.repo.GetOrganizationBySlug(slug); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"message": "Já existe uma organização com este identificador."})
+		return
+	} else if err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar organização existente."})
+		return
+	}
+
+	org := &Organization{Name: strings.TrimSpace(req.Name), Slug: slug}
+	if err := s.repo.CreateOrganization(org, c.MustGet("userID").(uint)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao criar organização."})
+		return
+	}
+	c.JSON(http.StatusCreated, org)
+}
+
+// SwitchOrganization emite um novo token de acesso com outra organização ativa
+func (s *userServiceImpl) SwitchOrganization(c *gin.Context) {
+	orgID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de organização inválido."})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	if _, err := s.repo.GetMembership(uint(orgID), userID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Organização não encontrada."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar organização."})
+		return
+	}
+
+	token, err := s.generateAccessToken(userID, uint(orgID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar token JWT."})
+		return
+	}
+	c.JSON(http.StatusOK, LoginResponse{Token: token})
+}
+
+// JoinOrganization faz o usuário logado entrar na organização de um convite
+func (s *userServiceImpl) JoinOrganization(c *gin.Context) {
+	var req JoinOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	invitation, err := s.findInvitation(req.Code, user.Email)
+	if err == nil && invitation.OrganizationID == nil {
+		err = errInvalidInvitation // Convite apenas de cadastro
+	}
+	if err != nil {
+		if err == errInvalidInvitation {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Convite inválido ou expirado."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar convite."})
+		return
+	}
+
+	if _, err := s.repo.GetMembership(*invitation.OrganizationID, user.ID); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"message": "Você já é membro desta organização."})
+		return
+	} else if err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar organização."})
+		return
+	}
+
+	used, err := s.repo.UseInvitation(invitation.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar convite."})
+		return
+	}
+	if !used {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Convite inválido ou expirado."})
+		return
+	}
+
+	membership := &Membership{OrganizationID: *invitation.OrganizationID, UserID: user.ID, Role: invitation.OrgRole}
+	added, err := s.repo.AddMembership(membership)
+	if err != nil || !added {
+		if releaseErr := s.repo.ReleaseInvitation(invitation.ID); releaseErr != nil {
+			log.Printf("Erro ao devolver uso do convite %d: %v", invitation.ID, releaseErr)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao entrar na organização."})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"message": "Você já é membro desta organização."})
+		return
+	}
+
+	c.JSON(http.StatusOK, membership)
+}
+
+// GetActiveOrganization retorna a organização ativa do token e o papel do usuário nela
+func (s *userServiceImpl) GetActiveOrganization(c *gin.Context) {
+	orgID, role, ok := ActiveOrganization(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Nenhuma organização ativa."})
+		return
+	}
+
+	org, err := s.repo.GetOrganizationByID(orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar organização."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"organization": org, "role": role})
+}
+
+// ListOrganizationMembers lista os membros da organização ativa (apenas dela)
+func (s *userServiceImpl) ListOrganizationMembers(c *gin.Context) {
+	orgID, _, _ := ActiveOrganization(c)
+	members, err := s.repo.GetOrganizationMembers(orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao listar membros."})
+		return
+	}
+	c.JSON(http.StatusOK, members)
+}
+
+// CreateOrganizationInvitation convida alguém para a organização ativa.
+// Apenas donos convidam novos donos. Os limites são os de CreateInvitation: o convite também
+// cria contas, então só quem tem invitations:manage define usos e prazo.
+func (s *userServiceImpl) CreateOrganizationInvitation(c *gin.Context) {
+	var req CreateOrganizationInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	if req.Email != "" && !s.normalizeIdentifiers(c, nil, &req.Email) {
+		return
+	}
+	if req.Role == "" {
+		req.Role = OrgRoleMember
+	}
+	if req.Role == OrgRoleOwner && !HasOrgRole(c, OrgRoleOwner) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Apenas donos podem convidar novos donos."})
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+	orgID, _, _ := ActiveOrganization(c)
+	org, err := s.repo.GetOrganizationByID(orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar organização."})
+		return
+	}
+
+	s.createInvitation(c, user, req.CreateInvitationRequest, HasPermission(c, PermInvitationsManage), org, req.Role)
+}
+
+// UpdateOrganizationMember altera o papel de um membro da organização ativa.
+// Apenas donos mexem com o papel owner, e a organização nunca fica sem dono.
+func (s *userServiceImpl) UpdateOrganizationMember(c *gin.Context) {
+	var req UpdateMembershipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	membership := s.targetMembership(c)
+	if membership == nil {
+		return
+	}
+	if (req.Role == OrgRoleOwner || membership.Role == OrgRoleOwner) && !HasOrgRole(c, OrgRoleOwner) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Apenas donos podem alterar o papel de dono."})
+		return
+	}
+
+	err := s.repo.UpdateMembershipRole(membership.OrganizationID, membership.UserID, req.Role)
+	if err == errLastOrganizationOwner {
+		c.JSON(http.StatusConflict, gin.H{"message": "A organização precisa de pelo menos um dono."})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atualizar membro."})
+		return
+	}
+	membership.Role = req.Role
+	c.JSON(http.StatusOK, membership)
+}
+
+// RemoveOrganizationMember retira um membro da organização ativa
+func (s *userServiceImpl) RemoveOrganizationMember(c *gin.Context) {
+	membership := s.targetMembership(c)
+	if membership == nil {
+		return
+	}
+	if membership.Role == OrgRoleOwner && !HasOrgRole(c, OrgRoleOwner) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Apenas donos podem remover donos."})
+		return
+	}
+
+	_, err := s.repo.RemoveMembership(membership.OrganizationID, membership.UserID)
+	if err == errLastOrganizationOwner {
+		c.JSON(http.StatusConflict, gin.H{"message": "A organização precisa de pelo menos um dono."})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao remover membro."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Membro removido com sucesso!"})
+}
+
+// targetMembership carrega, na organização ativa, o vínculo do usuário do parâmetro :userId.
+// Membros de outras organizações respondem 404, como se não existissem.
+func (s *userServiceImpl) targetMembership(c *gin.Context) *Membership {
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de usuário inválido."})
+		return nil
+	}
+
+	orgID, _, _ := ActiveOrganization(c)
+	membership, err := s.repo.GetMembership(orgID, uint(userID))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Membro não encontrado."})
+			return nil
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar membro."})
+		return nil
+	}
+	return membership
+}
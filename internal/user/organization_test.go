@@ -0,0 +1,143 @@
+package user
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"api_authentication/internal/emailpolicy"
+)
+
+func TestOrganizationInvitationLimits(t *testing.T) {
+	_, s := newTestService(t)
+	orgAdmin := createTestUser(t, s.repo, "orgadmin")
+	org := &Organization{Name: "Acme", Slug: "acme"}
+	if err := s.repo.CreateOrganization(org, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.POST("/org/invitations", func(c *gin.Context) {
+		c.Set("userID", orgAdmin.ID)
+		c.Set(orgIDKey, org.ID)
+		c.Set(orgRoleKey, OrgRoleAdmin)
+	}, s.CreateOrganizationInvitation)
+
+	// Sem invitations:manage, o convite da organização tem os mesmos limites dos demais
+	custom := CreateOrganizationInvitationRequest{CreateInvitationRequest: CreateInvitationRequest{MaxUses: 10000}}
+	if code, _ := doJSON(t, r, "POST", "/org/invitations", custom); code != http.StatusForbidden {
+		t.Errorf("convite com usos próprios: esperado 403, obtido %d", code)
+	}
+	code, body := doJSON(t, r, "POST", "/org/invitations", CreateOrganizationInvitationRequest{})
+	if code != http.StatusCreated {
+		t.Fatalf("convite padrão: %d %v", code, body)
+	}
+	if invitation := body["invitation"].(map[string]interface{}); invitation["max_uses"] != float64(1) {
+		t.Errorf("convite padrão com %v usos", invitation["max_uses"])
+	}
+}
+
+func TestMigrateDefaultOrganizationRunsOnce(t *testing.T) {
+	_, s := newTestService(t)
+	admin := createTestUser(t, s.repo, "admin")
+	member := createTestUser(t, s.repo, "member")
+	role := adminRole(t, s)
+	if _, err := s.repo.AssignRole(admin.ID, role.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := emailpolicy.NewPolicyFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RunDataMigrations(s.repo, policy); err != nil {
+		t.Fatal(err)
+	}
+	org, err := s.repo.GetOrganizationBySlug(DefaultOrganizationSlug())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owners, err := s.repo.CountOrganizationOwners(org.ID); err != nil || owners != 1 {
+		t.Errorf("organização padrão com %d dono(s): %v", owners, err)
+	}
+
+	// Quem sai da organização não volta a ela nas próximas inicializações
+	if _, err := s.repo.RemoveMembership(org.ID, member.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunDataMigrations(s.repo, policy); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.repo.GetMembership(org.ID, member.ID); err == nil {
+		t.Error("membro retirado foi colocado de volta na organização padrão")
+	}
+}
+
+// ownerLeavesBeforeWriteRepository retira outro dono logo antes de gravar a alteração do vínculo,
+// simulando a saída concorrente de um dono entre a leitura e a escrita
+type ownerLeavesBeforeWriteRepository struct {
+	UserRepository
+	t         *testing.T
+	otherUser uint
+}
+
+func (r ownerLeavesBeforeWriteRepository) leave(orgID uint) {
+	if _, err := r.UserRepository.RemoveMembership(orgID, r.otherUser); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+func (r ownerLeavesBeforeWriteRepository) UpdateMembershipRole(orgID, userID uint, role string) error {
+	r.leave(orgID)
+	return r.UserRepository.UpdateMembershipRole(orgID, userID, role)
+}
+
+func (r ownerLeavesBeforeWriteRepository) RemoveMembership(orgID, userID uint) (bool, error) {
+	r.leave(orgID)
+	return r.UserRepository.RemoveMembership(orgID, userID)
+}
+
+func TestOrganizationKeepsOwnerUnderConcurrentChanges(t *testing.T) {
+	_, s := newTestService(t)
+	alice := createTestUser(t, s.repo, "alice")
+	org := &Organization{Name: "Acme", Slug: "acme"}
+	if err := s.repo.CreateOrganization(org, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	repo := s.repo
+
+	r := gin.New()
+	path := "/org/members/" + strconv.FormatUint(uint64(alice.ID), 10)
+	for _, tc := range []struct {
+		method string
+		body   interface{}
+	}{
+		{"PUT", UpdateMembershipRequest{Role: OrgRoleAdmin}},
+		{"DELETE", nil},
+	} {
+		bob := createTestUser(t, repo, "bob-"+tc.method)
+		if _, err := repo.AddMembership(&Membership{OrganizationID: org.ID, UserID: bob.ID, Role: OrgRoleOwner}); err != nil {
+			t.Fatal(err)
+		}
+		s.repo = ownerLeavesBeforeWriteRepository{UserRepository: repo, t: t, otherUser: bob.ID}
+		handler := s.UpdateOrganizationMember
+		if tc.method == "DELETE" {
+			handler = s.RemoveOrganizationMember
+		}
+		r.Handle(tc.method, "/org/members/:userId", func(c *gin.Context) {
+			c.Set("userID", alice.ID)
+			c.Set(orgIDKey, org.ID)
+			c.Set(orgRoleKey, OrgRoleOwner)
+		}, handler)
+
+		if code, _ := doJSON(t, r, tc.method, path, tc.body); code != http.StatusConflict {
+			t.Errorf("%s do último dono: esperado 409, obtido %d", tc.method, code)
+		}
+		if owners, err := repo.CountOrganizationOwners(org.ID); err != nil || owners != 1 {
+			t.Fatalf("%s: organização com %d dono(s): %v", tc.method, owners, err)
+		}
+	}
+}
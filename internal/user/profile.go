@@ -0,0 +1,274 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+	"gorm.io/gorm"
+
+	"api_authentication/internal/identifier"
+)
+
+// mergePatchContentType é o tipo de mídia do JSON Merge Patch (RFC 7396)
+const mergePatchContentType = "application/merge-patch+json"
+
+// profileField é um campo de perfil editável: a coluna e a validação, que devolve o valor normalizado.
+// Campos required não podem ser limpos com null.
+type profileField struct {
+	column   string
+	validate func(string) (string, error)
+	required bool
+}
+
+// profileFields são os campos que o próprio usuário edita com PATCH /api/perfil
+var profileFields = map[string]profileField{
+	"display_name": {column: "display_name", validate: profileText(64, false)},
+	"given_name":   {column: "given_name", validate: profileText(64, false)},
+	"family_name":  {column: "family_name", validate: profileText(64, false)},
+	"locale":       {column: "locale", validate: validateLocale},
+	"timezone":     {column: "timezone", validate: validateTimezone},
+	"bio":          {column: "bio", validate: profileText(500, true)},
+	"avatar_url":   {column: "avatar_url", validate: validateAvatarURL},
+}
+
+// adminProfileFields são os campos que administradores editam com PATCH /api/admin/users/:id/profile:
+// os do perfil e o nome de usuário. Email, estado e MFA continuam com fluxo próprio.
+var adminProfileFields = func() map[string]profileField {
+	fields := map[string]profileField{
+		"username": {column: "username", validate: validateProfileUsername, required: true},
+	}
+	for name, field := range profileFields {
+		fields[name] = field
+	}
+	return fields
+}()
+
+// managedProfileFields aparecem no perfil mas não são alterados pelo merge patch do usuário: são
+// exclusivos de administradores (adminProfileFields e demais rotas /api/admin) ou têm fluxo
+// próprio com confirmação (email, telefone, MFA)
+var managedProfileFields = map[string]bool{
+	"id": true, "created_at": true, "updated_at": true,
+	"username": true, "email": true, "pending_email": true, "email_verified_at": true,
+	"status": true, "suspended_at": true, "suspended_until": true, "suspension_reason": true,
+	"phone_number": true, "phone_verified_at": true, "totp_enabled": true, "sms_mfa_enabled": true,
+	"roles": true, "permissions": true, "groups": true, "recovery_codes_remaining": true,
+}
+
+// PatchCurrentUserProfile altera o perfil do usuário logado com JSON Merge Patch (RFC 7396):
+// campos ausentes ficam como estão e null limpa o campo
+func (s *userServiceImpl) PatchCurrentUserProfile(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	if !s.patchProfile(c, userID, profileFields) {
+		return
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuário logado."})
+		return
+	}
+	s.respondProfile(c, user)
+}
+
+// AdminPatchUserProfile (rota de administrador) altera o perfil de outro usuário com JSON Merge Patch,
+// inclusive o nome de usuário (adminProfileFields)
+func (s *userServiceImpl) AdminPatchUserProfile(c *gin.Context) {
+	user := s.adminTargetUser(c)
+	if user == nil {
+		return
+	}
+	if !s.patchProfile(c, user.ID, adminProfileFields) {
+		return
+	}
+
+	user, err := s.repo.GetUserByID(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuário."})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// patchProfile lê o merge patch da requisição, valida cada campo contra a lista de campos
+// editáveis da rota e grava as alterações. Responde e retorna false se o patch for recusado.
+func (s *userServiceImpl) patchProfile(c *gin.Context, userID uint, editableFields map[string]profileField) bool {
+	if ct := c.ContentType(); ct != mergePatchContentType && ct != "application/json" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"message": "Use Content-Type " + mergePatchContentType + "."})
+		return false
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return false
+	}
+	// O perfil é um objeto: um patch que não seja objeto o substituiria por inteiro (RFC 7396)
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: o merge patch deve ser um objeto JSON."})
+		return false
+	}
+
+	var managed, unknown []string
+	fields := make(map[string]interface{}, len(patch))
+	fieldErrors := make(map[string]string)
+	for name, raw := range patch {
+		field, editable := editableFields[name]
+		if !editable {
+			if managedProfileFields[name] {
+				managed = append(managed, name)
+			} else {
+				unknown = append(unknown, name)
+			}
+			continue
+		}
+
+		// Só null limpa o campo; texto vazio é recusado em vez de virar null
+		if string(raw) == "null" {
+			if field.required {
+				fieldErrors[name] = "não pode ser removido"
+				continue
+			}
+			fields[field.column] = nil
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			fieldErrors[name] = "deve ser texto ou null"
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if value == "" {
+			fieldErrors[name] = "não pode ser vazio; use null para limpar o campo"
+			continue
+		}
+		normalized, err := field.validate(value)
+		if err != nil {
+			fieldErrors[name] = err.Error()
+			continue
+		}
+		fields[field.column] = normalized
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos desconhecidos: " + strings.Join(unknown, ", ")})
+		return false
+	}
+	if len(managed) > 0 {
+		sort.Strings(managed)
+		c.JSON(http.StatusForbidden, gin.H{"message": "Estes campos não podem ser alterados pelo perfil: " + strings.Join(managed, ", ")})
+		return false
+	}
+	if len(fieldErrors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos inválidos.", "errors": fieldErrors})
+		return false
+	}
+
+	if username, ok := fields["username"].(string); ok {
+		if !s.checkProfileUsername(c, userID, username) {
+			return false
+		}
+		fields["username_skeleton"] = identifier.Skeleton(username)
+	}
+
+	if len(fields) > 0 {
+		if err := s.repo.UpdateUserProfile(userID, fields); err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado."})
+				return false
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atualizar perfil."})
+			return false
+		}
+	}
+	return true
+}
+
+// checkProfileUsername aplica ao novo nome de usuário as mesmas verificações de UpdateUser
+func (s *userServiceImpl) checkProfileUsername(c *gin.Context, userID uint, username string) bool {
+	taken, err := s.repo.IsUsernameReserved(username, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar nome de usuário."})
+		return false
+	}
+	if taken { // Outro usuário (ativo ou excluído e restaurável) já usa o nome
+		c.JSON(http.StatusConflict, gin.H{"message": "Nome de usuário já em uso."})
+		return false
+	}
+	return s.checkUsername(c, username, userID)
+}
+
+// validateProfileUsername normaliza o nome de usuário com os limites de UpdateUserRequest
+func validateProfileUsername(value string) (string, error) {
+	normalized, err := identifier.NormalizeUsername(value)
+	if err != nil {
+		return "", errors.New("use letras, números e símbolos, sem espaços")
+	}
+	if n := utf8.RuneCountInString(normalized); n < 3 || n > 30 {
+		return "", errors.New("deve ter entre 3 e 30 caracteres")
+	}
+	return normalized, nil
+}
+
+// profileText valida texto livre de até max caracteres, sem caracteres de controle
+// (quebras de linha só quando multiline)
+func profileText(max int, multiline bool) func(string) (string, error) {
+	return func(value string) (string, error) {
+		if !utf8.ValidString(value) {
+			return "", errors.New("texto inválido")
+		}
+		if utf8.RuneCountInString(value) > max {
+			return "", errors.New("deve ter no máximo " + strconv.Itoa(max) + " caracteres")
+		}
+		for _, r := range value {
+			if unicode.IsControl(r) && !(multiline && r == '\n') {
+				return "", errors.New("contém caracteres não permitidos")
+			}
+		}
+		return value, nil
+	}
+}
+
+// validateLocale aceita etiquetas BCP 47 e devolve a forma canônica (ex.: pt-br vira pt-BR)
+func validateLocale(value string) (string, error) {
+	tag, err := language.Parse(value)
+	if err != nil {
+		return "", errors.New("idioma inválido: use uma etiqueta BCP 47, como pt-BR")
+	}
+	return tag.String(), nil
+}
+
+// validateTimezone aceita nomes de fuso horário IANA
+func validateTimezone(value string) (string, error) {
+	if value == "Local" {
+		return "", errors.New("fuso horário inválido: use um nome IANA, como America/Sao_Paulo")
+	}
+	if _, err := time.LoadLocation(value); err != nil {
+		return "", errors.New("fuso horário inválido: use um nome IANA, como America/Sao_Paulo")
+	}
+	return value, nil
+}
+
+// validateAvatarURL aceita apenas URLs https absolutas, sem credenciais
+func validateAvatarURL(value string) (string, error) {
+	if len(value) > 2048 {
+		return "", errors.New("deve ter no máximo 2048 caracteres")
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil {
+		return "", errors.New("deve ser uma URL https")
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,118 @@
+package user
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"api_authentication/internal/identifier"
+)
+
+// newProfileTestServer expõe as rotas de perfil com o userID informado no contexto
+func newProfileTestServer(t *testing.T, s *userServiceImpl, userID uint) *gin.Engine {
+	t.Helper()
+	reserved, err := identifier.NewReservedNamesFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.reservedNames = reserved
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("userID", userID) })
+	r.GET("/perfil", s.GetCurrentUser)
+	r.PATCH("/perfil", s.PatchCurrentUserProfile)
+	r.PATCH("/admin/users/:id/profile", s.AdminPatchUserProfile)
+	return r
+}
+
+func TestPatchProfileOnlyNullClears(t *testing.T) {
+	_, s := newTestService(t)
+	u := createTestUser(t, s.repo, "alice")
+	r := newProfileTestServer(t, s, u.ID)
+
+	if code, _ := doJSON(t, r, "PATCH", "/perfil", map[string]interface{}{"display_name": "Alice", "locale": "pt-br"}); code != http.StatusOK {
+		t.Fatalf("patch: esperado 200, obtido %d", code)
+	}
+	code, body := doJSON(t, r, "PATCH", "/perfil", map[string]interface{}{"display_name": "  "})
+	if code != http.StatusBadRequest {
+		t.Fatalf("texto vazio: esperado 400, obtido %d", code)
+	}
+	if errs, _ := body["errors"].(map[string]interface{}); errs["display_name"] == nil {
+		t.Errorf("texto vazio: erro do campo ausente em %v", body)
+	}
+
+	code, body = doJSON(t, r, "PATCH", "/perfil", map[string]interface{}{"display_name": nil})
+	if code != http.StatusOK {
+		t.Fatalf("null: esperado 200, obtido %d", code)
+	}
+	if _, ok := body["display_name"]; ok && body["display_name"] != nil {
+		t.Errorf("null deveria limpar display_name, obtido %v", body["display_name"])
+	}
+	if body["locale"] != "pt-BR" {
+		t.Errorf("campo ausente do patch deveria ficar como está, obtido %v", body["locale"])
+	}
+	if _, ok := body["recovery_codes_remaining"]; !ok {
+		t.Errorf("resposta deveria ser o perfil completo, obtido %v", body)
+	}
+}
+
+func TestPatchProfileRejectsManagedFields(t *testing.T) {
+	_, s := newTestService(t)
+	u := createTestUser(t, s.repo, "alice")
+	r := newProfileTestServer(t, s, u.ID)
+
+	if code, _ := doJSON(t, r, "PATCH", "/perfil", map[string]interface{}{"username": "mallory"}); code != http.StatusForbidden {
+		t.Errorf("username pelo perfil: esperado 403, obtido %d", code)
+	}
+	if code, _ := doJSON(t, r, "PATCH", "/perfil", map[string]interface{}{"nickname": "x"}); code != http.StatusBadRequest {
+		t.Errorf("campo desconhecido: esperado 400, obtido %d", code)
+	}
+}
+
+func TestAdminPatchProfileUsername(t *testing.T) {
+	_, s := newTestService(t)
+	admin := createTestUser(t, s.repo, "admin")
+	target := createTestUser(t, s.repo, "alice")
+	createTestUser(t, s.repo, "bob")
+	r := newProfileTestServer(t, s, admin.ID)
+	path := "/admin/users/" + strconv.FormatUint(uint64(target.ID), 10) + "/profile"
+
+	code, body := doJSON(t, r, "PATCH", path, map[string]interface{}{"username": "Alice2", "bio": "Olá"})
+	if code != http.StatusOK {
+		t.Fatalf("admin: esperado 200, obtido %d (%v)", code, body)
+	}
+	if body["username"] != "alice2" {
+		t.Errorf("nome de usuário deveria ser normalizado, obtido %v", body["username"])
+	}
+	updated, err := s.repo.GetUserByID(target.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.UsernameSkeleton != identifier.Skeleton("alice2") {
+		t.Errorf("esqueleto do nome não foi atualizado: %q", updated.UsernameSkeleton)
+	}
+
+	if code, _ := doJSON(t, r, "PATCH", path, map[string]interface{}{"username": "bob"}); code != http.StatusConflict {
+		t.Errorf("nome em uso: esperado 409, obtido %d", code)
+	}
+	if code, _ := doJSON(t, r, "PATCH", path, map[string]interface{}{"username": nil}); code != http.StatusBadRequest {
+		t.Errorf("username null: esperado 400, obtido %d", code)
+	}
+	if code, _ := doJSON(t, r, "PATCH", path, map[string]interface{}{"email": "x@example.com"}); code != http.StatusForbidden {
+		t.Errorf("email pelo perfil de administrador: esperado 403, obtido %d", code)
+	}
+}
+
+func TestUpdateUserProfileMissingUser(t *testing.T) {
+	_, s := newTestService(t)
+	u := createTestUser(t, s.repo, "alice")
+	if err := s.repo.DeleteUser(u.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.repo.UpdateUserProfile(u.ID, map[string]interface{}{"bio": "x"}); err == nil {
+		t.Error("esperado gorm.ErrRecordNotFound para conta excluída")
+	}
+}
@@ -0,0 +1,550 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api_authentication/internal/auth"
+	"api_authentication/internal/emailpolicy"
+	"api_authentication/internal/identifier"
+)
+
+// Permissões do catálogo, no formato "recurso:ação"
+const (
+	PermUsersRead         = "users:read"
+	PermUsersUpdate       = "users:update"
+	PermUsersDelete       = "users:delete"
+	PermUsersUnlock       = "users:unlock"
+	PermUsersRestore      = "users:restore"
+	PermUsersSuspend      = "users:suspend"
+	PermUsersErase        = "users:erase"
+	PermInvitationsManage = "invitations:manage"
+	PermLegalManage       = "legal:manage"
+	PermRolesManage       = "roles:manage"
+	PermOrgsManage        = "organizations:manage"
+	PermGroupsManage      = "groups:manage"
+	PermRelationsRead     = "relations:read"
+	PermRelationsWrite    = "relations:write"
+)
+
+// AdminRole é o papel do sistema que reúne todas as permissões do catálogo
+const AdminRole = "admin"
+
+// Chaves do contexto preenchidas por LoadAuthorization
+const (
+	rolesKey       = "roles"
+	permissionsKey = "permissions"
+)
+
+// Ações de auditoria sobre papéis
+const (
+	AuditRoleAssigned = "role.assigned"
+	AuditRoleRevoked  = "role.revoked"
+)
+
+// permissionCatalog descreve todas as permissões conhecidas pela aplicação
+var permissionCatalog = []Permission{
+	{Name: PermUsersRead, Description: "Ver os dados de qualquer usuário"},
+	{Name: PermUsersUpdate, Description: "Alterar os dados de qualquer usuário"},
+	{Name: PermUsersDelete, Description: "Excluir qualquer usuário"},
+	{Name: PermUsersUnlock, Description: "Desbloquear contas bloqueadas por tentativas de login"},
+	{Name: PermUsersRestore, Description: "Restaurar contas excluídas"},
+	{Name: PermUsersSuspend, Description: "Suspender e reativar contas"},
+	{Name: PermUsersErase, Description: "Apagar definitivamente os dados de uma conta"},
+	{Name: PermInvitationsManage, Description: "Listar e revogar convites e criar convites com vários usos ou prazo próprio"},
+	{Name: PermLegalManage, Description: "Publicar versões dos documentos legais"},
+	{Name: PermRolesManage, Description: "Gerenciar papéis e atribuí-los a usuários"},
+	{Name: PermOrgsManage, Description: "Administrar qualquer organização como se fosse dono dela"},
+	{Name: PermGroupsManage, Description: "Criar, alterar e remover grupos e seus membros (grupos que concedem papéis exigem também roles:manage)"},
+	{Name: PermRelationsRead, Description: "Consultar tuplas de relação e as relações de qualquer usuário"},
+	{Name: PermRelationsWrite, Description: "Gravar e remover tuplas de relação"},
+}
+
+// errLastRoleHolder indica que a revogação deixaria o papel sem nenhum titular
+var errLastRoleHolder = errors.New("último titular do papel")
+
+// SeedRBAC cria as permissões do catálogo e o papel admin (sempre com todas elas)
+func SeedRBAC(repo UserRepository) error {
+	if err := repo.EnsurePermissions(permissionCatalog); err != nil {
+		return fmt.Errorf("permissões: %w", err)
+	}
+	permissions, err := repo.GetPermissions()
+	if err != nil {
+		return fmt.Errorf("permissões: %w", err)
+	}
+
+	role, err := repo.GetRoleByName(AdminRole)
+	if err == gorm.ErrRecordNotFound {
+		role = &Role{Name: AdminRole, Description: "Acesso administrativo completo", System: true, Permissions: permissions}
+		if err := repo.CreateRole(role); err != nil {
+			return fmt.Errorf("papel %s: %w", AdminRole, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("papel %s: %w", AdminRole, err)
+	} else if err := repo.UpdateRole(role, permissions); err != nil {
+		return fmt.Errorf("papel %s: %w", AdminRole, err)
+	}
+
+	return nil
+}
+
+// MigrateLegacyAdmins atribui o papel admin às contas marcadas pela antiga coluna is_admin e
+// desmarca a coluna. Roda uma única vez, como migração de dados (ver migrations.go).
+func MigrateLegacyAdmins(repo UserRepository) (int, error) {
+	if err := SeedRBAC(repo); err != nil {
+		return 0, err
+	}
+	role, err := repo.GetRoleByName(AdminRole)
+	if err != nil {
+		return 0, fmt.Errorf("papel %s: %w", AdminRole, err)
+	}
+	return repo.MigrateLegacyAdmins(role.ID)
+}
+
+// BootstrapAdmin cria (ou promove, se o nome de usuário já existir) uma conta com o papel admin,
+// dona da organização padrão.
+// Usado pela linha de comando para o primeiro acesso administrativo.
+func BootstrapAdmin(repo UserRepository, emailPolicy *emailpolicy.Policy, username, email, password string) (*User, bool, error) {
+	if err := SeedRBAC(repo); err != nil {
+		return nil, false, err
+	}
+	role, err := repo.GetRoleByName(AdminRole)
+	if err != nil {
+		return nil, false, err
+	}
+
+	username, err = identifier.NormalizeUsername(username)
+	if err != nil {
+		return nil, false, err
+	}
+
+	user, err := repo.GetUserByUsername(username)
+	created := false
+	if err == gorm.ErrRecordNotFound {
+		if email, err = identifier.NormalizeEmail(email); err != nil {
+			return nil, false, err
+		}
+		if len(password) < 6 {
+			return nil, false, errors.New("a senha deve ter pelo menos 6 caracteres")
+		}
+		if taken, err := repo.IsEmailReserved(email, 0); err != nil {
+			return nil, false, err
+		} else if taken {
+			return nil, false, errors.New("email já cadastrado")
+		}
+
+		hashedPassword, err := auth.HashPassword(password)
+		if err != nil {
+			return nil, false, err
+		}
+		now := time.Now()
+		user = &User{
+			Username:         username,
+			Email:            email,
+			CanonicalEmail:   emailPolicy.Canonicalize(email),
+			Password:         hashedPassword,
+			Status:           StatusActive,
+			EmailVerifiedAt:  &now,
+			UsernameSkeleton: identifier.Skeleton(username),
+		}
+		if err := repo.CreateUser(user); err != nil {
+			return nil, false, err
+		}
+		created = true
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	if _, err := repo.AssignRole(user.ID, role.ID, nil); err != nil {
+		return nil, false, err
+	}
+
+	// O administrador é dono da organização padrão, que de outro modo não teria nenhum
+	org, err := EnsureDefaultOrganization(repo)
+	if err != nil {
+		return nil, false, err
+	}
+	if added, err := repo.AddMembership(&Membership{OrganizationID: org.ID, UserID: user.ID, Role: OrgRoleOwner}); err != nil {
+		return nil, false, err
+	} else if !added {
+		if err := repo.UpdateMembershipRole(org.ID, user.ID, OrgRoleOwner); err != nil {
+			return nil, false, err
+		}
+	}
+	return user, created, nil
+}
+
+// LoadAuthorization carrega no contexto os papéis e as permissões do usuário, incluindo os
+// herdados dos grupos efetivos, e os nomes desses grupos.
+// Chamado pelo AuthMiddleware a cada requisição, para que mudanças valham imediatamente.
+func LoadAuthorization(c *gin.Context, repo UserRepository, userID uint) error {
+	roles, groups, err := EffectiveRoles(repo, userID)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(roles))
+	permissions := make(map[string]struct{})
+	for _, role := range roles {
+		names = append(names, role.Name)
+		for _, p := range role.Permissions {
+			permissions[p.Name] = struct{}{}
+		}
+	}
+	c.Set(rolesKey, names)
+	c.Set(permissionsKey, permissions)
+	c.Set(groupsKey, groupNames(groups))
+	return nil
+}
+
+// EffectiveRoles retorna os papéis do usuário (atribuídos diretamente ou herdados de grupos,
+// sem repetição) e os grupos efetivos de onde vieram
+func EffectiveRoles(repo UserRepository, userID uint) ([]Role, []Group, error) {
+	roles, err := repo.GetUserRoles(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	groups, err := EffectiveGroups(repo, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(groups) == 0 {
+		return roles, groups, nil
+	}
+
+	ids := make([]uint, 0, len(groups))
+	for _, g := range groups {
+		ids = append(ids, g.ID)
+	}
+	inherited, err := repo.GetGroupRoles(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seen := make(map[uint]bool, len(roles))
+	for _, r := range roles {
+		seen[r.ID] = true
+	}
+	for _, r := range inherited {
+		if !seen[r.ID] {
+			seen[r.ID] = true
+			roles = append(roles, r)
+		}
+	}
+	return roles, groups, nil
+}
+
+// HasPermission indica se o usuário logado tem a permissão (carregada por LoadAuthorization)
+func HasPermission(c *gin.Context, permission string) bool {
+	value, exists := c.Get(permissionsKey)
+	if !exists {
+		return false
+	}
+	_, ok := value.(map[string]struct{})[permission]
+	return ok
+}
+
+// contextRoles retorna os nomes dos papéis do usuário logado
+func contextRoles(c *gin.Context) []string {
+	if value, exists := c.Get(rolesKey); exists {
+		return value.([]string)
+	}
+	return []string{}
+}
+
+// contextPermissions retorna as permissões do usuário logado, em ordem alfabética
+func contextPermissions(c *gin.Context) []string {
+	names := []string{}
+	if value, exists := c.Get(permissionsKey); exists {
+		for name := range value.(map[string]struct{}) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PolicyPrincipal descreve o usuário logado para as políticas de autorização (variável principal)
+func PolicyPrincipal(c *gin.Context, u *User) map[string]interface{} {
+	principal := map[string]interface{}{
+		"id":             int64(u.ID),
+		"username":       u.Username,
+		"email":          u.Email,
+		"status":         u.Status,
+		"email_verified": u.EmailVerifiedAt != nil,
+		"roles":          contextRoles(c),
+		"permissions":    contextPermissions(c),
+		"groups":         contextGroups(c),
+		"org_id":         int64(0),
+		"org_role":       "",
+	}
+	if orgID, orgRole, ok := ActiveOrganization(c); ok {
+		principal["org_id"] = int64(orgID)
+		principal["org_role"] = orgRole
+	}
+	return principal
+}
+
+// AdminListPermissions (rota de administrador) lista o catálogo de permissões
+func (s *userServiceImpl) AdminListPermissions(c *gin.Context) {
+	permissions, err := s.repo.GetPermissions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao listar permissões."})
+		return
+	}
+	c.JSON(http.StatusOK, permissions)
+}
+
+// AdminListRoles (rota de administrador) lista os papéis com suas permissões
+func (s *userServiceImpl) AdminListRoles(c *gin.Context) {
+	roles, err := s.repo.GetRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao listar papéis."})
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+// AdminCreateRole (rota de administrador) cria um papel
+func (s *userServiceImpl) AdminCreateRole(c *gin.Context) {
+	var req CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	name := strings.ToLower(strings.TrimSpace(req.Name))
+	if _, err := s.repo.GetRoleByName(name); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"message": "Já existe um papel com este nome."})
+		return
+	} else if err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar papel existente."})
+		return
+	}
+
+	permissions, ok := s.resolvePermissions(c, req.Permissions)
+	if !ok {
+		return
+	}
+
+	role := &Role{Name: name, Description: req.Description, Permissions: permissions}
+	if err := s.repo.CreateRole(role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao criar papel."})
+		return
+	}
+	c.JSON(http.StatusCreated, role)
+}
+
+// AdminUpdateRole (rota de administrador) altera a descrição e/ou as permissões de um papel
+func (s *userServiceImpl) AdminUpdateRole(c *gin.Context) {
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	role := s.targetRole(c)
+	if role == nil {
+		return
+	}
+	if role.System {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Papéis do sistema não podem ser alterados."})
+		return
+	}
+
+	permissions := role.Permissions
+	if req.Permissions != nil {
+		var ok bool
+		if permissions, ok = s.resolvePermissions(c, req.Permissions); !ok {
+			return
+		}
+	}
+	if req.Description != nil {
+		role.Description = *req.Description
+	}
+
+	if err := s.repo.UpdateRole(role, permissions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atualizar papel."})
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+// AdminDeleteRole (rota de administrador) remove um papel e suas atribuições
+func (s *userServiceImpl) AdminDeleteRole(c *gin.Context) {
+	role := s.targetRole(c)
+	if role == nil {
+		return
+	}
+	if role.System {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Papéis do sistema não podem ser removidos."})
+		return
+	}
+
+	if err := s.repo.DeleteRole(role.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao remover papel."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Papel removido com sucesso!"})
+}
+
+// AdminListUserRoles (rota de administrador) lista os papéis de um usuário
+func (s *userServiceImpl) AdminListUserRoles(c *gin.Context) {
+	user := s.adminTargetUser(c)
+	if user == nil {
+		return
+	}
+
+	roles, err := s.repo.GetUserRoles(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao listar papéis do usuário."})
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+// AdminAssignRole (rota de administrador) atribui um papel a um usuário
+func (s *userServiceImpl) AdminAssignRole(c *gin.Context) {
+	var req AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	user := s.adminTargetUser(c)
+	if user == nil {
+		return
+	}
+	role, err := s.repo.GetRoleByID(req.RoleID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Papel não encontrado."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar papel."})
+		return
+	}
+
+	adminID := c.MustGet("userID").(uint)
+	assigned, err := s.repo.AssignRole(user.ID, role.ID, &adminID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atribuir papel."})
+		return
+	}
+	if !assigned {
+		c.JSON(http.StatusOK, gin.H{"message": "O usuário já tem este papel."})
+		return
+	}
+
+	s.audit(c, user.ID, AuditRoleAssigned, map[string]interface{}{"role": role.Name})
+	c.JSON(http.StatusOK, gin.H{"message": "Papel atribuído com sucesso!"})
+}
+
+// AdminRevokeRole (rota de administrador) retira um papel de um usuário.
+// O papel admin não pode ser retirado da última conta que o tem.
+func (s *userServiceImpl) AdminRevokeRole(c *gin.Context) {
+	user := s.adminTargetUser(c)
+	if user == nil {
+		return
+	}
+	roleID, err := strconv.ParseUint(c.Param("roleId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de papel inválido."})
+		return
+	}
+	role, err := s.repo.GetRoleByID(uint(roleID))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Papel não encontrado."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar papel."})
+		return
+	}
+
+	revoke := s.repo.RevokeRole
+	if role.Name == AdminRole {
+		// Contando também quem é admin por herança de grupo
+		revoke = s.repo.RevokeRoleKeepingHolder
+	}
+	revoked, err := revoke(user.ID, role.ID)
+	if err == errLastRoleHolder {
+		c.JSON(http.StatusConflict, gin.H{"message": "Não é possível retirar o papel do último administrador."})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao retirar papel."})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"message": "O usuário não tem este papel."})
+		return
+	}
+
+	s.audit(c, user.ID, AuditRoleRevoked, map[string]interface{}{"role": role.Name})
+	c.JSON(http.StatusOK, gin.H{"message": "Papel retirado com sucesso!"})
+}
+
+// targetRole carrega o papel do parâmetro :id; responde e retorna nil se não houver
+func (s *userServiceImpl) targetRole(c *gin.Context) *Role {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de papel inválido."})
+		return nil
+	}
+
+	role, err := s.repo.GetRoleByID(uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Papel não encontrado."})
+			return nil
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar papel."})
+		return nil
+	}
+	return role
+}
+
+// resolvePermissions busca as permissões pelos nomes; responde 400 se alguma não existir
+func (s *userServiceImpl) resolvePermissions(c *gin.Context, names []string) ([]Permission, bool) {
+	permissions, err := s.repo.GetPermissionsByNames(names)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar permissões."})
+		return nil, false
+	}
+
+	found := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		found[p.Name] = true
+	}
+	for _, name := range names {
+		if !found[name] {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Permissão desconhecida: " + name})
+			return nil, false
+		}
+	}
+	return permissions, true
+}
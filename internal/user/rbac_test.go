@@ -0,0 +1,112 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newRevokeTestServer(s *userServiceImpl) *gin.Engine {
+	r := gin.New()
+	r.DELETE("/users/:id/roles/:roleId", s.AdminRevokeRole)
+	return r
+}
+
+func adminRole(t *testing.T, s *userServiceImpl) *Role {
+	t.Helper()
+	if err := SeedRBAC(s.repo); err != nil {
+		t.Fatal(err)
+	}
+	role, err := s.repo.GetRoleByName(AdminRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return role
+}
+
+func TestRevokeLastAdminRefused(t *testing.T) {
+	_, s := newTestService(t)
+	r := newRevokeTestServer(s)
+	role := adminRole(t, s)
+
+	first := createTestUser(t, s.repo, "first")
+	second := createTestUser(t, s.repo, "second")
+	for _, u := range []*User{first, second} {
+		if _, err := s.repo.AssignRole(u.ID, role.ID, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if code, body := doJSON(t, r, "DELETE", fmt.Sprintf("/users/%d/roles/%d", first.ID, role.ID), nil); code != http.StatusOK {
+		t.Fatalf("revogação com outro admin: %d %v", code, body)
+	}
+	if code, _ := doJSON(t, r, "DELETE", fmt.Sprintf("/users/%d/roles/%d", second.ID, role.ID), nil); code != http.StatusConflict {
+		t.Fatalf("revogação do último admin: esperado 409, obtido %d", code)
+	}
+	if roles, err := s.repo.GetUserRoles(second.ID); err != nil || len(roles) != 1 {
+		t.Errorf("último admin perdeu o papel: %v %v", roles, err)
+	}
+}
+
+func TestRevokeAdminCountsGroupInheritedAdmins(t *testing.T) {
+	_, s := newTestService(t)
+	r := newRevokeTestServer(s)
+	role := adminRole(t, s)
+
+	direct := createTestUser(t, s.repo, "direct")
+	if _, err := s.repo.AssignRole(direct.ID, role.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// inherited é admin por estar num subgrupo de um grupo com o papel admin
+	parent := &Group{Name: "ops", Roles: []Role{*role}}
+	child := &Group{Name: "oncall"}
+	for _, g := range []*Group{parent, child} {
+		if err := s.repo.CreateGroup(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.repo.AddSubgroup(parent.ID, child.ID); err != nil {
+		t.Fatal(err)
+	}
+	inherited := createTestUser(t, s.repo, "inherited")
+	if _, err := s.repo.AddGroupUser(child.ID, inherited.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, body := doJSON(t, r, "DELETE", fmt.Sprintf("/users/%d/roles/%d", direct.ID, role.ID), nil); code != http.StatusOK {
+		t.Fatalf("revogação com admin herdado de grupo: %d %v", code, body)
+	}
+}
+
+func TestMigrateLegacyAdminsClearsFlag(t *testing.T) {
+	db, s := newTestService(t)
+	if err := db.Exec("ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false").Error; err != nil {
+		t.Fatal(err)
+	}
+	legacy := createTestUser(t, s.repo, "legacy")
+	if err := db.Exec("UPDATE users SET is_admin = ? WHERE id = ?", true, legacy.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if migrated, err := MigrateLegacyAdmins(s.repo); err != nil || migrated != 1 {
+		t.Fatalf("migração: %d %v", migrated, err)
+	}
+	roles, err := s.repo.GetUserRoles(legacy.ID)
+	if err != nil || len(roles) != 1 || roles[0].Name != AdminRole {
+		t.Fatalf("papel admin não atribuído: %v %v", roles, err)
+	}
+
+	// Revogado depois da migração, o papel não volta pela coluna antiga
+	if _, err := s.repo.RevokeRole(legacy.ID, roles[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if migrated, err := MigrateLegacyAdmins(s.repo); err != nil || migrated != 0 {
+		t.Fatalf("segunda migração: %d %v", migrated, err)
+	}
+	if roles, err := s.repo.GetUserRoles(legacy.ID); err != nil || len(roles) != 0 {
+		t.Errorf("papel admin concedido de novo pela coluna is_admin: %v %v", roles, err)
+	}
+}
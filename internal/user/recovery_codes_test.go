@@ -0,0 +1,112 @@
+package user
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newRecoveryCodesTestServer monta as rotas de login MFA, perfil e códigos de recuperação do usuário
+func newRecoveryCodesTestServer(s *userServiceImpl, user *User) *gin.Engine {
+	r := gin.New()
+	r.POST("/login/mfa", s.LoginMFA)
+	private := r.Group("/", func(c *gin.Context) { c.Set("userID", user.ID) })
+	private.GET("/me", s.GetCurrentUser)
+	private.POST("/mfa/recovery-codes/regenerate", s.RegenerateRecoveryCodes)
+	private.POST("/mfa/totp/disable", s.DisableTOTP)
+	return r
+}
+
+func recoveryCodesRemaining(t *testing.T, r *gin.Engine) float64 {
+	t.Helper()
+	code, body := doJSON(t, r, "GET", "/me", nil)
+	if code != http.StatusOK {
+		t.Fatalf("perfil: %d %v", code, body)
+	}
+	return body["recovery_codes_remaining"].(float64)
+}
+
+func TestRecoveryCodeLoginIsSingleUse(t *testing.T) {
+	_, s := newTestService(t)
+	user := createTestUser(t, s.repo, "alice")
+	enableTestTOTP(t, s, user, "senha123")
+	codes, err := s.generateRecoveryCodes(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("gerados %d códigos, esperados %d", len(codes), recoveryCodeCount)
+	}
+	r := newRecoveryCodesTestServer(s, user)
+
+	// Maiúsculas, espaços e sem hífen: o código é normalizado antes da comparação
+	typed := " " + strings.ToUpper(strings.ReplaceAll(codes[0], "-", "")) + " "
+	login := MFALoginRequest{MFAToken: newMFAChallenge(t, s, user), Method: MFAMethodRecoveryCode, Code: typed}
+	if code, body := doJSON(t, r, "POST", "/login/mfa", login); code != http.StatusOK || body["token"] == nil {
+		t.Fatalf("login com código de recuperação: %d %v", code, body)
+	}
+	if remaining := recoveryCodesRemaining(t, r); remaining != recoveryCodeCount-1 {
+		t.Errorf("restam %v códigos, esperados %d", remaining, recoveryCodeCount-1)
+	}
+
+	login = MFALoginRequest{MFAToken: newMFAChallenge(t, s, user), Method: MFAMethodRecoveryCode, Code: codes[0]}
+	if code, _ := doJSON(t, r, "POST", "/login/mfa", login); code != http.StatusUnauthorized {
+		t.Errorf("código de recuperação reutilizado: esperado 401, obtido %d", code)
+	}
+}
+
+func TestRegenerateRecoveryCodesInvalidatesPrevious(t *testing.T) {
+	t.Setenv("LOGIN_BACKOFF_BASE", "0s")
+	_, s := newTestService(t)
+	user := createTestUser(t, s.repo, "alice")
+	secret := enableTestTOTP(t, s, user, "senha123")
+	previous, err := s.generateRecoveryCodes(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newRecoveryCodesTestServer(s, user)
+
+	code, body := doJSON(t, r, "POST", "/mfa/recovery-codes/regenerate", TOTPCodeRequest{Password: "senha123", Code: currentTOTPCode(t, secret)})
+	if code != http.StatusOK {
+		t.Fatalf("regenerar: %d %v", code, body)
+	}
+	fresh := body["recovery_codes"].([]interface{})
+	if len(fresh) != recoveryCodeCount {
+		t.Fatalf("regenerados %d códigos, esperados %d", len(fresh), recoveryCodeCount)
+	}
+	if remaining := recoveryCodesRemaining(t, r); remaining != recoveryCodeCount {
+		t.Errorf("restam %v códigos, esperados %d", remaining, recoveryCodeCount)
+	}
+
+	login := MFALoginRequest{MFAToken: newMFAChallenge(t, s, user), Method: MFAMethodRecoveryCode, Code: previous[0]}
+	if code, _ := doJSON(t, r, "POST", "/login/mfa", login); code != http.StatusUnauthorized {
+		t.Errorf("código do conjunto anterior: esperado 401, obtido %d", code)
+	}
+	login = MFALoginRequest{MFAToken: newMFAChallenge(t, s, user), Method: MFAMethodRecoveryCode, Code: fresh[0].(string)}
+	if code, _ := doJSON(t, r, "POST", "/login/mfa", login); code != http.StatusOK {
+		t.Errorf("código do novo conjunto: esperado 200, obtido %d", code)
+	}
+}
+
+func TestDisableTOTPRemovesRecoveryCodes(t *testing.T) {
+	_, s := newTestService(t)
+	user := createTestUser(t, s.repo, "alice")
+	secret := enableTestTOTP(t, s, user, "senha123")
+	codes, err := s.generateRecoveryCodes(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newRecoveryCodesTestServer(s, user)
+
+	if code, _ := doJSON(t, r, "POST", "/mfa/totp/disable", TOTPCodeRequest{Password: "senha123", Code: currentTOTPCode(t, secret)}); code != http.StatusOK {
+		t.Fatalf("desativar TOTP: esperado 200, obtido %d", code)
+	}
+	if remaining := recoveryCodesRemaining(t, r); remaining != 0 {
+		t.Errorf("restam %v códigos após desativar o TOTP", remaining)
+	}
+	if ok, err := s.useRecoveryCode(user, codes[0]); err != nil || ok {
+		t.Errorf("código de recuperação aceito após desativar o TOTP (%v)", err)
+	}
+}
@@ -0,0 +1,545 @@
+package user
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api_authentication/internal/relations"
+)
+
+// relationMaxDepth limita o aninhamento de usersets e relações derivadas numa avaliação
+const relationMaxDepth = 25
+
+// relationTuplesLimit é o máximo de tuplas devolvidas pela listagem
+const relationTuplesLimit = 1000
+
+// Paginação de list-objects: cada página avalia no máximo relationListScanLimit candidatos,
+// buscados em lotes de relationListBatch, mesmo que encontre menos objetos que o pedido
+const (
+	defaultRelationListLimit = 100
+	relationListScanLimit    = 1000
+	relationListBatch        = 200
+)
+
+var errRelationTooDeep = errors.New("relações aninhadas demais")
+
+// relationNode é um nó da árvore devolvida por expand
+type relationNode struct {
+	Type     string          `json:"type"` // union, this ou tuple_to_userset
+	Object   string          `json:"object,omitempty"`
+	Relation string          `json:"relation,omitempty"`
+	Tupleset string          `json:"tupleset,omitempty"`
+	Subjects []string        `json:"subjects,omitempty"` // Tuplas diretas (type this); usersets não são expandidos
+	Children []*relationNode `json:"children,omitempty"`
+}
+
+// relationEvaluator avalia relações a partir das tuplas gravadas e do esquema. Guarda os
+// resultados de check de um mesmo sujeito, então não deve ser reaproveitado entre requisições.
+type relationEvaluator struct {
+	repo     UserRepository
+	schema   *relations.Schema
+	subject  relations.Subject
+	memo     map[string]bool // Relações já confirmadas (objeto#relação)
+	visiting map[string]bool // Relações em avaliação no caminho atual
+}
+
+func (s *userServiceImpl) newRelationEvaluator(subject relations.Subject) *relationEvaluator {
+	return &relationEvaluator{
+		repo:     s.repo,
+		schema:   s.relations,
+		subject:  subject,
+		memo:     make(map[string]bool),
+		visiting: make(map[string]bool),
+	}
+}
+
+// check indica se o sujeito tem a relação com o objeto, direta ou derivada
+func (e *relationEvaluator) check(object relations.Object, relation string, depth int) (bool, error) {
+	if depth > relationMaxDepth {
+		return false, errRelationTooDeep
+	}
+	key := object.String() + "#" + relation
+	if result, ok := e.memo[key]; ok {
+		return result, nil
+	}
+	// Ciclo (ex.: grupos que se contêm): o caminho atual não acrescenta nada
+	if e.visiting[key] {
+		return false, nil
+	}
+	e.visiting[key] = true
+	defer delete(e.visiting, key)
+
+	result, err := e.evaluate(object, relation, depth)
+	if err != nil {
+		return false, err
+	}
+	// Só o positivo é guardado: um negativo pode ter sido cortado por um ciclo ainda em avaliação
+	if result {
+		e.memo[key] = true
+	}
+	return result, nil
+}
+
+func (e *relationEvaluator) evaluate(object relations.Object, relation string, depth int) (bool, error) {
+	// O próprio userset consultado (ex.: team:eng#member contém team:eng#member)
+	if e.subject.Relation == relation && e.subject.Namespace == object.Namespace && e.subject.ID == object.ID {
+		return true, nil
+	}
+
+	def, err := e.schema.Relation(object.Namespace, relation)
+	if err != nil {
+		// Objeto alcançado por tupleset em namespace sem esta relação
+		return false, nil
+	}
+
+	if def.Direct {
+		tuples, err := e.repo.GetRelationTuples(RelationTuple{Namespace: object.Namespace, ObjectID: object.ID, Relation: relation}, 0)
+		if err != nil {
+			return false, err
+		}
+		for _, t := range tuples {
+			if t.SubjectNamespace == e.subject.Namespace && t.SubjectObjectID == e.subject.ID && t.SubjectRelation == e.subject.Relation {
+				return true, nil
+			}
+		}
+		for _, t := range tuples {
+			if t.SubjectRelation == "" {
+				continue
+			}
+			ok, err := e.check(relations.Object{Namespace: t.SubjectNamespace, ID: t.SubjectObjectID}, t.SubjectRelation, depth+1)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+	}
+
+	for _, rw := range def.Union {
+		if rw.Tupleset == "" {
+			ok, err := e.check(object, rw.Relation, depth+1)
+			if err != nil || ok {
+				return ok, err
+			}
+			continue
+		}
+
+		tuples, err := e.repo.GetRelationTuples(RelationTuple{Namespace: object.Namespace, ObjectID: object.ID, Relation: rw.Tupleset}, 0)
+		if err != nil {
+			return false, err
+		}
+		for _, t := range tuples {
+			ok, err := e.check(relations.Object{Namespace: t.SubjectNamespace, ID: t.SubjectObjectID}, rw.Relation, depth+1)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// expand monta a árvore de quem tem a relação com o objeto: as tuplas diretas e, para cada
+// conjunto da união, a expansão correspondente. Retorna nil se a relação não existir no namespace.
+func (e *relationEvaluator) expand(object relations.Object, relation string, depth int) (*relationNode, error) {
+	if depth > relationMaxDepth {
+		return nil, errRelationTooDeep
+	}
+	key := object.String() + "#" + relation
+	if e.visiting[key] {
+		return nil, nil
+	}
+	def, err := e.schema.Relation(object.Namespace, relation)
+	if err != nil {
+		return nil, nil
+	}
+	e.visiting[key] = true
+	defer delete(e.visiting, key)
+
+	node := &relationNode{Type: "union", Object: object.String(), Relation: relation}
+	if def.Direct {
+		tuples, err := e.repo.GetRelationTuples(RelationTuple{Namespace: object.Namespace, ObjectID: object.ID, Relation: relation}, 0)
+		if err != nil {
+			return nil, err
+		}
+		leaf := &relationNode{Type: "this", Subjects: make([]string, 0, len(tuples))}
+		for _, t := range tuples {
+			leaf.Subjects = append(leaf.Subjects, tupleSubject(t).String())
+		}
+		node.Children = append(node.Children, leaf)
+	}
+
+	for _, rw := range def.Union {
+		if rw.Tupleset == "" {
+			child, err := e.expand(object, rw.Relation, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if child != nil {
+				node.Children = append(node.Children, child)
+			}
+			continue
+		}
+
+		tuples, err := e.repo.GetRelationTuples(RelationTuple{Namespace: object.Namespace, ObjectID: object.ID, Relation: rw.Tupleset}, 0)
+		if err != nil {
+			return nil, err
+		}
+		branch := &relationNode{Type: "tuple_to_userset", Tupleset: rw.Tupleset, Relation: rw.Relation}
+		for _, t := range tuples {
+			child, err := e.expand(relations.Object{Namespace: t.SubjectNamespace, ID: t.SubjectObjectID}, rw.Relation, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if child != nil {
+				branch.Children = append(branch.Children, child)
+			}
+		}
+		node.Children = append(node.Children, branch)
+	}
+	return node, nil
+}
+
+func tupleSubject(t RelationTuple) relations.Subject {
+	return relations.Subject{Namespace: t.SubjectNamespace, ID: t.SubjectObjectID, Relation: t.SubjectRelation}
+}
+
+// GetRelationSchema lista os namespaces e as relações aceitos
+func (s *userServiceImpl) GetRelationSchema(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"namespaces": s.relations.Namespaces()})
+}
+
+// ListRelationTuples lista as tuplas que batem com os filtros (objeto, relação, sujeito)
+func (s *userServiceImpl) ListRelationTuples(c *gin.Context) {
+	var req ListRelationTuplesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Parâmetros de consulta inválidos: " + err.Error()})
+		return
+	}
+
+	var filter RelationTuple
+	if req.Object != "" {
+		if strings.Contains(req.Object, ":") {
+			object, err := relations.ParseObject(req.Object)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "Objeto inválido: use namespace ou namespace:id."})
+				return
+			}
+			filter.Namespace, filter.ObjectID = object.Namespace, object.ID
+		} else if relations.ValidName(req.Object) {
+			filter.Namespace = req.Object
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Objeto inválido: use namespace ou namespace:id."})
+			return
+		}
+	}
+	if req.Relation != "" {
+		if !relations.ValidName(req.Relation) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Relação inválida."})
+			return
+		}
+		filter.Relation = req.Relation
+	}
+	if req.Subject != "" {
+		subject, err := relations.ParseSubject(req.Subject)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Sujeito inválido: use namespace:id ou namespace:id#relacao."})
+			return
+		}
+		filter.SubjectNamespace, filter.SubjectObjectID, filter.SubjectRelation = subject.Namespace, subject.ID, subject.Relation
+	}
+
+	tuples, err := s.repo.GetRelationTuples(filter, relationTuplesLimit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao listar tuplas."})
+		return
+	}
+	c.JSON(http.StatusOK, tuples)
+}
+
+// WriteRelationTuple grava uma tupla (ex.: document:readme#editor@team:eng#member)
+func (s *userServiceImpl) WriteRelationTuple(c *gin.Context) {
+	var req RelationTupleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	tuple, ok := s.relationTuple(c, req)
+	if !ok {
+		return
+	}
+	if tuple.SubjectNamespace == relations.UserNamespace && !s.relationUserExists(c, tuple.SubjectObjectID) {
+		return
+	}
+
+	actorID := c.MustGet("userID").(uint)
+	tuple.CreatedByID = &actorID
+	created, err := s.repo.CreateRelationTuple(tuple)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gravar tupla."})
+		return
+	}
+	if !created {
+		c.JSON(http.StatusOK, gin.H{"message": "A tupla já existia."})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Tupla gravada com sucesso!"})
+}
+
+// DeleteRelationTuple remove uma tupla, informada pelos parâmetros object, relation e subject
+func (s *userServiceImpl) DeleteRelationTuple(c *gin.Context) {
+	var req RelationTupleRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Parâmetros de consulta inválidos: " + err.Error()})
+		return
+	}
+
+	tuple, ok := s.relationTuple(c, req)
+	if !ok {
+		return
+	}
+
+	removed, err := s.repo.DeleteRelationTuple(tuple)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao remover tupla."})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Tupla não encontrada."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Tupla removida com sucesso!"})
+}
+
+// CheckRelation responde se o sujeito (padrão: o usuário logado) tem a relação com o objeto
+func (s *userServiceImpl) CheckRelation(c *gin.Context) {
+	var req RelationCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	object, err := relations.ParseObject(req.Object)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Objeto inválido: use namespace:id."})
+		return
+	}
+	if !s.knownRelation(c, object.Namespace, req.Relation) {
+		return
+	}
+	subject, ok := s.relationQuerySubject(c, req.Subject)
+	if !ok {
+		return
+	}
+
+	allowed, err := s.newRelationEvaluator(subject).check(object, req.Relation, 0)
+	if err != nil {
+		s.relationEvaluationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"allowed": allowed})
+}
+
+// ExpandRelation mostra a árvore de quem tem a relação com o objeto
+func (s *userServiceImpl) ExpandRelation(c *gin.Context) {
+	var req RelationExpandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	object, err := relations.ParseObject(req.Object)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Objeto inválido: use namespace:id."})
+		return
+	}
+	if !s.knownRelation(c, object.Namespace, req.Relation) {
+		return
+	}
+
+	tree, err := s.newRelationEvaluator(relations.Subject{}).expand(object, req.Relation, 0)
+	if err != nil {
+		s.relationEvaluationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tree)
+}
+
+// ListRelationObjects lista os objetos do namespace com os quais o sujeito (padrão: o usuário
+// logado) tem a relação. A listagem é paginada: next_cursor continua de onde a página parou e é
+// nulo quando todos os candidatos foram avaliados. Uma página pode vir com menos objetos que o
+// limite (até vazia) e ainda ter next_cursor.
+func (s *userServiceImpl) ListRelationObjects(c *gin.Context) {
+	var req RelationListObjectsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	if !s.knownRelation(c, req.Namespace, req.Relation) {
+		return
+	}
+	subject, ok := s.relationQuerySubject(c, req.Subject)
+	if !ok {
+		return
+	}
+
+	if req.Limit == 0 {
+		req.Limit = defaultRelationListLimit
+	}
+	after := ""
+	if req.Cursor != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(req.Cursor)
+		if err != nil || len(decoded) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Cursor inválido."})
+			return
+		}
+		after = string(decoded)
+	}
+
+	// Toda relação, direta ou derivada, parte de alguma tupla do próprio objeto,
+	// então os candidatos são os objetos do namespace que aparecem em tuplas
+	evaluator := s.newRelationEvaluator(subject)
+	objects := make([]string, 0)
+	scanned := 0
+	exhausted := false
+	for !exhausted && len(objects) < req.Limit && scanned < relationListScanLimit {
+		ids, err := s.repo.GetRelationObjectIDs(req.Namespace, after, relationListBatch)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao listar objetos."})
+			return
+		}
+		exhausted = len(ids) < relationListBatch
+
+		for i, id := range ids {
+			object := relations.Object{Namespace: req.Namespace, ID: id}
+			allowed, err := evaluator.check(object, req.Relation, 0)
+			if err != nil {
+				s.relationEvaluationError(c, err)
+				return
+			}
+			if allowed {
+				objects = append(objects, object.String())
+			}
+			after = id
+			scanned++
+			if len(objects) == req.Limit || scanned == relationListScanLimit {
+				exhausted = exhausted && i == len(ids)-1
+				break
+			}
+		}
+	}
+
+	var next *string
+	if !exhausted {
+		cursor := base64.RawURLEncoding.EncodeToString([]byte(after))
+		next = &cursor
+	}
+	c.JSON(http.StatusOK, gin.H{"objects": objects, "next_cursor": next})
+}
+
+// relationTuple valida a tupla da requisição contra o esquema; responde e retorna false se inválida
+func (s *userServiceImpl) relationTuple(c *gin.Context, req RelationTupleRequest) (*RelationTuple, bool) {
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return nil, false
+	}
+
+	object, err := relations.ParseObject(req.Object)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Objeto inválido: use namespace:id."})
+		return nil, false
+	}
+	subject, err := relations.ParseSubject(req.Subject)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Sujeito inválido: use namespace:id ou namespace:id#relacao."})
+		return nil, false
+	}
+	if err := s.relations.ValidateTuple(object, req.Relation, subject); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Tupla inválida: " + err.Error()})
+		return nil, false
+	}
+
+	return &RelationTuple{
+		Namespace:        object.Namespace,
+		ObjectID:         object.ID,
+		Relation:         req.Relation,
+		SubjectNamespace: subject.Namespace,
+		SubjectObjectID:  subject.ID,
+		SubjectRelation:  subject.Relation,
+	}, true
+}
+
+// knownRelation confere se a relação existe no namespace; responde 400 se não existir
+func (s *userServiceImpl) knownRelation(c *gin.Context, namespace, relation string) bool {
+	if _, err := s.relations.Relation(namespace, relation); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Consulta inválida: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// relationQuerySubject resolve o sujeito de check e list-objects. Sem sujeito, vale o usuário
+// logado; consultar outro sujeito exige a permissão relations:read.
+func (s *userServiceImpl) relationQuerySubject(c *gin.Context, ref string) (relations.Subject, bool) {
+	self := relations.Subject{Namespace: relations.UserNamespace, ID: strconv.FormatUint(uint64(c.MustGet("userID").(uint)), 10)}
+	if ref == "" {
+		return self, true
+	}
+
+	subject, err := relations.ParseSubject(ref)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Sujeito inválido: use namespace:id ou namespace:id#relacao."})
+		return subject, false
+	}
+	if subject != self && !HasPermission(c, PermRelationsRead) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Você só pode consultar as próprias relações."})
+		return subject, false
+	}
+	return subject, true
+}
+
+// relationUserExists confere se o sujeito user:<id> é uma conta existente; responde se não for
+func (s *userServiceImpl) relationUserExists(c *gin.Context, id string) bool {
+	userID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Sujeito inválido: usuários são user:<id>."})
+		return false
+	}
+	if _, err := s.repo.GetUserByID(uint(userID)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado."})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuário."})
+		return false
+	}
+	return true
+}
+
+func (s *userServiceImpl) relationEvaluationError(c *gin.Context, err error) {
+	if err == errRelationTooDeep {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "As relações estão aninhadas demais para serem avaliadas."})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao avaliar relação."})
+}
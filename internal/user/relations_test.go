@@ -0,0 +1,196 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"api_authentication/internal/relations"
+)
+
+const testRelationSchema = `
+namespaces:
+  team:
+    member: {}
+  folder:
+    owner: {}
+    viewer:
+      union: [owner]
+  document:
+    parent: {}
+    owner: {}
+    editor:
+      union: [owner]
+    viewer:
+      union: [editor, parent->viewer]
+`
+
+// newRelationTestService cria o serviço com o esquema de teste e grava as tuplas ("objeto#relação@sujeito")
+func newRelationTestService(t *testing.T, tuples ...string) *userServiceImpl {
+	t.Helper()
+	_, s := newTestService(t)
+	schema, err := relations.ParseSchema([]byte(testRelationSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.relations = schema
+
+	for _, raw := range tuples {
+		objectRelation, subjectRef, _ := strings.Cut(raw, "@")
+		objectRef, relation, _ := strings.Cut(objectRelation, "#")
+		object, err := relations.ParseObject(objectRef)
+		if err != nil {
+			t.Fatalf("%s: %v", raw, err)
+		}
+		subject, err := relations.ParseSubject(subjectRef)
+		if err != nil {
+			t.Fatalf("%s: %v", raw, err)
+		}
+		if err := schema.ValidateTuple(object, relation, subject); err != nil {
+			t.Fatalf("%s: %v", raw, err)
+		}
+		if _, err := s.repo.CreateRelationTuple(&RelationTuple{
+			Namespace: object.Namespace, ObjectID: object.ID, Relation: relation,
+			SubjectNamespace: subject.Namespace, SubjectObjectID: subject.ID, SubjectRelation: subject.Relation,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestRelationCheck(t *testing.T) {
+	s := newRelationTestService(t,
+		"document:readme#owner@user:1",
+		"document:readme#editor@team:eng#member",
+		"team:eng#member@user:2",
+		"document:readme#parent@folder:docs",
+		"folder:docs#viewer@user:3",
+		"folder:docs#owner@user:4",
+		// Times que se contêm: a avaliação precisa terminar
+		"team:a#member@team:b#member",
+		"team:b#member@team:a#member",
+		"team:b#member@user:5",
+		"document:cycle#viewer@team:a#member",
+	)
+
+	tests := []struct {
+		name     string
+		subject  string
+		object   string
+		relation string
+		want     bool
+	}{
+		{"tupla direta", "user:1", "document:readme", "owner", true},
+		{"sem tupla", "user:2", "document:readme", "owner", false},
+		{"relação calculada", "user:1", "document:readme", "editor", true},
+		{"calculada em dois níveis", "user:1", "document:readme", "viewer", true},
+		{"userset", "user:2", "document:readme", "editor", true},
+		{"userset em relação calculada", "user:2", "document:readme", "viewer", true},
+		{"o próprio userset", "team:eng#member", "document:readme", "editor", true},
+		{"tuple-to-userset", "user:3", "document:readme", "viewer", true},
+		{"tuple-to-userset não dá editor", "user:3", "document:readme", "editor", false},
+		{"tuple-to-userset com relação calculada", "user:4", "document:readme", "viewer", true},
+		{"ciclo com o sujeito", "user:5", "document:cycle", "viewer", true},
+		{"ciclo sem o sujeito", "user:6", "document:cycle", "viewer", false},
+		{"objeto sem tuplas", "user:1", "document:other", "viewer", false},
+	}
+	for _, tt := range tests {
+		subject, err := relations.ParseSubject(tt.subject)
+		if err != nil {
+			t.Fatal(err)
+		}
+		object, err := relations.ParseObject(tt.object)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.newRelationEvaluator(subject).check(object, tt.relation, 0)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: %s %s#%s = %v, esperado %v", tt.name, tt.subject, tt.object, tt.relation, got, tt.want)
+		}
+	}
+}
+
+func TestRelationCheckTooDeep(t *testing.T) {
+	tuples := []string{"document:deep#viewer@team:t0#member", fmt.Sprintf("team:t%d#member@user:1", relationMaxDepth+5)}
+	for i := 0; i < relationMaxDepth+5; i++ {
+		tuples = append(tuples, fmt.Sprintf("team:t%d#member@team:t%d#member", i, i+1))
+	}
+	s := newRelationTestService(t, tuples...)
+
+	_, err := s.newRelationEvaluator(relations.Subject{Namespace: relations.UserNamespace, ID: "1"}).
+		check(relations.Object{Namespace: "document", ID: "deep"}, "viewer", 0)
+	if err != errRelationTooDeep {
+		t.Errorf("esperado errRelationTooDeep, obtido %v", err)
+	}
+}
+
+func TestRelationExpand(t *testing.T) {
+	s := newRelationTestService(t,
+		"document:readme#owner@user:1",
+		"document:readme#parent@folder:docs",
+		"folder:docs#viewer@user:3",
+	)
+	tree, err := s.newRelationEvaluator(relations.Subject{}).expand(relations.Object{Namespace: "document", ID: "readme"}, "viewer", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var subjects []string
+	var walk func(*relationNode)
+	walk = func(n *relationNode) {
+		subjects = append(subjects, n.Subjects...)
+		for _, child := range n.Children {
+			walk(child)
+		}
+	}
+	walk(tree)
+	if fmt.Sprint(subjects) != "[user:1 user:3]" {
+		t.Errorf("sujeitos da expansão: %v", subjects)
+	}
+}
+
+func TestListRelationObjectsPaginates(t *testing.T) {
+	var tuples []string
+	for i := 0; i < 7; i++ {
+		tuples = append(tuples, fmt.Sprintf("document:doc%d#owner@user:1", i))
+	}
+	tuples = append(tuples, "document:other#owner@user:2")
+	s := newRelationTestService(t, tuples...)
+
+	r := gin.New()
+	r.POST("/relations/list-objects", func(c *gin.Context) { c.Set("userID", uint(1)) }, s.ListRelationObjects)
+
+	var objects []string
+	req := RelationListObjectsRequest{Namespace: "document", Relation: "viewer", Limit: 3}
+	for page := 0; page < 10; page++ {
+		code, body := doJSON(t, r, "POST", "/relations/list-objects", req)
+		if code != http.StatusOK {
+			t.Fatalf("página %d: %d %v", page, code, body)
+		}
+		for _, o := range body["objects"].([]interface{}) {
+			objects = append(objects, o.(string))
+		}
+		next, ok := body["next_cursor"].(string)
+		if !ok {
+			break
+		}
+		req.Cursor = next
+	}
+
+	if len(objects) != 7 || objects[0] != "document:doc0" || objects[6] != "document:doc6" {
+		t.Errorf("objetos listados: %v", objects)
+	}
+
+	req.Cursor = "%%%"
+	if code, _ := doJSON(t, r, "POST", "/relations/list-objects", req); code != http.StatusBadRequest {
+		t.Errorf("cursor inválido: esperado 400, obtido %d", code)
+	}
+}
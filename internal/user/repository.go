@@ -2,7 +2,16 @@
 package user
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"api_authentication/internal/identifier"
+	"api_authentication/internal/relations"
 )
 
 // UserRepository define a interface para operações de persistência de usuário
@@ -10,11 +19,168 @@ type UserRepository interface {
 	CreateUser(user *User) error
 	GetUserByUsername(username string) (*User, error)
 	GetUserByID(id uint) (*User, error)
-	UpdateUser(user *User) error
+	UpdateUserFields(id uint, fields map[string]interface{}) error
+	UpdateUserProfile(id uint, fields map[string]interface{}) error
+	MarkEmailVerified(id uint, at time.Time) (bool, error)
+	SetPendingEmail(id uint, email string) error
+	ApplyEmailChange(id uint, newEmail, canonicalEmail string, at time.Time) (bool, error)
+	CancelEmailChange(id uint, pendingEmail string) (bool, error)
 	DeleteUser(id uint) error
 	// --- ESTES DOIS MÉTODOS ESTAVAM FALTANDO NA INTERFACE! ---
 	GetUserByUsernameOrEmail(identifier string) (*User, error)
 	GetUserByEmail(email string) (*User, error) // <--- MÉTODO ADICIONADO À INTERFACE
+	IsUsernameReserved(username string, exceptID uint) (bool, error)
+	IsEmailReserved(email string, exceptID uint) (bool, error)
+	IsCanonicalEmailReserved(canonical string, exceptID uint) (bool, error)
+	GetUsersWithoutCanonicalEmail(limit int) ([]User, error)
+	SetCanonicalEmail(id uint, canonical string) error
+	IsUsernameSkeletonReserved(skeleton string, exceptID uint) (bool, error)
+	GetUsersWithoutUsernameSkeleton(limit int) ([]User, error)
+	SetNormalizedIdentifiers(id uint, username, email, skeleton string) error
+	ListUsers(filter UserListFilter, page UserListPage) ([]User, error)
+	CountUsers(filter UserListFilter) (int64, error)
+	ConsumeTOTPStep(id uint, step int64) (bool, error)
+
+	// Códigos de recuperação MFA
+	ReplaceRecoveryCodes(userID uint, codeHashes []string) error
+	UseRecoveryCode(userID uint, codeHash string) (bool, error)
+	CountRecoveryCodes(userID uint) (int64, error)
+	DeleteRecoveryCodes(userID uint) error
+
+	// Passkeys (WebAuthn)
+	CreateWebAuthnCredential(credential *WebAuthnCredential) error
+	GetWebAuthnCredentialsByUserID(userID uint) ([]WebAuthnCredential, error)
+	GetWebAuthnCredentialByCredentialID(credentialID []byte) (*WebAuthnCredential, error)
+	UpdateWebAuthnCredential(credential *WebAuthnCredential) error
+	DeleteWebAuthnCredential(userID, id uint) (bool, error)
+	CountWebAuthnCredentials(userID uint) (int64, error)
+	CreateWebAuthnSession(session *WebAuthnSession) error
+	TakeWebAuthnSession(id string) (*WebAuthnSession, error)
+
+	// Tokens de uso único (link mágico etc.)
+	CreateOneTimeToken(token *OneTimeToken) error
+	GetActiveOneTimeTokenByHash(purpose, tokenHash string) (*OneTimeToken, error)
+	GetLatestActiveOneTimeToken(userID uint, purpose string) (*OneTimeToken, error)
+	ConsumeOneTimeToken(id uint) (bool, error)
+	IncrementOneTimeTokenAttempts(id uint, maxAttempts int) (bool, error)
+	InvalidateOneTimeTokens(userID uint, purpose string) error
+	CountOneTimeTokensSince(userID uint, purpose string, since time.Time) (int64, error)
+
+	// Dispositivos confiáveis
+	CreateTrustedDevice(device *TrustedDevice) error
+	GetActiveTrustedDevice(userID, id uint) (*TrustedDevice, error)
+	GetTrustedDevicesByUserID(userID uint) ([]TrustedDevice, error)
+	TouchTrustedDevice(id uint) error
+	DeleteTrustedDevice(userID, id uint) (bool, error)
+	DeleteTrustedDevices(userID uint) error
+
+	// Bloqueio por tentativas de login malsucedidas
+	RecordFailedLogin(id uint, now time.Time, window time.Duration) (int, error)
+	LockUser(id uint, until time.Time) error
+	ResetFailedLogins(id uint) error
+
+	// Convites de cadastro
+	CreateInvitation(invitation *Invitation) error
+	GetInvitationByCodeHash(codeHash string) (*Invitation, error)
+	GetInvitations(createdByID uint) ([]Invitation, error)
+	UseInvitation(id uint) (bool, error)
+	ReleaseInvitation(id uint) error
+	RevokeInvitation(id uint, createdByID uint) (bool, error)
+
+	// Exportação de dados pessoais
+	CreateDataExport(export *DataExport) error
+	GetDataExport(userID, id uint) (*DataExport, error)
+	GetDataExportByID(id uint) (*DataExport, error)
+	GetPendingDataExport(userID uint) (*DataExport, error)
+	FinishDataExport(export *DataExport) (bool, error)
+	GetExpiredDataExports(now, stalePendingBefore time.Time) ([]DataExport, error)
+	DeleteDataExport(id uint) error
+	GetRecoveryCodesByUserID(userID uint) ([]RecoveryCode, error)
+	GetOneTimeTokensByUserID(userID uint) ([]OneTimeToken, error)
+	GetAllTrustedDevicesByUserID(userID uint) ([]TrustedDevice, error)
+
+	// Documentos legais
+	CreateLegalDocument(document *LegalDocument) error
+	GetLegalDocuments() ([]LegalDocument, error)
+	GetEffectiveLegalDocuments(now time.Time) ([]LegalDocument, error)
+	GetAcceptedDocumentIDs(userID uint, documentIDs []uint) ([]uint, error)
+	CreateLegalAcceptances(acceptances []LegalAcceptance) error
+	GetLegalAcceptancesByUserID(userID uint) ([]LegalAcceptance, error)
+
+	// Histórico de auditoria
+	CreateAuditEvent(event *AuditEvent) error
+	GetAuditEventsByUserID(userID uint) ([]AuditEvent, error)
+
+	// Papéis e permissões
+	EnsurePermissions(permissions []Permission) error
+	GetPermissions() ([]Permission, error)
+	GetPermissionsByNames(names []string) ([]Permission, error)
+	CreateRole(role *Role) error
+	GetRoles() ([]Role, error)
+	GetRoleByID(id uint) (*Role, error)
+	GetRoleByName(name string) (*Role, error)
+	UpdateRole(role *Role, permissions []Permission) error
+	DeleteRole(id uint) error
+	GetUserRoles(userID uint) ([]Role, error)
+	AssignRole(userID, roleID uint, assignedByID *uint) (bool, error)
+	RevokeRole(userID, roleID uint) (bool, error)
+	RevokeRoleKeepingHolder(userID, roleID uint) (bool, error)
+	MigrateLegacyAdmins(roleID uint) (int, error)
+	GetRolesByIDs(ids []uint) ([]Role, error)
+
+	// Grupos (aninhados) e seus papéis
+	CreateGroup(group *Group) error
+	GetGroups() ([]Group, error)
+	GetGroupByID(id uint) (*Group, error)
+	GetGroupByName(name string) (*Group, error)
+	GetGroupsByIDs(ids []uint) ([]Group, error)
+	UpdateGroup(group *Group, roles []Role) error
+	DeleteGroup(id uint) error
+	AddGroupUser(groupID, userID uint) (bool, error)
+	RemoveGroupUser(groupID, userID uint) (bool, error)
+	GetGroupUsers(groupID uint) ([]User, error)
+	AddSubgroup(parentID, childID uint) (bool, error)
+	RemoveSubgroup(parentID, childID uint) (bool, error)
+	GetSubgroups(parentID uint) ([]Group, error)
+	GetUserGroupIDs(userID uint) ([]uint, error)
+	GetParentGroupIDs(childIDs []uint) ([]uint, error)
+	GetChildGroupIDs(parentIDs []uint) ([]uint, error)
+	GetGroupIDsWithRole(roleID uint) ([]uint, error)
+	GetGroupRoles(groupIDs []uint) ([]Role, error)
+
+	// Tuplas de relação (autorização baseada em relacionamentos)
+	CreateRelationTuple(tuple *RelationTuple) (bool, error)
+	DeleteRelationTuple(tuple *RelationTuple) (bool, error)
+	GetRelationTuples(filter RelationTuple, limit int) ([]RelationTuple, error)
+	GetRelationObjectIDs(namespace, after string, limit int) ([]string, error)
+
+	// Organizações e membros
+	CreateOrganization(org *Organization, ownerID uint) error
+	GetOrganizationByID(id uint) (*Organization, error)
+	GetOrganizationBySlug(slug string) (*Organization, error)
+	GetUserMemberships(userID uint) ([]Membership, error)
+	GetMembership(orgID, userID uint) (*Membership, error)
+	GetOrganizationMembers(orgID uint) ([]Membership, error)
+	AddMembership(membership *Membership) (bool, error)
+	UpdateMembershipRole(orgID, userID uint, role string) error
+	RemoveMembership(orgID, userID uint) (bool, error)
+	CountOrganizationOwners(orgID uint) (int64, error)
+	AddUsersWithoutMembership(orgID uint, role string) (int64, error)
+	PromoteRoleHoldersToOwner(orgID, roleID uint) error
+
+	// Estado da conta
+	TransitionUserStatus(id uint, from, to string, fields map[string]interface{}) (bool, error)
+
+	// Contas excluídas (exclusão lógica) e expurgo
+	GetDeletedUserByID(id uint) (*User, error)
+	GetDeletedUserByUsernameOrEmail(identifier string) (*User, error)
+	RestoreUser(id uint, status string) (bool, error)
+	GetUsersToPurge(deletedBefore time.Time, limit int) ([]User, error)
+	EraseUser(id uint, receipt *ErasureReceipt) error
+
+	// Migrações de dados
+	IsDataMigrationApplied(name string) (bool, error)
+	RecordDataMigration(name string, rows int) error
 }
 
 // userRepositoryImpl é a implementação concreta do UserRepository
@@ -35,7 +201,9 @@ func (r *userRepositoryImpl) CreateUser(user *User) error {
 // GetUserByUsername busca um usuário pelo nome de usuário
 func (r *userRepositoryImpl) GetUserByUsername(username string) (*User, error) {
 	var user User
-	if err := r.db.Where("username = ?", username).First(&user).Error; err != nil {
+	if err := r.db.Where("username IN ?", lookupKeys(usernameKey(username), username)).
+		Order(exactMatchFirst(username, "username")).
+		First(&user).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
@@ -45,7 +213,9 @@ func (r *userRepositoryImpl) GetUserByUsername(username string) (*User, error) {
 func (r *userRepositoryImpl) GetUserByUsernameOrEmail(identifier string) (*User, error) {
 	var user User
 	// Esta é a query chave: busca onde o username OU o email correspondem ao identificador
-	if err := r.db.Where("username = ? OR email = ?", identifier, identifier).First(&user).Error; err != nil {
+	if err := r.db.Where("username IN ? OR email IN ?", lookupKeys(usernameKey(identifier), identifier), lookupKeys(emailKey(identifier), identifier)).
+		Order(exactMatchFirst(identifier, "username", "email")).
+		First(&user).Error; err != nil {
 		return nil, err // Retornará gorm.ErrRecordNotFound se não encontrar
 	}
 	return &user, nil
@@ -55,7 +225,9 @@ func (r *userRepositoryImpl) GetUserByUsernameOrEmail(identifier string) (*User,
 // --- IMPLEMENTAÇÃO ADICIONADA/CONFIRMADA AQUI ---
 func (r *userRepositoryImpl) GetUserByEmail(email string) (*User, error) {
 	var user User
-	if err := r.db.Where("email = ?", email).First(&user).Error; err != nil {
+	if err := r.db.Where("email IN ?", lookupKeys(emailKey(email), email)).
+		Order(exactMatchFirst(email, "email")).
+		First(&user).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
@@ -70,12 +242,1526 @@ func (r *userRepositoryImpl) GetUserByID(id uint) (*User, error) {
 	return &user, nil
 }
 
-// UpdateUser atualiza um usuário existente no banco de dados
-func (r *userRepositoryImpl) UpdateUser(user *User) error {
-	return r.db.Save(user).Error
+// UpdateUserFields grava apenas as colunas informadas de uma conta não excluída nem apagada.
+// Retorna gorm.ErrRecordNotFound se a conta não existir mais, para que uma requisição que
+// carregou o usuário antes da exclusão ou do apagamento não grave nada.
+func (r *userRepositoryImpl) UpdateUserFields(id uint, fields map[string]interface{}) error {
+	result := r.db.Model(&User{}).Where("id = ? AND purged_at IS NULL", id).Updates(fields)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// UpdateUserProfile grava apenas as colunas de perfil informadas (nil limpa a coluna).
+// Retorna gorm.ErrRecordNotFound se a conta não existir (ou tiver sido excluída).
+func (r *userRepositoryImpl) UpdateUserProfile(id uint, fields map[string]interface{}) error {
+	result := r.db.Model(&User{}).Where("id = ?", id).Updates(fields)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// verifiedStatus é o novo estado de uma conta que acaba de confirmar o email: pendente vira
+// ativa e qualquer outro estado (suspensa, bloqueada) é mantido
+func verifiedStatus() clause.Expr {
+	return gorm.Expr("CASE WHEN status = ? THEN ? ELSE status END", StatusPending, StatusActive)
+}
+
+// MarkEmailVerified registra a confirmação do email sem regravar a linha inteira, para não
+// desfazer mudanças de estado concorrentes (ex.: uma suspensão). Retorna false se o email já
+// estava confirmado.
+func (r *userRepositoryImpl) MarkEmailVerified(id uint, at time.Time) (bool, error) {
+	result := r.db.Model(&User{}).
+		Where("id = ? AND email_verified_at IS NULL", id).
+		Updates(map[string]interface{}{"email_verified_at": at, "status": verifiedStatus()})
+	return result.RowsAffected == 1, result.Error
+}
+
+// SetPendingEmail grava (ou limpa, com email vazio) o email aguardando confirmação
+func (r *userRepositoryImpl) SetPendingEmail(id uint, email string) error {
+	return r.db.Model(&User{}).Where("id = ?", id).Update("pending_email", email).Error
+}
+
+// ApplyEmailChange troca o email pelo pendente, somente se o pendente ainda for newEmail
+// (a troca não foi cancelada nem substituída). O email fica confirmado em at.
+func (r *userRepositoryImpl) ApplyEmailChange(id uint, newEmail, canonicalEmail string, at time.Time) (bool, error) {
+	result := r.db.Model(&User{}).
+		Where("id = ? AND pending_email = ?", id, newEmail).
+		Updates(map[string]interface{}{
+			"email":             newEmail,
+			"canonical_email":   canonicalEmail,
+			"pending_email":     "",
+			"email_verified_at": at,
+			"status":            verifiedStatus(),
+		})
+	return result.RowsAffected == 1, result.Error
 }
 
-// DeleteUser deleta um usuário pelo ID
+// CancelEmailChange descarta o email pendente, somente se ele ainda for pendingEmail
+// (a troca não foi confirmada nem substituída no meio tempo)
+func (r *userRepositoryImpl) CancelEmailChange(id uint, pendingEmail string) (bool, error) {
+	result := r.db.Model(&User{}).
+		Where("id = ? AND pending_email = ?", id, pendingEmail).
+		Update("pending_email", "")
+	return result.RowsAffected == 1, result.Error
+}
+
+// DeleteUser exclui a conta logicamente, guardando o estado anterior para a restauração
 func (r *userRepositoryImpl) DeleteUser(id uint) error {
-	return r.db.Delete(&User{}, id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"status_before_deletion": gorm.Expr("status"),
+			"status":                 StatusDeleted,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&User{}, id).Error
+	})
+}
+
+// IsUsernameReserved indica se o nome de usuário pertence a outra conta, inclusive excluída e ainda restaurável
+func (r *userRepositoryImpl) IsUsernameReserved(username string, exceptID uint) (bool, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&User{}).Where("username = ? AND id <> ?", usernameKey(username), exceptID).Count(&count).Error
+	return count > 0, err
+}
+
+// IsEmailReserved indica se o email pertence a outra conta, inclusive excluída e ainda restaurável,
+// ou se está reservado por uma troca de email pendente
+func (r *userRepositoryImpl) IsEmailReserved(email string, exceptID uint) (bool, error) {
+	email = emailKey(email)
+	var count int64
+	err := r.db.Unscoped().Model(&User{}).
+		Where("(email = ? OR pending_email = ?) AND id <> ?", email, email, exceptID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ConsumeTOTPStep registra o passo TOTP usado, somente se for mais recente que o último aceito.
+// Retorna false quando o passo já foi consumido (replay), inclusive por outra instância.
+func (r *userRepositoryImpl) ConsumeTOTPStep(id uint, step int64) (bool, error) {
+	result := r.db.Model(&User{}).
+		Where("id = ? AND totp_last_step < ?", id, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReplaceRecoveryCodes substitui, numa única transação, todo o conjunto de códigos de recuperação do usuário
+func (r *userRepositoryImpl) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]RecoveryCode, len(codeHashes))
+		for i, hash := range codeHashes {
+			codes[i] = RecoveryCode{UserID: userID, CodeHash: hash}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// UseRecoveryCode marca o código como usado. Retorna false se ele não existir ou já tiver sido usado.
+func (r *userRepositoryImpl) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	result := r.db.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// CountRecoveryCodes retorna quantos códigos de recuperação ainda não foram usados
+func (r *userRepositoryImpl) CountRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// DeleteRecoveryCodes remove todos os códigos de recuperação do usuário
+func (r *userRepositoryImpl) DeleteRecoveryCodes(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error
+}
+
+// CreateWebAuthnCredential salva uma nova passkey
+func (r *userRepositoryImpl) CreateWebAuthnCredential(credential *WebAuthnCredential) error {
+	return r.db.Create(credential).Error
+}
+
+// GetWebAuthnCredentialsByUserID lista as passkeys do usuário
+func (r *userRepositoryImpl) GetWebAuthnCredentialsByUserID(userID uint) ([]WebAuthnCredential, error) {
+	var credentials []WebAuthnCredential
+	err := r.db.Where("user_id = ?", userID).Order("id").Find(&credentials).Error
+	return credentials, err
+}
+
+// GetWebAuthnCredentialByCredentialID busca uma passkey pelo ID gerado pelo autenticador
+func (r *userRepositoryImpl) GetWebAuthnCredentialByCredentialID(credentialID []byte) (*WebAuthnCredential, error) {
+	var credential WebAuthnCredential
+	if err := r.db.Where("credential_id = ?", credentialID).First(&credential).Error; err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// UpdateWebAuthnCredential atualiza contador de assinaturas, flags e último uso. Não recria a
+// passkey removida (ou apagada junto com a conta) depois de carregada: retorna gorm.ErrRecordNotFound.
+func (r *userRepositoryImpl) UpdateWebAuthnCredential(credential *WebAuthnCredential) error {
+	result := r.db.Model(credential).
+		Select("sign_count", "clone_warning", "backup_state", "last_used_at").
+		Updates(credential)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteWebAuthnCredential remove uma passkey do usuário. Retorna false se ela não existir.
+func (r *userRepositoryImpl) DeleteWebAuthnCredential(userID, id uint) (bool, error) {
+	result := r.db.Where("user_id = ?", userID).Delete(&WebAuthnCredential{}, id)
+	return result.RowsAffected == 1, result.Error
+}
+
+// CountWebAuthnCredentials conta as passkeys do usuário
+func (r *userRepositoryImpl) CountWebAuthnCredentials(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&WebAuthnCredential{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+// CreateWebAuthnSession salva o desafio de uma cerimônia, descartando sessões expiradas
+func (r *userRepositoryImpl) CreateWebAuthnSession(session *WebAuthnSession) error {
+	if err := r.db.Where("expires_at < ?", time.Now()).Delete(&WebAuthnSession{}).Error; err != nil {
+		return err
+	}
+	return r.db.Create(session).Error
+}
+
+// TakeWebAuthnSession busca e remove a sessão, garantindo que cada desafio seja usado uma única vez
+func (r *userRepositoryImpl) TakeWebAuthnSession(id string) (*WebAuthnSession, error) {
+	var session WebAuthnSession
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND expires_at > ?", id, time.Now()).First(&session).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&WebAuthnSession{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound // Consumida em paralelo por outra requisição
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// CreateOneTimeToken salva um novo token de uso único
+func (r *userRepositoryImpl) CreateOneTimeToken(token *OneTimeToken) error {
+	return r.db.Create(token).Error
+}
+
+// GetActiveOneTimeTokenByHash busca um token ainda não usado e não expirado pelo hash
+func (r *userRepositoryImpl) GetActiveOneTimeTokenByHash(purpose, tokenHash string) (*OneTimeToken, error) {
+	var token OneTimeToken
+	err := r.db.Where("purpose = ? AND token_hash = ? AND used_at IS NULL AND expires_at > ?", purpose, tokenHash, time.Now()).
+		First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetLatestActiveOneTimeToken busca o token ativo mais recente do usuário para a finalidade
+func (r *userRepositoryImpl) GetLatestActiveOneTimeToken(userID uint, purpose string) (*OneTimeToken, error) {
+	var token OneTimeToken
+	err := r.db.Where("user_id = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", userID, purpose, time.Now()).
+		Order("created_at DESC").First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// ConsumeOneTimeToken marca o token como usado. Retorna false se ele já tiver sido usado.
+func (r *userRepositoryImpl) ConsumeOneTimeToken(id uint) (bool, error) {
+	result := r.db.Model(&OneTimeToken{}).Where("id = ? AND used_at IS NULL", id).Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// IncrementOneTimeTokenAttempts reserva uma tentativa de código. Retorna false quando o
+// limite já foi atingido, inclusive por tentativas paralelas.
+func (r *userRepositoryImpl) IncrementOneTimeTokenAttempts(id uint, maxAttempts int) (bool, error) {
+	result := r.db.Model(&OneTimeToken{}).Where("id = ? AND attempts < ?", id, maxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// InvalidateOneTimeTokens invalida todos os tokens ativos do usuário para a finalidade
+func (r *userRepositoryImpl) InvalidateOneTimeTokens(userID uint, purpose string) error {
+	return r.db.Model(&OneTimeToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+}
+
+// CountOneTimeTokensSince conta os tokens emitidos para o usuário desde o instante informado
+func (r *userRepositoryImpl) CountOneTimeTokensSince(userID uint, purpose string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.Model(&OneTimeToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at >= ?", userID, purpose, since).
+		Count(&count).Error
+	return count, err
+}
+
+// CreateTrustedDevice salva um novo dispositivo confiável
+func (r *userRepositoryImpl) CreateTrustedDevice(device *TrustedDevice) error {
+	return r.db.Create(device).Error
+}
+
+// GetActiveTrustedDevice busca um dispositivo confiável do usuário que ainda não expirou
+func (r *userRepositoryImpl) GetActiveTrustedDevice(userID, id uint) (*TrustedDevice, error) {
+	var device TrustedDevice
+	if err := r.db.Where("user_id = ? AND expires_at > ?", userID, time.Now()).First(&device, id).Error; err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// GetTrustedDevicesByUserID lista os dispositivos confiáveis ativos do usuário
+func (r *userRepositoryImpl) GetTrustedDevicesByUserID(userID uint) ([]TrustedDevice, error) {
+	var devices []TrustedDevice
+	err := r.db.Where("user_id = ? AND expires_at > ?", userID, time.Now()).Order("created_at DESC").Find(&devices).Error
+	return devices, err
+}
+
+// TouchTrustedDevice registra o último uso do dispositivo
+func (r *userRepositoryImpl) TouchTrustedDevice(id uint) error {
+	return r.db.Model(&TrustedDevice{}).Where("id = ?", id).Update("last_used_at", time.Now()).Error
+}
+
+// DeleteTrustedDevice revoga um dispositivo confiável do usuário. Retorna false se ele não existir.
+func (r *userRepositoryImpl) DeleteTrustedDevice(userID, id uint) (bool, error) {
+	result := r.db.Where("user_id = ?", userID).Delete(&TrustedDevice{}, id)
+	return result.RowsAffected == 1, result.Error
+}
+
+// DeleteTrustedDevices revoga todos os dispositivos confiáveis do usuário
+func (r *userRepositoryImpl) DeleteTrustedDevices(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&TrustedDevice{}).Error
+}
+
+// RecordFailedLogin incrementa atomicamente o contador de falhas de login e retorna o novo valor.
+// Se a última falha for mais antiga que window, a contagem recomeça em 1.
+func (r *userRepositoryImpl) RecordFailedLogin(id uint, now time.Time, window time.Duration) (int, error) {
+	result := r.db.Unscoped().Model(&User{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"failed_login_attempts": gorm.Expr("CASE WHEN last_failed_login_at IS NULL OR last_failed_login_at < ? THEN 1 ELSE failed_login_attempts + 1 END", now.Add(-window)),
+			"last_failed_login_at":  now,
+		})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	var attempts int
+	err := r.db.Unscoped().Model(&User{}).Where("id = ?", id).Select("failed_login_attempts").Scan(&attempts).Error
+	return attempts, err
+}
+
+// LockUser bloqueia o login até until. Um bloqueio mais longo já existente é mantido.
+func (r *userRepositoryImpl) LockUser(id uint, until time.Time) error {
+	return r.db.Unscoped().Model(&User{}).
+		Where("id = ? AND (locked_until IS NULL OR locked_until < ?)", id, until).
+		Update("locked_until", until).Error
+}
+
+// ResetFailedLogins zera o contador de falhas e remove o bloqueio de login
+func (r *userRepositoryImpl) ResetFailedLogins(id uint) error {
+	return r.db.Unscoped().Model(&User{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"failed_login_attempts": 0,
+			"last_failed_login_at":  nil,
+			"locked_until":          nil,
+			"status": gorm.Expr("CASE WHEN status = ? THEN (CASE WHEN email_verified_at IS NULL THEN ? ELSE ? END) ELSE status END",
+				StatusLocked, StatusPending, StatusActive),
+		}).Error
+}
+
+// TransitionUserStatus muda o estado da conta de from para to (com campos adicionais),
+// somente se o estado atual no banco ainda for from
+func (r *userRepositoryImpl) TransitionUserStatus(id uint, from, to string, fields map[string]interface{}) (bool, error) {
+	updates := map[string]interface{}{"status": to}
+	for column, value := range fields {
+		updates[column] = value
+	}
+	result := r.db.Unscoped().Model(&User{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// IsCanonicalEmailReserved indica se outra conta, inclusive excluída e ainda restaurável,
+// usa a mesma caixa postal (mesmo email canônico)
+func (r *userRepositoryImpl) IsCanonicalEmailReserved(canonical string, exceptID uint) (bool, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&User{}).
+		Where("canonical_email = ? AND id <> ? AND purged_at IS NULL", canonical, exceptID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetUsersWithoutCanonicalEmail lista contas (inclusive excluídas) ainda sem email canônico
+func (r *userRepositoryImpl) GetUsersWithoutCanonicalEmail(limit int) ([]User, error) {
+	var users []User
+	err := r.db.Unscoped().
+		Where("(canonical_email IS NULL OR canonical_email = '') AND purged_at IS NULL").
+		Limit(limit).
+		Find(&users).Error
+	return users, err
+}
+
+// SetCanonicalEmail grava o email canônico da conta
+func (r *userRepositoryImpl) SetCanonicalEmail(id uint, canonical string) error {
+	return r.db.Unscoped().Model(&User{}).Where("id = ?", id).Update("canonical_email", canonical).Error
+}
+
+// IsUsernameSkeletonReserved indica se outra conta, inclusive excluída e ainda restaurável,
+// tem um nome de usuário confundível (mesmo esqueleto)
+func (r *userRepositoryImpl) IsUsernameSkeletonReserved(skeleton string, exceptID uint) (bool, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&User{}).
+		Where("username_skeleton = ? AND id <> ? AND purged_at IS NULL", skeleton, exceptID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetUsersWithoutUsernameSkeleton lista contas (inclusive excluídas) criadas antes da normalização de identificadores
+func (r *userRepositoryImpl) GetUsersWithoutUsernameSkeleton(limit int) ([]User, error) {
+	var users []User
+	err := r.db.Unscoped().
+		Where("(username_skeleton IS NULL OR username_skeleton = '') AND purged_at IS NULL").
+		Order("id").
+		Limit(limit).
+		Find(&users).Error
+	return users, err
+}
+
+// ListUsers lista uma página de usuários que atendem ao filtro, na ordem de page.Sort,
+// começando logo após a posição page.After (nil para a primeira página)
+func (r *userRepositoryImpl) ListUsers(filter UserListFilter, page UserListPage) ([]User, error) {
+	direction, comparison := "ASC", ">"
+	if page.Desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	query := r.filterUsers(filter)
+	if page.After != nil {
+		if page.Sort == "id" {
+			query = query.Where("id "+comparison+" ?", page.After.ID)
+		} else {
+			query = query.Where("("+page.Sort+", id) "+comparison+" (?, ?)", page.After.Value, page.After.ID)
+		}
+	}
+	if page.Sort != "id" {
+		query = query.Order(page.Sort + " " + direction)
+	}
+
+	var users []User
+	err := query.Order("id " + direction).Limit(page.Limit).Find(&users).Error
+	return users, err
+}
+
+// CountUsers conta os usuários que atendem ao filtro
+func (r *userRepositoryImpl) CountUsers(filter UserListFilter) (int64, error) {
+	var count int64
+	err := r.filterUsers(filter).Count(&count).Error
+	return count, err
+}
+
+// filterUsers monta a consulta de usuários com os critérios do filtro. Contas excluídas só
+// aparecem quando o filtro pede o estado "deleted"; contas expurgadas nunca aparecem.
+func (r *userRepositoryImpl) filterUsers(filter UserListFilter) *gorm.DB {
+	query := r.db.Model(&User{})
+	for _, status := range filter.Statuses {
+		if status == StatusDeleted {
+			query = query.Unscoped().Where("purged_at IS NULL")
+			break
+		}
+	}
+
+	if len(filter.Statuses) > 0 {
+		query = query.Where("status IN ?", filter.Statuses)
+	}
+	if filter.CreatedFrom != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		query = query.Where("created_at < ?", *filter.CreatedTo)
+	}
+	if filter.Verified != nil {
+		if *filter.Verified {
+			query = query.Where("email_verified_at IS NOT NULL")
+		} else {
+			query = query.Where("email_verified_at IS NULL")
+		}
+	}
+	if filter.RoleID != nil {
+		byRole := r.db.Model(&UserRole{}).Select("user_id").Where("role_id = ?", *filter.RoleID)
+		if len(filter.RoleGroupIDs) > 0 {
+			byGroup := r.db.Model(&GroupUser{}).Select("user_id").Where("group_id IN ?", filter.RoleGroupIDs)
+			query = query.Where("(id IN (?) OR id IN (?))", byRole, byGroup)
+		} else {
+			query = query.Where("id IN (?)", byRole)
+		}
+	}
+	if filter.Search != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(filter.Search)) + "%"
+		query = query.Where(`(LOWER(username) LIKE ? ESCAPE '\' OR LOWER(email) LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+	return query
+}
+
+// likeEscaper escapa os curingas de LIKE para que a busca trate o termo literalmente
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// SetNormalizedIdentifiers grava o nome de usuário e o email normalizados e o esqueleto do nome.
+// Se o email mudar, o email canônico é limpo para ser recalculado por BackfillCanonicalEmails.
+func (r *userRepositoryImpl) SetNormalizedIdentifiers(id uint, username, email, skeleton string) error {
+	return r.db.Unscoped().Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"username":          username,
+		"email":             email,
+		"username_skeleton": skeleton,
+		"canonical_email":   gorm.Expr("CASE WHEN email = ? THEN canonical_email ELSE '' END", email),
+	}).Error
+}
+
+// GetDeletedUserByID busca uma conta excluída que ainda não foi expurgada
+func (r *userRepositoryImpl) GetDeletedUserByID(id uint) (*User, error) {
+	var user User
+	if err := r.db.Unscoped().Where("deleted_at IS NOT NULL AND purged_at IS NULL").First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetDeletedUserByUsernameOrEmail busca uma conta excluída, ainda não expurgada, pelo nome de usuário ou email
+func (r *userRepositoryImpl) GetDeletedUserByUsernameOrEmail(identifier string) (*User, error) {
+	var user User
+	if err := r.db.Unscoped().
+		Where("(username IN ? OR email IN ?) AND deleted_at IS NOT NULL AND purged_at IS NULL",
+			lookupKeys(usernameKey(identifier), identifier), lookupKeys(emailKey(identifier), identifier)).
+		Order(exactMatchFirst(identifier, "username", "email")).
+		First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// RestoreUser desfaz a exclusão lógica, levando a conta ao estado informado.
+// Retorna false se a conta não estiver excluída ou já tiver sido expurgada.
+func (r *userRepositoryImpl) RestoreUser(id uint, status string) (bool, error) {
+	result := r.db.Unscoped().Model(&User{}).
+		Where("id = ? AND deleted_at IS NOT NULL AND purged_at IS NULL", id).
+		Updates(map[string]interface{}{"deleted_at": nil, "status": status, "status_before_deletion": ""})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// GetUsersToPurge lista contas excluídas antes de deletedBefore e ainda não expurgadas
+func (r *userRepositoryImpl) GetUsersToPurge(deletedBefore time.Time, limit int) ([]User, error) {
+	var users []User
+	err := r.db.Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ? AND purged_at IS NULL", deletedBefore).
+		Order("deleted_at").
+		Limit(limit).
+		Find(&users).Error
+	return users, err
+}
+
+// EraseUser apaga os dados pessoais da conta sem remover linhas referenciadas: credenciais e tokens
+// são excluídos, o histórico de auditoria e os convites perdem os dados pessoais e a linha do usuário
+// vira um registro anonimizado (excluído, sem restauração). O recibo é gravado na mesma transação.
+// Retorna gorm.ErrRecordNotFound se a conta não existir ou já tiver sido apagada.
+func (r *userRepositoryImpl) EraseUser(id uint, receipt *ErasureReceipt) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Unscoped().Model(&User{}).
+			Where("id = ? AND purged_at IS NULL", id).
+			Updates(map[string]interface{}{
+				"username":              fmt.Sprintf("deleted-%d", id),
+				"email":                 fmt.Sprintf("deleted-%d@invalid", id),
+				"password":              "",
+				"status":                StatusDeleted,
+				"email_verified_at":     nil,
+				"pending_email":         "",
+				"canonical_email":       "",
+				"username_skeleton":     "",
+				"totp_secret":           "",
+				"totp_enabled":          false,
+				"phone_number":          "",
+				"phone_verified_at":     nil,
+				"pending_phone_number":  "",
+				"smsmfa_enabled":        false,
+				"suspension_reason":     "",
+				"failed_login_attempts": 0,
+				"last_failed_login_at":  nil,
+				"locked_until":          nil,
+				"display_name":          nil,
+				"given_name":            nil,
+				"family_name":           nil,
+				"locale":                nil,
+				"timezone":              nil,
+				"bio":                   nil,
+				"avatar_url":            nil,
+				"deleted_at":            gorm.Expr("COALESCE(deleted_at, ?)", now),
+				"purged_at":             now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		for _, model := range []interface{}{&RecoveryCode{}, &WebAuthnCredential{}, &WebAuthnSession{}, &OneTimeToken{}, &TrustedDevice{}, &UserRole{}, &Membership{}, &GroupUser{}} {
+			if err := tx.Where("user_id = ?", id).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("subject_namespace = ? AND subject_object_id = ?", relations.UserNamespace, strconv.FormatUint(uint64(id), 10)).
+			Delete(&RelationTuple{}).Error; err != nil {
+			return err
+		}
+
+		// Eventos são mantidos (ação e data), sem IP, navegador e detalhes livres
+		if err := tx.Model(&AuditEvent{}).
+			Where("user_id = ? OR actor_id = ?", id, id).
+			Updates(map[string]interface{}{"ip_address": "", "user_agent": "", "details": ""}).Error; err != nil {
+			return err
+		}
+
+		// O aceite continua comprovado (documento e data), sem IP e navegador
+		if err := tx.Model(&LegalAcceptance{}).
+			Where("user_id = ?", id).
+			Updates(map[string]interface{}{"ip_address": "", "user_agent": ""}).Error; err != nil {
+			return err
+		}
+
+		// O email do convidado é dado pessoal de terceiro que só existia por causa deste usuário.
+		// O convite usado pelo próprio usuário no cadastro também guarda o email dele.
+		if err := tx.Model(&Invitation{}).
+			Where("created_by_id = ? OR id = (?)", id, tx.Unscoped().Model(&User{}).Select("invitation_id").Where("id = ?", id)).
+			Update("email", "").Error; err != nil {
+			return err
+		}
+
+		// Os arquivos são removidos por PurgeExpiredDataExports
+		if err := tx.Model(&DataExport{}).
+			Where("user_id = ?", id).
+			Updates(map[string]interface{}{"status": DataExportFailed, "expires_at": now, "token_hash": ""}).Error; err != nil {
+			return err
+		}
+
+		receipt.UserID = id
+		return tx.Create(receipt).Error
+	})
+}
+
+// CreateInvitation cria um convite de cadastro
+func (r *userRepositoryImpl) CreateInvitation(invitation *Invitation) error {
+	return r.db.Create(invitation).Error
+}
+
+// GetInvitationByCodeHash busca um convite pelo hash do código, válido ou não
+func (r *userRepositoryImpl) GetInvitationByCodeHash(codeHash string) (*Invitation, error) {
+	var invitation Invitation
+	if err := r.db.Where("code_hash = ?", codeHash).First(&invitation).Error; err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// GetInvitations lista os convites criados pelo usuário (createdByID 0 lista todos)
+func (r *userRepositoryImpl) GetInvitations(createdByID uint) ([]Invitation, error) {
+	var invitations []Invitation
+	query := r.db.Order("created_at DESC")
+	if createdByID != 0 {
+		query = query.Where("created_by_id = ?", createdByID)
+	}
+	err := query.Find(&invitations).Error
+	return invitations, err
+}
+
+// UseInvitation consome atomicamente um uso do convite, se ainda for válido.
+// Retorna false se o convite estiver esgotado, expirado ou revogado.
+func (r *userRepositoryImpl) UseInvitation(id uint) (bool, error) {
+	result := r.db.Model(&Invitation{}).
+		Where("id = ? AND uses < max_uses AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", id, time.Now()).
+		Update("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReleaseInvitation devolve um uso consumido por um cadastro que não foi concluído
+func (r *userRepositoryImpl) ReleaseInvitation(id uint) error {
+	return r.db.Model(&Invitation{}).
+		Where("id = ? AND uses > 0", id).
+		Update("uses", gorm.Expr("uses - 1")).Error
+}
+
+// RevokeInvitation revoga um convite (createdByID 0 permite revogar convites de qualquer usuário)
+func (r *userRepositoryImpl) RevokeInvitation(id uint, createdByID uint) (bool, error) {
+	query := r.db.Model(&Invitation{}).Where("id = ? AND revoked_at IS NULL", id)
+	if createdByID != 0 {
+		query = query.Where("created_by_id = ?", createdByID)
+	}
+	result := query.Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// CreateAuditEvent registra um evento de auditoria
+func (r *userRepositoryImpl) CreateAuditEvent(event *AuditEvent) error {
+	return r.db.Create(event).Error
+}
+
+// GetAuditEventsByUserID lista os eventos de auditoria da conta, do mais recente ao mais antigo
+func (r *userRepositoryImpl) GetAuditEventsByUserID(userID uint) ([]AuditEvent, error) {
+	var events []AuditEvent
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&events).Error
+	return events, err
+}
+
+// CreateDataExport registra um pedido de exportação de dados
+func (r *userRepositoryImpl) CreateDataExport(export *DataExport) error {
+	return r.db.Create(export).Error
+}
+
+// GetDataExport busca um pedido de exportação do usuário
+func (r *userRepositoryImpl) GetDataExport(userID, id uint) (*DataExport, error) {
+	var export DataExport
+	if err := r.db.Where("id = ? AND user_id = ?", id, userID).First(&export).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// GetDataExportByID busca um pedido de exportação pelo ID
+func (r *userRepositoryImpl) GetDataExportByID(id uint) (*DataExport, error) {
+	var export DataExport
+	if err := r.db.First(&export, id).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// GetPendingDataExport busca um pedido de exportação do usuário ainda em geração
+func (r *userRepositoryImpl) GetPendingDataExport(userID uint) (*DataExport, error) {
+	var export DataExport
+	if err := r.db.Where("user_id = ? AND status = ?", userID, DataExportPending).First(&export).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// FinishDataExport grava o resultado de uma exportação pendente. Retorna false se ela deixou de
+// estar pendente (por exemplo, invalidada pelo apagamento dos dados do usuário).
+func (r *userRepositoryImpl) FinishDataExport(export *DataExport) (bool, error) {
+	result := r.db.Model(&DataExport{}).
+		Where("id = ? AND status = ?", export.ID, DataExportPending).
+		Updates(map[string]interface{}{
+			"status":       export.Status,
+			"file_path":    export.FilePath,
+			"token_hash":   export.TokenHash,
+			"error":        export.Error,
+			"expires_at":   export.ExpiresAt,
+			"completed_at": export.CompletedAt,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetExpiredDataExports lista exportações prontas ou com falha cuja validade venceu,
+// e as pendentes criadas antes de stalePendingBefore
+func (r *userRepositoryImpl) GetExpiredDataExports(now, stalePendingBefore time.Time) ([]DataExport, error) {
+	var exports []DataExport
+	err := r.db.Where("(status IN ? AND expires_at < ?) OR (status = ? AND created_at < ?)",
+		[]string{DataExportReady, DataExportFailed}, now, DataExportPending, stalePendingBefore).
+		Find(&exports).Error
+	return exports, err
+}
+
+// DeleteDataExport remove o registro de uma exportação
+func (r *userRepositoryImpl) DeleteDataExport(id uint) error {
+	return r.db.Delete(&DataExport{}, id).Error
+}
+
+// GetRecoveryCodesByUserID lista os códigos de recuperação (usados ou não) do usuário
+func (r *userRepositoryImpl) GetRecoveryCodesByUserID(userID uint) ([]RecoveryCode, error) {
+	var codes []RecoveryCode
+	err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&codes).Error
+	return codes, err
+}
+
+// GetOneTimeTokensByUserID lista os tokens de uso único emitidos para o usuário
+func (r *userRepositoryImpl) GetOneTimeTokensByUserID(userID uint) ([]OneTimeToken, error) {
+	var tokens []OneTimeToken
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// GetAllTrustedDevicesByUserID lista os dispositivos confiáveis do usuário, inclusive expirados
+func (r *userRepositoryImpl) GetAllTrustedDevicesByUserID(userID uint) ([]TrustedDevice, error) {
+	var devices []TrustedDevice
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&devices).Error
+	return devices, err
+}
+
+// CreateLegalDocument publica uma nova versão de documento legal
+func (r *userRepositoryImpl) CreateLegalDocument(document *LegalDocument) error {
+	return r.db.Create(document).Error
+}
+
+// GetLegalDocuments lista todas as versões de documentos legais, das mais recentes às mais antigas
+func (r *userRepositoryImpl) GetLegalDocuments() ([]LegalDocument, error) {
+	var documents []LegalDocument
+	err := r.db.Order("effective_at DESC").Find(&documents).Error
+	return documents, err
+}
+
+// GetEffectiveLegalDocuments lista as versões já em vigor, das mais recentes às mais antigas
+func (r *userRepositoryImpl) GetEffectiveLegalDocuments(now time.Time) ([]LegalDocument, error) {
+	var documents []LegalDocument
+	err := r.db.Where("effective_at <= ?", now).Order("effective_at DESC, id DESC").Find(&documents).Error
+	return documents, err
+}
+
+// GetAcceptedDocumentIDs retorna quais dos documentos informados o usuário já aceitou
+func (r *userRepositoryImpl) GetAcceptedDocumentIDs(userID uint, documentIDs []uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&LegalAcceptance{}).
+		Where("user_id = ? AND document_id IN ?", userID, documentIDs).
+		Pluck("document_id", &ids).Error
+	return ids, err
+}
+
+// CreateLegalAcceptances registra aceites, ignorando os que já existem
+func (r *userRepositoryImpl) CreateLegalAcceptances(acceptances []LegalAcceptance) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&acceptances).Error
+}
+
+// GetLegalAcceptancesByUserID lista os aceites do usuário
+func (r *userRepositoryImpl) GetLegalAcceptancesByUserID(userID uint) ([]LegalAcceptance, error) {
+	var acceptances []LegalAcceptance
+	err := r.db.Where("user_id = ?", userID).Order("accepted_at").Find(&acceptances).Error
+	return acceptances, err
+}
+
+// EnsurePermissions cria as permissões do catálogo que ainda não existem e atualiza as descrições
+func (r *userRepositoryImpl) EnsurePermissions(permissions []Permission) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"description"}),
+	}).Create(&permissions).Error
+}
+
+// GetPermissions lista todas as permissões
+func (r *userRepositoryImpl) GetPermissions() ([]Permission, error) {
+	var permissions []Permission
+	err := r.db.Order("name").Find(&permissions).Error
+	return permissions, err
+}
+
+// GetPermissionsByNames busca as permissões pelos nomes
+func (r *userRepositoryImpl) GetPermissionsByNames(names []string) ([]Permission, error) {
+	var permissions []Permission
+	if len(names) == 0 {
+		return permissions, nil
+	}
+	err := r.db.Where("name IN ?", names).Order("name").Find(&permissions).Error
+	return permissions, err
+}
+
+// CreateRole cria um papel com as permissões informadas em role.Permissions
+func (r *userRepositoryImpl) CreateRole(role *Role) error {
+	return r.db.Create(role).Error
+}
+
+// GetRoles lista os papéis com suas permissões
+func (r *userRepositoryImpl) GetRoles() ([]Role, error) {
+	var roles []Role
+	err := r.db.Preload("Permissions").Order("name").Find(&roles).Error
+	return roles, err
+}
+
+// GetRoleByID busca um papel com suas permissões
+func (r *userRepositoryImpl) GetRoleByID(id uint) (*Role, error) {
+	var role Role
+	if err := r.db.Preload("Permissions").First(&role, id).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// GetRoleByName busca um papel pelo nome, com suas permissões
+func (r *userRepositoryImpl) GetRoleByName(name string) (*Role, error) {
+	var role Role
+	if err := r.db.Preload("Permissions").Where("name = ?", name).First(&role).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// UpdateRole grava a descrição do papel e substitui suas permissões
+func (r *userRepositoryImpl) UpdateRole(role *Role, permissions []Permission) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(role).Update("description", role.Description).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(role).Association("Permissions").Replace(permissions); err != nil {
+			return err
+		}
+		role.Permissions = permissions
+		return nil
+	})
+}
+
+// DeleteRole remove o papel, suas permissões e as atribuições a usuários
+func (r *userRepositoryImpl) DeleteRole(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		role := &Role{ID: id}
+		if err := tx.Model(role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", id).Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM group_roles WHERE role_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(role).Error
+	})
+}
+
+// GetUserRoles lista os papéis atribuídos ao usuário, com suas permissões
+func (r *userRepositoryImpl) GetUserRoles(userID uint) ([]Role, error) {
+	var roles []Role
+	err := r.db.Preload("Permissions").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name").
+		Find(&roles).Error
+	return roles, err
+}
+
+// AssignRole atribui o papel ao usuário. Retorna false se ele já o tinha.
+func (r *userRepositoryImpl) AssignRole(userID, roleID uint, assignedByID *uint) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&UserRole{UserID: userID, RoleID: roleID, AssignedByID: assignedByID})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RevokeRole retira o papel do usuário. Retorna false se ele não o tinha.
+func (r *userRepositoryImpl) RevokeRole(userID, roleID uint) (bool, error) {
+	result := r.db.Where("user_id = ? AND role_id = ?", userID, roleID).Delete(&UserRole{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RevokeRoleKeepingHolder retira o papel do usuário desde que outra conta ativa continue com ele,
+// diretamente ou herdado de um grupo. Revogações do mesmo papel são serializadas pelo bloqueio da
+// linha do papel, para que duas não retirem ao mesmo tempo os dois últimos titulares.
+// Retorna errLastRoleHolder se ninguém mais ficaria com o papel, e false se o usuário não o tinha.
+func (r *userRepositoryImpl) RevokeRoleKeepingHolder(userID, roleID uint) (bool, error) {
+	revoked := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var role Role
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&role, roleID).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("user_id = ? AND role_id = ?", userID, roleID).Delete(&UserRole{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		revoked = true
+
+		// Quem está num subgrupo herda os papéis dos grupos que o contêm
+		txRepo := &userRepositoryImpl{db: tx}
+		groupIDs, err := txRepo.GetGroupIDsWithRole(roleID)
+		if err != nil {
+			return err
+		}
+		if groupIDs, err = closure(groupIDs, txRepo.GetChildGroupIDs); err != nil {
+			return err
+		}
+
+		holdersQuery := tx.Model(&User{}).
+			Where("id IN (?)", tx.Model(&UserRole{}).Select("user_id").Where("role_id = ?", roleID))
+		if len(groupIDs) > 0 {
+			holdersQuery = tx.Model(&User{}).Where("(id IN (?) OR id IN (?))",
+				tx.Model(&UserRole{}).Select("user_id").Where("role_id = ?", roleID),
+				tx.Model(&GroupUser{}).Select("user_id").Where("group_id IN ?", groupIDs))
+		}
+		var holders int64
+		if err := holdersQuery.Count(&holders).Error; err != nil {
+			return err
+		}
+		if holders == 0 {
+			return errLastRoleHolder
+		}
+		return nil
+	})
+	return revoked, err
+}
+
+// MigrateLegacyAdmins atribui o papel às contas marcadas pela antiga coluna is_admin, se ela ainda
+// existir, e desmarca a coluna, para que a marcação não volte a conceder o papel
+func (r *userRepositoryImpl) MigrateLegacyAdmins(roleID uint) (int, error) {
+	if !r.db.Migrator().HasColumn(&User{}, "is_admin") {
+		return 0, nil
+	}
+	migrated := 0
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		if err := tx.Unscoped().Model(&User{}).
+			Where("is_admin = ? AND purged_at IS NULL", true).
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&UserRole{UserID: id, RoleID: roleID}).Error; err != nil {
+				return err
+			}
+		}
+		migrated = len(ids)
+		return tx.Unscoped().Model(&User{}).Where("is_admin = ?", true).Update("is_admin", false).Error
+	})
+	return migrated, err
+}
+
+// CreateOrganization cria a organização e, se ownerID não for zero, torna esse usuário dono dela
+func (r *userRepositoryImpl) CreateOrganization(org *Organization, ownerID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		if ownerID == 0 {
+			return nil
+		}
+		return tx.Create(&Membership{OrganizationID: org.ID, UserID: ownerID, Role: OrgRoleOwner}).Error
+	})
+}
+
+// GetOrganizationByID busca uma organização pelo ID
+func (r *userRepositoryImpl) GetOrganizationByID(id uint) (*Organization, error) {
+	var org Organization
+	if err := r.db.First(&org, id).Error; err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// GetOrganizationBySlug busca uma organização pelo identificador curto
+func (r *userRepositoryImpl) GetOrganizationBySlug(slug string) (*Organization, error) {
+	var org Organization
+	if err := r.db.Where("slug = ?", slug).First(&org).Error; err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// GetUserMemberships lista as organizações do usuário, da mais antiga para a mais recente
+func (r *userRepositoryImpl) GetUserMemberships(userID uint) ([]Membership, error) {
+	var memberships []Membership
+	err := r.db.Preload("Organization").Where("user_id = ?", userID).Order("id").Find(&memberships).Error
+	return memberships, err
+}
+
+// GetMembership busca o vínculo do usuário com a organização
+func (r *userRepositoryImpl) GetMembership(orgID, userID uint) (*Membership, error) {
+	var membership Membership
+	if err := r.db.Where("organization_id = ? AND user_id = ?", orgID, userID).First(&membership).Error; err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// GetOrganizationMembers lista os membros (contas não excluídas) de uma organização
+func (r *userRepositoryImpl) GetOrganizationMembers(orgID uint) ([]Membership, error) {
+	var memberships []Membership
+	err := r.db.Preload("User").
+		Joins("JOIN users ON users.id = memberships.user_id AND users.deleted_at IS NULL").
+		Where("memberships.organization_id = ?", orgID).
+		Order("memberships.id").
+		Find(&memberships).Error
+	return memberships, err
+}
+
+// AddMembership adiciona o usuário à organização. Retorna false se ele já era membro.
+func (r *userRepositoryImpl) AddMembership(membership *Membership) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(membership)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// UpdateMembershipRole altera o papel do membro na organização.
+// Retorna errLastOrganizationOwner se a organização ficaria sem dono (ver keepingOrganizationOwner).
+func (r *userRepositoryImpl) UpdateMembershipRole(orgID, userID uint, role string) error {
+	return r.keepingOrganizationOwner(orgID, userID, func(tx *gorm.DB) (int64, error) {
+		result := tx.Model(&Membership{}).
+			Where("organization_id = ? AND user_id = ?", orgID, userID).
+			Update("role", role)
+		return result.RowsAffected, result.Error
+	})
+}
+
+// RemoveMembership retira o usuário da organização. Retorna false se ele não era membro, e
+// errLastOrganizationOwner se a organização ficaria sem dono (ver keepingOrganizationOwner).
+func (r *userRepositoryImpl) RemoveMembership(orgID, userID uint) (bool, error) {
+	removed := false
+	err := r.keepingOrganizationOwner(orgID, userID, func(tx *gorm.DB) (int64, error) {
+		result := tx.Where("organization_id = ? AND user_id = ?", orgID, userID).Delete(&Membership{})
+		removed = result.RowsAffected == 1
+		return result.RowsAffected, result.Error
+	})
+	return removed, err
+}
+
+// keepingOrganizationOwner aplica a alteração do vínculo do usuário numa transação que bloqueia as
+// linhas dos donos da organização, para que duas alterações não retirem ao mesmo tempo os dois
+// últimos donos. Se o usuário era dono e a organização ficaria sem nenhum, desfaz a alteração e
+// retorna errLastOrganizationOwner.
+func (r *userRepositoryImpl) keepingOrganizationOwner(orgID, userID uint, change func(tx *gorm.DB) (int64, error)) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var owners []Membership
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("organization_id = ? AND role = ?", orgID, OrgRoleOwner).
+			Find(&owners).Error; err != nil {
+			return err
+		}
+		wasOwner := false
+		for _, owner := range owners {
+			if owner.UserID == userID {
+				wasOwner = true
+			}
+		}
+
+		changed, err := change(tx)
+		if err != nil || changed == 0 || !wasOwner {
+			return err
+		}
+
+		remaining, err := (&userRepositoryImpl{db: tx}).CountOrganizationOwners(orgID)
+		if err != nil {
+			return err
+		}
+		if remaining == 0 {
+			return errLastOrganizationOwner
+		}
+		return nil
+	})
+}
+
+// CountOrganizationOwners conta os donos (contas não excluídas) da organização
+func (r *userRepositoryImpl) CountOrganizationOwners(orgID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&Membership{}).
+		Joins("JOIN users ON users.id = memberships.user_id AND users.deleted_at IS NULL").
+		Where("memberships.organization_id = ? AND memberships.role = ?", orgID, OrgRoleOwner).
+		Count(&count).Error
+	return count, err
+}
+
+// AddUsersWithoutMembership coloca na organização, com o papel informado, todas as contas
+// (inclusive excluídas e restauráveis) que ainda não pertencem a nenhuma
+func (r *userRepositoryImpl) AddUsersWithoutMembership(orgID uint, role string) (int64, error) {
+	result := r.db.Exec(`INSERT INTO memberships (organization_id, user_id, role, created_at)
+		SELECT ?, users.id, ?, ? FROM users
+		WHERE users.purged_at IS NULL
+		AND NOT EXISTS (SELECT 1 FROM memberships m WHERE m.user_id = users.id)`,
+		orgID, role, time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// PromoteRoleHoldersToOwner torna donos da organização os membros que têm o papel diretamente
+func (r *userRepositoryImpl) PromoteRoleHoldersToOwner(orgID, roleID uint) error {
+	return r.db.Model(&Membership{}).
+		Where("organization_id = ? AND user_id IN (?)", orgID, r.db.Model(&UserRole{}).Select("user_id").Where("role_id = ?", roleID)).
+		Update("role", OrgRoleOwner).Error
+}
+
+// GetRolesByIDs busca os papéis pelos IDs
+func (r *userRepositoryImpl) GetRolesByIDs(ids []uint) ([]Role, error) {
+	var roles []Role
+	if len(ids) == 0 {
+		return roles, nil
+	}
+	err := r.db.Where("id IN ?", ids).Order("name").Find(&roles).Error
+	return roles, err
+}
+
+// CreateGroup cria um grupo com os papéis informados em group.Roles
+func (r *userRepositoryImpl) CreateGroup(group *Group) error {
+	return r.db.Create(group).Error
+}
+
+// GetGroups lista os grupos com seus papéis
+func (r *userRepositoryImpl) GetGroups() ([]Group, error) {
+	var groups []Group
+	err := r.db.Preload("Roles").Order("name").Find(&groups).Error
+	return groups, err
+}
+
+// GetGroupByID busca um grupo com seus papéis
+func (r *userRepositoryImpl) GetGroupByID(id uint) (*Group, error) {
+	var group Group
+	if err := r.db.Preload("Roles").First(&group, id).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// GetGroupByName busca um grupo pelo nome
+func (r *userRepositoryImpl) GetGroupByName(name string) (*Group, error) {
+	var group Group
+	if err := r.db.Where("name = ?", name).First(&group).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// GetGroupsByIDs busca os grupos pelos IDs (sem os papéis)
+func (r *userRepositoryImpl) GetGroupsByIDs(ids []uint) ([]Group, error) {
+	var groups []Group
+	if len(ids) == 0 {
+		return groups, nil
+	}
+	err := r.db.Where("id IN ?", ids).Order("name").Find(&groups).Error
+	return groups, err
+}
+
+// UpdateGroup grava a descrição do grupo e substitui seus papéis
+func (r *userRepositoryImpl) UpdateGroup(group *Group, roles []Role) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(group).Update("description", group.Description).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(group).Association("Roles").Replace(roles); err != nil {
+			return err
+		}
+		group.Roles = roles
+		return nil
+	})
+}
+
+// DeleteGroup remove o grupo, seus papéis, seus membros e suas ligações com outros grupos
+func (r *userRepositoryImpl) DeleteGroup(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		group := &Group{ID: id}
+		if err := tx.Model(group).Association("Roles").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", id).Delete(&GroupUser{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("parent_id = ? OR child_id = ?", id, id).Delete(&GroupSubgroup{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(group).Error
+	})
+}
+
+// AddGroupUser coloca o usuário no grupo. Retorna false se ele já era membro direto.
+func (r *userRepositoryImpl) AddGroupUser(groupID, userID uint) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&GroupUser{GroupID: groupID, UserID: userID})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RemoveGroupUser retira o usuário do grupo. Retorna false se ele não era membro direto.
+func (r *userRepositoryImpl) RemoveGroupUser(groupID, userID uint) (bool, error) {
+	result := r.db.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&GroupUser{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// GetGroupUsers lista os membros diretos (contas não excluídas) do grupo
+func (r *userRepositoryImpl) GetGroupUsers(groupID uint) ([]User, error) {
+	var users []User
+	err := r.db.Joins("JOIN group_users ON group_users.user_id = users.id").
+		Where("group_users.group_id = ?", groupID).
+		Order("users.username").
+		Find(&users).Error
+	return users, err
+}
+
+// AddSubgroup coloca o grupo childID dentro de parentID. Retorna false se já estava, e
+// errGroupCycle se o grupo passaria a conter a si mesmo. A verificação e a inclusão correm numa
+// transação que bloqueia o filho e o pai com todos os grupos que o contêm: duas inclusões que
+// juntas fechariam um ciclo disputam alguma dessas linhas, e a segunda enxerga a primeira.
+func (r *userRepositoryImpl) AddSubgroup(parentID, childID uint) (bool, error) {
+	added := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		txRepo := &userRepositoryImpl{db: tx}
+		ancestors, err := closure([]uint{parentID}, txRepo.GetParentGroupIDs)
+		if err != nil {
+			return err
+		}
+		var locked []Group
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", append(ancestors, childID)).
+			Order("id").
+			Find(&locked).Error; err != nil {
+			return err
+		}
+
+		cycle, err := createsCycle(txRepo, parentID, childID)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return errGroupCycle
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&GroupSubgroup{ParentID: parentID, ChildID: childID})
+		added = result.RowsAffected == 1
+		return result.Error
+	})
+	return added, err
+}
+
+// RemoveSubgroup retira o grupo childID de parentID. Retorna false se não estava.
+func (r *userRepositoryImpl) RemoveSubgroup(parentID, childID uint) (bool, error) {
+	result := r.db.Where("parent_id = ? AND child_id = ?", parentID, childID).Delete(&GroupSubgroup{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// GetSubgroups lista os grupos contidos diretamente no grupo
+func (r *userRepositoryImpl) GetSubgroups(parentID uint) ([]Group, error) {
+	var groups []Group
+	err := r.db.Joins("JOIN group_subgroups ON group_subgroups.child_id = groups.id").
+		Where("group_subgroups.parent_id = ?", parentID).
+		Order("groups.name").
+		Find(&groups).Error
+	return groups, err
+}
+
+// GetUserGroupIDs lista os grupos em que o usuário está diretamente
+func (r *userRepositoryImpl) GetUserGroupIDs(userID uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&GroupUser{}).Where("user_id = ?", userID).Pluck("group_id", &ids).Error
+	return ids, err
+}
+
+// GetParentGroupIDs lista os grupos que contêm diretamente algum dos grupos informados
+func (r *userRepositoryImpl) GetParentGroupIDs(childIDs []uint) ([]uint, error) {
+	var ids []uint
+	if len(childIDs) == 0 {
+		return ids, nil
+	}
+	err := r.db.Model(&GroupSubgroup{}).Where("child_id IN ?", childIDs).Distinct().Pluck("parent_id", &ids).Error
+	return ids, err
+}
+
+// GetChildGroupIDs lista os grupos contidos diretamente em algum dos grupos informados
+func (r *userRepositoryImpl) GetChildGroupIDs(parentIDs []uint) ([]uint, error) {
+	var ids []uint
+	if len(parentIDs) == 0 {
+		return ids, nil
+	}
+	err := r.db.Model(&GroupSubgroup{}).Where("parent_id IN ?", parentIDs).Distinct().Pluck("child_id", &ids).Error
+	return ids, err
+}
+
+// GetGroupIDsWithRole lista os grupos que têm o papel diretamente
+func (r *userRepositoryImpl) GetGroupIDsWithRole(roleID uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.Table("group_roles").Where("role_id = ?", roleID).Pluck("group_id", &ids).Error
+	return ids, err
+}
+
+// GetGroupRoles lista, sem repetição, os papéis dos grupos informados, com suas permissões
+func (r *userRepositoryImpl) GetGroupRoles(groupIDs []uint) ([]Role, error) {
+	var roles []Role
+	if len(groupIDs) == 0 {
+		return roles, nil
+	}
+	err := r.db.Preload("Permissions").
+		Where("id IN (?)", r.db.Table("group_roles").Select("role_id").Where("group_id IN ?", groupIDs)).
+		Order("name").
+		Find(&roles).Error
+	return roles, err
+}
+
+// usernameKey normaliza o nome de usuário para busca; valores que não passam na
+// normalização são buscados como vieram (sem espaços nas pontas)
+func usernameKey(username string) string {
+	if normalized, err := identifier.NormalizeUsername(username); err == nil {
+		return normalized
+	}
+	return strings.TrimSpace(username)
+}
+
+// emailKey normaliza o email para busca, com o mesmo critério de usernameKey
+func emailKey(email string) string {
+	if normalized, err := identifier.NormalizeEmail(email); err == nil {
+		return normalized
+	}
+	return strings.TrimSpace(email)
+}
+
+// lookupKeys retorna as chaves de busca de um identificador: a forma normalizada e o valor exato.
+// Contas antigas cuja forma normalizada já pertencia a outra conta mantêm o valor original
+// (ver BackfillNormalizedIdentifiers) e só são encontradas pelo valor exato.
+func lookupKeys(key, raw string) []string {
+	raw = strings.TrimSpace(raw)
+	if raw == key {
+		return []string{key}
+	}
+	return []string{key, raw}
+}
+
+// exactMatchFirst ordena a busca para que a conta cujo valor é exatamente o informado tenha
+// preferência sobre a que só coincide na forma normalizada
+func exactMatchFirst(raw string, columns ...string) clause.OrderBy {
+	conditions := make([]string, len(columns))
+	vars := make([]interface{}, len(columns))
+	for i, column := range columns {
+		conditions[i] = column + " = ?"
+		vars[i] = strings.TrimSpace(raw)
+	}
+	return clause.OrderBy{Expression: clause.Expr{
+		SQL:                "CASE WHEN " + strings.Join(conditions, " OR ") + " THEN 0 ELSE 1 END",
+		Vars:               vars,
+		WithoutParentheses: true,
+	}}
+}
+
+// CreateRelationTuple grava a tupla. Retorna false se ela já existia.
+func (r *userRepositoryImpl) CreateRelationTuple(tuple *RelationTuple) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(tuple)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeleteRelationTuple remove a tupla. Retorna false se ela não existia.
+func (r *userRepositoryImpl) DeleteRelationTuple(tuple *RelationTuple) (bool, error) {
+	result := r.db.Where(
+		"namespace = ? AND object_id = ? AND relation = ? AND subject_namespace = ? AND subject_object_id = ? AND subject_relation = ?",
+		tuple.Namespace, tuple.ObjectID, tuple.Relation, tuple.SubjectNamespace, tuple.SubjectObjectID, tuple.SubjectRelation,
+	).Delete(&RelationTuple{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetRelationTuples lista as tuplas que batem com os campos preenchidos do filtro
+// (limit 0: sem limite). SubjectRelation só filtra junto com o sujeito.
+func (r *userRepositoryImpl) GetRelationTuples(filter RelationTuple, limit int) ([]RelationTuple, error) {
+	query := r.db.Model(&RelationTuple{})
+	for column, value := range map[string]string{
+		"namespace":         filter.Namespace,
+		"object_id":         filter.ObjectID,
+		"relation":          filter.Relation,
+		"subject_namespace": filter.SubjectNamespace,
+		"subject_object_id": filter.SubjectObjectID,
+	} {
+		if value != "" {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	if filter.SubjectObjectID != "" {
+		query = query.Where("subject_relation = ?", filter.SubjectRelation)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var tuples []RelationTuple
+	err := query.Order("id").Find(&tuples).Error
+	return tuples, err
+}
+
+// GetRelationObjectIDs lista, sem repetição e em ordem, até limit objetos do namespace que aparecem
+// em alguma tupla, começando depois de after (vazio: do início)
+func (r *userRepositoryImpl) GetRelationObjectIDs(namespace, after string, limit int) ([]string, error) {
+	query := r.db.Model(&RelationTuple{}).Where("namespace = ?", namespace)
+	if after != "" {
+		query = query.Where("object_id > ?", after)
+	}
+	var ids []string
+	err := query.Distinct().Order("object_id").Limit(limit).Pluck("object_id", &ids).Error
+	return ids, err
+}
+
+// IsDataMigrationApplied indica se a migração de dados já foi registrada
+func (r *userRepositoryImpl) IsDataMigrationApplied(name string) (bool, error) {
+	var count int64
+	err := r.db.Model(&DataMigration{}).Where("name = ?", name).Count(&count).Error
+	return count > 0, err
+}
+
+// RecordDataMigration registra a migração de dados como aplicada. Se outra instância a tiver
+// registrado antes, o registro existente é mantido.
+func (r *userRepositoryImpl) RecordDataMigration(name string, rows int) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&DataMigration{Name: name, Rows: rows, AppliedAt: time.Now()}).Error
 }
@@ -1,14 +1,22 @@
 package user
 
 import (
+	"log"
 	"net/http"
 	"strconv" // Para converter string para uint
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10" // Para validação de requisições
-	"gorm.io/gorm"                           // Importe gorm para verificar "record not found"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm" // Importe gorm para verificar "record not found"
 
 	"api_authentication/internal/auth" // Para hashing de senha e JWT
+	"api_authentication/internal/emailpolicy"
+	"api_authentication/internal/identifier"
+	"api_authentication/internal/mail"
+	"api_authentication/internal/relations"
+	"api_authentication/internal/sms"
 )
 
 // UserService define a interface para operações de serviço de usuário
@@ -16,22 +24,154 @@ type UserService interface {
 	Register(c *gin.Context)
 	Login(c *gin.Context)
 	GetUserByID(c *gin.Context)
+	ListUsers(c *gin.Context) // Administração: filtros, busca, ordenação e paginação por cursor
 	UpdateUser(c *gin.Context)
 	DeleteUser(c *gin.Context)
-	GetCurrentUser(c *gin.Context) // <--- Esta linha está correta aqui na interface
+	GetCurrentUser(c *gin.Context)          // <--- Esta linha está correta aqui na interface
+	PatchCurrentUserProfile(c *gin.Context) // JSON Merge Patch (RFC 7396) dos campos de perfil
+
+	// Autenticação em dois fatores (TOTP)
+	LoginMFA(c *gin.Context)
+	EnrollTOTP(c *gin.Context)
+	ConfirmTOTP(c *gin.Context)
+	DisableTOTP(c *gin.Context)
+	RegenerateRecoveryCodes(c *gin.Context)
+
+	// Passkeys (WebAuthn)
+	BeginWebAuthnRegistration(c *gin.Context)
+	FinishWebAuthnRegistration(c *gin.Context)
+	ListWebAuthnCredentials(c *gin.Context)
+	DeleteWebAuthnCredential(c *gin.Context)
+	BeginWebAuthnLogin(c *gin.Context)
+	FinishWebAuthnLogin(c *gin.Context)
+	BeginWebAuthnMFA(c *gin.Context)
+	FinishWebAuthnMFA(c *gin.Context)
+
+	// Login sem senha por email
+	RequestMagicLink(c *gin.Context)
+	VerifyMagicLink(c *gin.Context)
+
+	// Telefone e SMS como segundo fator
+	UpdatePhoneNumber(c *gin.Context)
+	VerifyPhoneNumber(c *gin.Context)
+	EnableSMSMFA(c *gin.Context)
+	DisableSMSMFA(c *gin.Context)
+	SendSMSMFACode(c *gin.Context)
+
+	// Dispositivos confiáveis
+	ListTrustedDevices(c *gin.Context)
+	RevokeTrustedDevice(c *gin.Context)
+	RevokeAllTrustedDevices(c *gin.Context)
+
+	// Confirmação de email
+	VerifyEmail(c *gin.Context)
+	ResendVerificationEmail(c *gin.Context)
+
+	// Troca de email (confirmação no novo endereço, cancelamento pelo antigo)
+	ConfirmEmailChange(c *gin.Context)
+	CancelEmailChange(c *gin.Context)
+
+	// Convites de cadastro
+	CreateInvitation(c *gin.Context)
+	ListInvitations(c *gin.Context)
+	RevokeInvitation(c *gin.Context)
+
+	// Exportação de dados pessoais
+	RequestDataExport(c *gin.Context)
+	GetDataExport(c *gin.Context)
+	DownloadDataExport(c *gin.Context)
+
+	// Documentos legais
+	ListCurrentLegalDocuments(c *gin.Context)
+	GetPendingLegalDocuments(c *gin.Context)
+	AcceptLegalDocuments(c *gin.Context)
+
+	// Direito ao esquecimento
+	EraseAccount(c *gin.Context)
+
+	// Restauração de contas excluídas
+	RestoreAccount(c *gin.Context)
+
+	// Administração
+	UnlockUser(c *gin.Context)
+	AdminRestoreUser(c *gin.Context)
+	SuspendUser(c *gin.Context)
+	ReactivateUser(c *gin.Context)
+	AdminEraseUser(c *gin.Context)
+	AdminPatchUserProfile(c *gin.Context)
+	AdminCreateLegalDocument(c *gin.Context)
+	AdminListLegalDocuments(c *gin.Context)
+	AdminListInvitations(c *gin.Context)
+	AdminRevokeInvitation(c *gin.Context)
+
+	// Organizações
+	ListMyOrganizations(c *gin.Context)
+	CreateOrganization(c *gin.Context)
+	SwitchOrganization(c *gin.Context)
+	JoinOrganization(c *gin.Context)
+	GetActiveOrganization(c *gin.Context)
+	ListOrganizationMembers(c *gin.Context)
+	CreateOrganizationInvitation(c *gin.Context)
+	UpdateOrganizationMember(c *gin.Context)
+	RemoveOrganizationMember(c *gin.Context)
+
+	// Papéis e permissões (administração)
+	AdminListPermissions(c *gin.Context)
+	AdminListRoles(c *gin.Context)
+	AdminCreateRole(c *gin.Context)
+	AdminUpdateRole(c *gin.Context)
+	AdminDeleteRole(c *gin.Context)
+	AdminListUserRoles(c *gin.Context)
+	AdminAssignRole(c *gin.Context)
+	AdminRevokeRole(c *gin.Context)
+
+	// Grupos aninhados (administração)
+	AdminListGroups(c *gin.Context)
+	AdminGetGroup(c *gin.Context)
+	AdminCreateGroup(c *gin.Context)
+	AdminUpdateGroup(c *gin.Context)
+	AdminDeleteGroup(c *gin.Context)
+	AdminAddGroupUser(c *gin.Context)
+	AdminRemoveGroupUser(c *gin.Context)
+	AdminAddSubgroup(c *gin.Context)
+	AdminRemoveSubgroup(c *gin.Context)
+	AdminListUserGroups(c *gin.Context)
+
+	// Autorização baseada em relacionamentos (tuplas no estilo Zanzibar)
+	GetRelationSchema(c *gin.Context)
+	ListRelationTuples(c *gin.Context)
+	WriteRelationTuple(c *gin.Context)
+	DeleteRelationTuple(c *gin.Context)
+	CheckRelation(c *gin.Context)
+	ExpandRelation(c *gin.Context)
+	ListRelationObjects(c *gin.Context)
 }
 
 // userServiceImpl é a implementação concreta do UserService
 type userServiceImpl struct {
 	repo     UserRepository
 	validate *validator.Validate // Validador para structs
+	webAuthn *webauthn.WebAuthn  // Relying party para passkeys
+	mailer   mail.Sender         // Envio de emails transacionais
+	sms      sms.SMSSender       // Envio de códigos por SMS
+
+	emailPolicy   *emailpolicy.Policy       // Domínios aceitos e canonicalização de emails
+	reservedNames *identifier.ReservedNames // Nomes de usuário que não podem ser cadastrados
+	relations     *relations.Schema         // Namespaces e relações das tuplas de autorização
 }
 
 // NewUserService cria uma nova instância de UserService
-func NewUserService(repo UserRepository) UserService {
+func NewUserService(repo UserRepository, webAuthn *webauthn.WebAuthn, mailer mail.Sender, smsSender sms.SMSSender, emailPolicy *emailpolicy.Policy, reservedNames *identifier.ReservedNames, relationSchema *relations.Schema) UserService {
 	return &userServiceImpl{
-		repo:     repo,
-		validate: validator.New(),
+		repo:        repo,
+		validate:    validator.New(),
+		webAuthn:    webAuthn,
+		mailer:      mailer,
+		sms:         smsSender,
+		emailPolicy: emailPolicy,
+
+		reservedNames: reservedNames,
+		relations:     relationSchema,
 	}
 }
 
@@ -49,25 +189,82 @@ func (s *userServiceImpl) Register(c *gin.Context) {
 		return
 	}
 
+	// --- NORMALIZAÇÃO DO NOME DE USUÁRIO E DO EMAIL ---
+	// Ambos são gravados e buscados na forma normalizada: "Admin" e "admin" são a mesma conta
+	if !s.normalizeIdentifiers(c, &req.Username, &req.Email) {
+		return
+	}
+
+	// --- MODO DE CADASTRO E CONVITE ---
+	mode := RegistrationMode()
+	if mode == RegistrationClosed {
+		c.JSON(http.StatusForbidden, gin.H{"message": "O cadastro de novos usuários está desativado."})
+		return
+	}
+	if mode == RegistrationInvite && req.InviteCode == "" {
+		c.JSON(http.StatusForbidden, gin.H{"message": "O cadastro exige um convite."})
+		return
+	}
+
+	var invitation *Invitation
+	if req.InviteCode != "" {
+		var err error
+		invitation, err = s.findInvitation(req.InviteCode, req.Email)
+		if err != nil {
+			if err == errInvalidInvitation {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "Convite inválido ou expirado."})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar convite."})
+			return
+		}
+	}
+
+	// --- ACEITE DOS DOCUMENTOS LEGAIS EM VIGOR ---
+	legalDocuments, err := CurrentLegalDocuments(s.repo, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar documentos legais."})
+		return
+	}
+	if missing := missingDocuments(legalDocuments, req.AcceptedDocuments); len(missing) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message":   "É necessário aceitar os documentos legais em vigor.",
+			"code":      "legal_acceptance_required",
+			"documents": missing,
+		})
+		return
+	}
+
 	// --- VERIFICAÇÃO DE UNICIDADE DO USERNAME ---
-	_, err := s.repo.GetUserByUsername(req.Username)
-	if err == nil { // Se não houve erro, o username já existe
+	// Contas excluídas ainda restauráveis mantêm o nome de usuário e o email reservados
+	taken, err := s.repo.IsUsernameReserved(req.Username, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar nome de usuário existente."})
+		return
+	}
+	if taken {
 		c.JSON(http.StatusConflict, gin.H{"message": "Nome de usuário já existe."})
 		return
 	}
-	if err != nil && err != gorm.ErrRecordNotFound {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar nome de usuário existente."})
+
+	// --- NOMES RESERVADOS E CONFUNDÍVEIS ---
+	if !s.checkUsername(c, req.Username, 0) {
 		return
 	}
 
 	// --- VERIFICAÇÃO DE UNICIDADE DO EMAIL ---
-	_, err = s.repo.GetUserByEmail(req.Email)
-	if err == nil { // Se não houve erro, o email já existe
+	taken, err = s.repo.IsEmailReserved(req.Email, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar email existente."})
+		return
+	}
+	if taken {
 		c.JSON(http.StatusConflict, gin.H{"message": "Email já cadastrado."})
 		return
 	}
-	if err != nil && err != gorm.ErrRecordNotFound {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar email existente."})
+
+	// --- POLÍTICA DE DOMÍNIOS E MESMA CAIXA POSTAL ---
+	if !s.checkEmailPolicy(c, req.Email, 0) {
 		return
 	}
 
@@ -83,14 +280,52 @@ func (s *userServiceImpl) Register(c *gin.Context) {
 		Username: req.Username,
 		Email:    req.Email,
 		Password: hashedPassword,
+		Status:   StatusPending,
+
+		CanonicalEmail:   s.emailPolicy.Canonicalize(req.Email),
+		UsernameSkeleton: identifier.Skeleton(req.Username),
+	}
+
+	// Consome o convite de forma atômica: dois cadastros simultâneos não passam do limite de usos
+	if invitation != nil {
+		used, err := s.repo.UseInvitation(invitation.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar convite."})
+			return
+		}
+		if !used {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Convite inválido ou expirado."})
+			return
+		}
+		newUser.InvitationID = &invitation.ID
 	}
 
 	if err := s.repo.CreateUser(newUser); err != nil {
+		if invitation != nil {
+			if err := s.repo.ReleaseInvitation(invitation.ID); err != nil {
+				log.Printf("Erro ao devolver uso do convite %d: %v", invitation.ID, err)
+			}
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao registrar usuário."})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Usuário registrado com sucesso!"})
+	if err := s.joinOrganizationOnRegister(newUser, invitation); err != nil {
+		// Sem organização, o usuário ainda acessa a própria conta e pode entrar em uma por convite
+		log.Printf("Erro ao adicionar userID %d à organização: %v", newUser.ID, err)
+	}
+
+	if err := s.recordLegalAcceptances(c, newUser.ID, legalDocuments); err != nil {
+		// Sem o aceite registrado, o usuário será solicitado a aceitar no primeiro acesso
+		log.Printf("Erro ao registrar aceite legal do userID %d: %v", newUser.ID, err)
+	}
+
+	// Falha no envio não desfaz o cadastro: o usuário pode pedir o reenvio
+	if err := s.sendVerificationEmail(newUser); err != nil {
+		log.Printf("Erro ao enviar confirmação de email para userID %d: %v", newUser.ID, err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Usuário registrado com sucesso! Enviamos um link de confirmação para o seu email."})
 }
 
 // Login lida com a autenticação do usuário
@@ -111,27 +346,32 @@ func (s *userServiceImpl) Login(c *gin.Context) {
 	user, err := s.repo.GetUserByUsernameOrEmail(req.Username)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusUnauthorized, gin.H{"message": "Credenciais inválidas."})
+			// Compara com um hash fictício para que o tempo de resposta seja o mesmo
+			auth.CheckPasswordHash(req.Password, dummyPasswordHash())
+			respondInvalidCredentials(c)
 			return
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuário."})
 		return
 	}
 
-	// Verificar a senha
-	if !auth.CheckPasswordHash(req.Password, user.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "Credenciais inválidas."})
+	// Verificar a senha (sempre, mesmo com a conta bloqueada, pelo mesmo motivo)
+	passwordOK := auth.CheckPasswordHash(req.Password, user.Password)
+	if isLoginLocked(user, time.Now()) {
+		s.audit(c, user.ID, AuditLoginFailed, map[string]interface{}{"reason": "locked"})
+		respondInvalidCredentials(c)
 		return
 	}
-
-	// Gerar JWT
-	token, err := auth.GenerateJWT(user.ID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar token JWT."})
+	if !passwordOK {
+		if err := s.registerFailedLogin(c, user); err != nil {
+			log.Printf("Erro ao registrar falha de login para userID %d: %v", user.ID, err)
+		}
+		respondInvalidCredentials(c)
 		return
 	}
 
-	c.JSON(http.StatusOK, LoginResponse{Token: token})
+	// Gerar JWT (ou o desafio MFA, se o usuário tiver segundo fator ativo)
+	s.respondLogin(c, user)
 }
 
 // GetCurrentUser busca o perfil do usuário logado usando o ID do JWT
@@ -157,9 +397,26 @@ func (s *userServiceImpl) GetCurrentUser(c *gin.Context) {
 		return
 	}
 
+	s.respondProfile(c, user)
+}
+
+// respondProfile responde com o perfil do usuário logado (GetCurrentUser e PatchCurrentUserProfile)
+func (s *userServiceImpl) respondProfile(c *gin.Context, user *User) {
+	remaining, err := s.repo.CountRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao contar códigos de recuperação."})
+		return
+	}
+
 	// Não retornar a senha hasheada
 	user.Password = ""
-	c.JSON(http.StatusOK, user) // Retorna os dados do usuário
+	c.JSON(http.StatusOK, ProfileResponse{ // Retorna os dados do usuário
+		User:                   user,
+		RecoveryCodesRemaining: remaining,
+		Roles:                  contextRoles(c),
+		Permissions:            contextPermissions(c),
+		Groups:                 contextGroups(c),
+	})
 }
 
 // GetUserByID (Rota protegida para obter um usuário por ID)
@@ -207,6 +464,10 @@ func (s *userServiceImpl) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	if !s.normalizeIdentifiers(c, req.Username, req.Email) {
+		return
+	}
+
 	// Buscar o usuário existente
 	user, err := s.repo.GetUserByID(uint(userID))
 	if err != nil {
@@ -219,35 +480,45 @@ func (s *userServiceImpl) UpdateUser(c *gin.Context) {
 	}
 
 	// Aplicar as atualizações apenas se os campos forem fornecidos
+	var newEmail string
+	fields := make(map[string]interface{})
 	if req.Username != nil {
 		// Verificar se o novo nome de usuário já existe, se for diferente do atual
 		if *req.Username != user.Username {
-			existingUser, err := s.repo.GetUserByUsername(*req.Username)
-			if err == nil && existingUser.ID != user.ID { // Se encontrou outro usuário com o mesmo nome
+			taken, err := s.repo.IsUsernameReserved(*req.Username, user.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar nome de usuário."})
+				return
+			}
+			if taken { // Outro usuário (ativo ou excluído e restaurável) já usa o nome
 				c.JSON(http.StatusConflict, gin.H{"message": "Nome de usuário já em uso."})
 				return
 			}
-			if err != nil && err != gorm.ErrRecordNotFound { // Outro erro ao verificar
-				c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar nome de usuário."})
+			if !s.checkUsername(c, *req.Username, user.ID) {
 				return
 			}
 		}
-		user.Username = *req.Username
+		fields["username"] = *req.Username
+		fields["username_skeleton"] = identifier.Skeleton(*req.Username)
 	}
 	if req.Email != nil {
 		// Verificar se o novo email já existe, se for diferente do atual
 		if *req.Email != user.Email {
-			existingUser, err := s.repo.GetUserByEmail(*req.Email)
-			if err == nil && existingUser.ID != user.ID {
+			taken, err := s.repo.IsEmailReserved(*req.Email, user.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar email."})
+				return
+			}
+			if taken {
 				c.JSON(http.StatusConflict, gin.H{"message": "Email já em uso."})
 				return
 			}
-			if err != nil && err != gorm.ErrRecordNotFound {
-				c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar email."})
+			if !s.checkEmailPolicy(c, *req.Email, user.ID) {
 				return
 			}
+			// A troca só é aplicada depois da confirmação no novo endereço (ver email_change.go)
+			newEmail = *req.Email
 		}
-		user.Email = *req.Email
 	}
 	if req.Password != nil {
 		hashedPassword, err := auth.HashPassword(*req.Password)
@@ -255,12 +526,38 @@ func (s *userServiceImpl) UpdateUser(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao hashear nova senha."})
 			return
 		}
-		user.Password = hashedPassword
+		fields["password"] = hashedPassword
+	}
+
+	// A troca de email vem antes das demais alterações: se o link não puder ser enviado,
+	// nada é gravado
+	if newEmail != "" {
+		if err := s.requestEmailChange(user, newEmail); err != nil {
+			log.Printf("Erro ao solicitar troca de email para userID %d: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao solicitar troca de email. Nenhuma alteração foi gravada."})
+			return
+		}
+		s.audit(c, user.ID, AuditEmailChangeRequested, map[string]interface{}{"new_email": newEmail})
+	}
+
+	// Salvar apenas as colunas alteradas: a linha inteira sobrescreveria mudanças concorrentes
+	// (ex.: suspensão) ou traria de volta uma conta apagada no meio tempo
+	if len(fields) > 0 {
+		if err := s.repo.UpdateUserFields(user.ID, fields); err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado."})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atualizar usuário."})
+			return
+		}
 	}
 
-	// Salvar as alterações no banco de dados
-	if err := s.repo.UpdateUser(user); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atualizar usuário."})
+	if newEmail != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"message":       "Usuário atualizado com sucesso! Confirme o novo email pelo link enviado para ele.",
+			"pending_email": newEmail,
+		})
 		return
 	}
 
@@ -291,6 +588,10 @@ func (s *userServiceImpl) DeleteUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao deletar usuário."})
 		return
 	}
+	s.audit(c, uint(userID), AuditAccountDeleted, nil)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Usuário deletado com sucesso!"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Usuário deletado com sucesso! A conta pode ser restaurada até a data indicada.",
+		"restore_until": time.Now().Add(deletionGracePeriod()),
+	})
 }
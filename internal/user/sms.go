@@ -0,0 +1,278 @@
+package user
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"api_authentication/internal/auth"
+)
+
+// Limites de envio de códigos por SMS, por usuário e finalidade
+const (
+	smsResendInterval = time.Minute
+	smsMaxPerHour     = 5
+	smsCodeTTL        = 10 * time.Minute
+)
+
+// smsThrottled indica se um novo código SMS deve ser recusado pelos limites de envio
+func (s *userServiceImpl) smsThrottled(userID uint, purpose string) (bool, error) {
+	recent, err := s.repo.CountOneTimeTokensSince(userID, purpose, time.Now().Add(-smsResendInterval))
+	if err != nil {
+		return false, err
+	}
+	if recent > 0 {
+		return true, nil
+	}
+
+	lastHour, err := s.repo.CountOneTimeTokensSince(userID, purpose, time.Now().Add(-time.Hour))
+	if err != nil {
+		return false, err
+	}
+	return lastHour >= smsMaxPerHour, nil
+}
+
+// sendSMSCode emite um novo código de uso único, válido apenas para o número informado, e o
+// envia. Os códigos anteriores da finalidade deixam de valer. Retorna false (sem enviar)
+// quando o limite de envios foi atingido.
+func (s *userServiceImpl) sendSMSCode(userID uint, purpose, phoneNumber string) (bool, error) {
+	throttled, err := s.smsThrottled(userID, purpose)
+	if err != nil || throttled {
+		return false, err
+	}
+
+	_, code, err := s.issueOneTimeTokenFor(userID, purpose, phoneNumber, smsCodeTTL, true)
+	if err != nil {
+		return false, err
+	}
+
+	body := fmt.Sprintf("Seu código de verificação é %s. Ele expira em %d minutos. Não compartilhe este código.",
+		code, int(smsCodeTTL.Minutes()))
+	if err := s.sms.SendSMS(phoneNumber, body); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// verifySMSCode consome o código SMS do desafio de login
+func (s *userServiceImpl) verifySMSCode(user *User, code string) (bool, error) {
+	_, err := s.redeemOneTimeCodeFor(user.ID, PurposeSMSLogin, user.PhoneNumber, code)
+	if err == errInvalidOneTimeToken {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// respondSMSSent escreve a resposta de um envio de código SMS
+func respondSMSSent(c *gin.Context, sent bool, err error) {
+	if err != nil {
+		log.Printf("Erro ao enviar código SMS: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao enviar código por SMS."})
+		return
+	}
+	if !sent {
+		c.JSON(http.StatusTooManyRequests, gin.H{"message": "Muitas solicitações de código. Aguarde antes de tentar novamente."})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Código enviado por SMS."})
+}
+
+// UpdatePhoneNumber registra um novo telefone (pendente) e envia o código de verificação
+func (s *userServiceImpl) UpdatePhoneNumber(c *gin.Context) {
+	var req PhoneNumberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	if req.PhoneNumber == user.PhoneNumber && user.PhoneVerifiedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"message": "Este telefone já está verificado."})
+		return
+	}
+
+	// O limite de envios é conferido antes de trocar o telefone pendente: do contrário o
+	// número mudaria sem que um código novo fosse enviado para ele
+	throttled, err := s.smsThrottled(user.ID, PurposePhoneVerification)
+	if err != nil || throttled {
+		respondSMSSent(c, false, err)
+		return
+	}
+
+	// O telefone atual continua valendo (inclusive para MFA) até o novo ser confirmado
+	if err := s.repo.UpdateUserFields(user.ID, map[string]interface{}{"pending_phone_number": req.PhoneNumber}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao salvar telefone."})
+		return
+	}
+
+	sent, err := s.sendSMSCode(user.ID, PurposePhoneVerification, req.PhoneNumber)
+	respondSMSSent(c, sent, err)
+}
+
+// VerifyPhoneNumber confirma o telefone pendente com o código recebido por SMS
+func (s *userServiceImpl) VerifyPhoneNumber(c *gin.Context) {
+	var req SMSCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	if user.PendingPhoneNumber == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Nenhum telefone aguardando verificação."})
+		return
+	}
+
+	// O código só vale para o número ao qual foi enviado
+	if _, err := s.redeemOneTimeCodeFor(user.ID, PurposePhoneVerification, user.PendingPhoneNumber, req.Code); err != nil {
+		if err == errInvalidOneTimeToken {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Código inválido ou expirado."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar código."})
+		return
+	}
+
+	if err := s.repo.UpdateUserFields(user.ID, map[string]interface{}{
+		"phone_number":         user.PendingPhoneNumber,
+		"pending_phone_number": "",
+		"phone_verified_at":    time.Now(),
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao salvar telefone."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Telefone verificado com sucesso!"})
+}
+
+// EnableSMSMFA ativa o SMS como segundo fator mediante a senha atual (exige telefone verificado)
+func (s *userServiceImpl) EnableSMSMFA(c *gin.Context) {
+	var req PasswordConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	if !s.confirmSMSMFAChange(c, user, req.Password, "sms_mfa_enable") {
+		return
+	}
+
+	if user.PhoneNumber == "" || user.PhoneVerifiedAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Cadastre e verifique um telefone antes de ativar o SMS."})
+		return
+	}
+
+	if err := s.repo.UpdateUserFields(user.ID, map[string]interface{}{"smsmfa_enabled": true}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao ativar SMS como segundo fator."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "SMS ativado como segundo fator."})
+}
+
+// DisableSMSMFA desativa o SMS como segundo fator mediante a senha atual
+func (s *userServiceImpl) DisableSMSMFA(c *gin.Context) {
+	var req PasswordConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	if !s.confirmSMSMFAChange(c, user, req.Password, "sms_mfa_disable") {
+		return
+	}
+
+	if err := s.repo.UpdateUserFields(user.ID, map[string]interface{}{"smsmfa_enabled": false}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao desativar SMS como segundo fator."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "SMS desativado como segundo fator."})
+}
+
+// confirmSMSMFAChange exige a senha atual para ativar ou desativar o SMS como segundo fator.
+// Senhas incorretas contam como falha de login (espera progressiva e bloqueio). Em caso de
+// recusa a resposta já é escrita e false é retornado.
+func (s *userServiceImpl) confirmSMSMFAChange(c *gin.Context, user *User, password, action string) bool {
+	passwordOK := auth.CheckPasswordHash(password, user.Password)
+	if isLoginLocked(user, time.Now()) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"message": "Muitas tentativas incorretas. Tente novamente mais tarde."})
+		return false
+	}
+	if !passwordOK {
+		if err := s.registerFailedAttempt(c, user, map[string]interface{}{"action": action}); err != nil {
+			log.Printf("Erro ao registrar falha de login para userID %d: %v", user.ID, err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Senha incorreta."})
+		return false
+	}
+	return true
+}
+
+// SendSMSMFACode envia o código SMS da segunda etapa do login
+func (s *userServiceImpl) SendSMSMFACode(c *gin.Context) {
+	var req SMSMFASendRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	user := s.mfaChallengeUser(c, req.MFAToken)
+	if user == nil {
+		return
+	}
+
+	if !user.SMSMFAEnabled || user.PhoneVerifiedAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "SMS não está ativo como segundo fator."})
+		return
+	}
+
+	sent, err := s.sendSMSCode(user.ID, PurposeSMSLogin, user.PhoneNumber)
+	respondSMSSent(c, sent, err)
+}
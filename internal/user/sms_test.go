@@ -0,0 +1,124 @@
+package user
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"api_authentication/internal/auth"
+)
+
+// suspendOnLoadRepository suspende o usuário logo depois de carregá-lo, simulando uma
+// suspensão concorrente com uma requisição que já leu a linha
+type suspendOnLoadRepository struct {
+	UserRepository
+	t *testing.T
+}
+
+func (r suspendOnLoadRepository) GetUserByID(id uint) (*User, error) {
+	user, err := r.UserRepository.GetUserByID(id)
+	if err == nil {
+		if _, err := r.TransitionUserStatus(id, user.Status, StatusSuspended, nil); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+	return user, err
+}
+
+// createTestPhoneUser cria um usuário com senha e telefone verificado
+func createTestPhoneUser(t *testing.T, s *userServiceImpl, username, password string) *User {
+	t.Helper()
+	user := createTestUser(t, s.repo, username)
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.repo.UpdateUserFields(user.ID, map[string]interface{}{"password": hash, "phone_number": "+5511999990001", "phone_verified_at": time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestEnableSMSMFARequiresPassword(t *testing.T) {
+	t.Setenv("LOGIN_BACKOFF_BASE", "0s")
+	_, s := newTestService(t)
+	user := createTestPhoneUser(t, s, "alice", "senha123")
+	r := gin.New()
+	r.POST("/mfa/sms/enable", func(c *gin.Context) { c.Set("userID", user.ID) }, s.EnableSMSMFA)
+
+	if code, _ := doJSON(t, r, "POST", "/mfa/sms/enable", nil); code != http.StatusBadRequest {
+		t.Errorf("sem senha: esperado 400, obtido %d", code)
+	}
+	if code, _ := doJSON(t, r, "POST", "/mfa/sms/enable", PasswordConfirmRequest{Password: "errada"}); code != http.StatusUnauthorized {
+		t.Fatalf("senha errada: esperado 401, obtido %d", code)
+	}
+	stored, err := s.repo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.SMSMFAEnabled || stored.FailedLoginAttempts != 1 {
+		t.Fatalf("senha errada: esperado SMS inativo e 1 falha, obtido ativo=%v e %d falhas", stored.SMSMFAEnabled, stored.FailedLoginAttempts)
+	}
+
+	if code, _ := doJSON(t, r, "POST", "/mfa/sms/enable", PasswordConfirmRequest{Password: "senha123"}); code != http.StatusOK {
+		t.Fatalf("senha certa: esperado 200, obtido %d", code)
+	}
+	if stored, err = s.repo.GetUserByID(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !stored.SMSMFAEnabled {
+		t.Error("SMS não foi ativado como segundo fator")
+	}
+}
+
+func TestEnableSMSMFAKeepsConcurrentSuspension(t *testing.T) {
+	_, s := newTestService(t)
+	user := createTestPhoneUser(t, s, "alice", "senha123")
+	repo := s.repo
+	s.repo = suspendOnLoadRepository{UserRepository: repo, t: t}
+	r := gin.New()
+	r.POST("/mfa/sms/enable", func(c *gin.Context) { c.Set("userID", user.ID) }, s.EnableSMSMFA)
+
+	if code, _ := doJSON(t, r, "POST", "/mfa/sms/enable", PasswordConfirmRequest{Password: "senha123"}); code != http.StatusOK {
+		t.Fatalf("esperado 200, obtido %d", code)
+	}
+	stored, err := repo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != StatusSuspended {
+		t.Errorf("suspensão concorrente desfeita: status=%q", stored.Status)
+	}
+}
+
+func TestVerifyPhoneNumberKeepsConcurrentSuspension(t *testing.T) {
+	_, s := newTestService(t)
+	user := createTestUser(t, s.repo, "alice")
+	if err := s.repo.UpdateUserFields(user.ID, map[string]interface{}{"pending_phone_number": "+5511999990002"}); err != nil {
+		t.Fatal(err)
+	}
+	_, code, err := s.issueOneTimeTokenFor(user.ID, PurposePhoneVerification, "+5511999990002", time.Minute, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := s.repo
+	s.repo = suspendOnLoadRepository{UserRepository: repo, t: t}
+	r := gin.New()
+	r.POST("/phone/verify", func(c *gin.Context) { c.Set("userID", user.ID) }, s.VerifyPhoneNumber)
+
+	if status, _ := doJSON(t, r, "POST", "/phone/verify", SMSCodeRequest{Code: code}); status != http.StatusOK {
+		t.Fatalf("esperado 200, obtido %d", status)
+	}
+	stored, err := repo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.PhoneNumber != "+5511999990002" || stored.PendingPhoneNumber != "" || stored.PhoneVerifiedAt == nil {
+		t.Errorf("telefone não confirmado: atual=%q pendente=%q", stored.PhoneNumber, stored.PendingPhoneNumber)
+	}
+	if stored.Status != StatusSuspended {
+		t.Errorf("suspensão concorrente desfeita: status=%q", stored.Status)
+	}
+}
@@ -0,0 +1,192 @@
+package user
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Estados da conta (User.Status)
+const (
+	StatusPending   = "pending"   // Cadastrada, email ainda não confirmado
+	StatusActive    = "active"    // Em uso normal
+	StatusSuspended = "suspended" // Suspensa por um administrador
+	StatusLocked    = "locked"    // Bloqueada por excesso de falhas de login
+	StatusDeleted   = "deleted"   // Excluída (exclusão lógica), restaurável até o expurgo
+)
+
+// statusTransitions é a máquina de estados da conta: para cada estado, os estados seguintes permitidos
+var statusTransitions = map[string][]string{
+	StatusPending:   {StatusActive, StatusSuspended, StatusLocked, StatusDeleted},
+	StatusActive:    {StatusSuspended, StatusLocked, StatusDeleted},
+	StatusSuspended: {StatusPending, StatusActive, StatusDeleted},
+	StatusLocked:    {StatusPending, StatusActive, StatusSuspended, StatusDeleted},
+	StatusDeleted:   {StatusPending, StatusActive, StatusSuspended}, // Falhas na restauração só ajustam locked_until
+}
+
+// CanTransition indica se a máquina de estados permite ir de from para to
+func CanTransition(from, to string) bool {
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// baseStatus é o estado de uma conta sem restrições: ativa, ou pendente se o email não foi confirmado
+func baseStatus(user *User) string {
+	if user.EmailVerifiedAt == nil {
+		return StatusPending
+	}
+	return StatusActive
+}
+
+// IsSuspended indica se a suspensão da conta está em vigor (suspensões com prazo expiram sozinhas)
+func IsSuspended(user *User, now time.Time) bool {
+	return user.Status == StatusSuspended && (user.SuspendedUntil == nil || now.Before(*user.SuspendedUntil))
+}
+
+// transitionStatus muda o estado da conta se a máquina de estados permitir. A atualização só
+// ocorre se o estado no banco ainda for o lido em user; retorna false caso contrário.
+func (s *userServiceImpl) transitionStatus(user *User, to string, fields map[string]interface{}) (bool, error) {
+	if !CanTransition(user.Status, to) {
+		return false, nil
+	}
+	ok, err := s.repo.TransitionUserStatus(user.ID, user.Status, to, fields)
+	if err != nil || !ok {
+		return false, err
+	}
+	user.Status = to
+	return true, nil
+}
+
+// liftExpiredSuspension devolve ao estado base uma conta cuja suspensão com prazo terminou
+func (s *userServiceImpl) liftExpiredSuspension(user *User) {
+	if user.Status != StatusSuspended || IsSuspended(user, time.Now()) {
+		return
+	}
+	if _, err := s.transitionStatus(user, baseStatus(user), suspensionCleared()); err != nil {
+		log.Printf("Erro ao encerrar suspensão expirada do userID %d: %v", user.ID, err)
+	}
+}
+
+func suspensionCleared() map[string]interface{} {
+	return map[string]interface{}{
+		"suspended_at":      nil,
+		"suspended_until":   nil,
+		"suspension_reason": "",
+	}
+}
+
+// adminTargetUser lê o :id da rota de administrador e busca o usuário
+func (s *userServiceImpl) adminTargetUser(c *gin.Context) *User {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de usuário inválido."})
+		return nil
+	}
+
+	user, err := s.repo.GetUserByID(uint(userID))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado."})
+			return nil
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuário."})
+		return nil
+	}
+	return user
+}
+
+// SuspendUser (rota de administrador) suspende uma conta com motivo e, opcionalmente, prazo
+func (s *userServiceImpl) SuspendUser(c *gin.Context) {
+	var req SuspendUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	now := time.Now()
+	if req.Until != nil && !req.Until.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "O prazo da suspensão deve estar no futuro."})
+		return
+	}
+
+	user := s.adminTargetUser(c)
+	if user == nil {
+		return
+	}
+
+	if adminID, _ := c.Get("userID"); adminID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Não é possível suspender a própria conta."})
+		return
+	}
+
+	fields := map[string]interface{}{
+		"suspended_at":      now,
+		"suspended_until":   req.Until,
+		"suspension_reason": req.Reason,
+	}
+
+	// Uma suspensão já em vigor pode ter motivo e prazo atualizados
+	if user.Status == StatusSuspended {
+		ok, err := s.repo.TransitionUserStatus(user.ID, StatusSuspended, StatusSuspended, fields)
+		if ok {
+			s.audit(c, user.ID, AuditAccountSuspended, map[string]interface{}{"reason": req.Reason, "until": req.Until})
+		}
+		s.respondStatusChange(c, ok, err, "Suspensão atualizada com sucesso!")
+		return
+	}
+
+	if !CanTransition(user.Status, StatusSuspended) {
+		c.JSON(http.StatusConflict, gin.H{"message": "A conta não pode ser suspensa no estado atual: " + user.Status})
+		return
+	}
+	ok, err := s.transitionStatus(user, StatusSuspended, fields)
+	if ok {
+		s.audit(c, user.ID, AuditAccountSuspended, map[string]interface{}{"reason": req.Reason, "until": req.Until})
+	}
+	s.respondStatusChange(c, ok, err, "Usuário suspenso com sucesso!")
+}
+
+// ReactivateUser (rota de administrador) encerra a suspensão de uma conta
+func (s *userServiceImpl) ReactivateUser(c *gin.Context) {
+	user := s.adminTargetUser(c)
+	if user == nil {
+		return
+	}
+
+	if user.Status != StatusSuspended {
+		c.JSON(http.StatusConflict, gin.H{"message": "A conta não está suspensa."})
+		return
+	}
+
+	ok, err := s.transitionStatus(user, baseStatus(user), suspensionCleared())
+	if ok {
+		s.audit(c, user.ID, AuditAccountReactivated, nil)
+	}
+	s.respondStatusChange(c, ok, err, "Usuário reativado com sucesso!")
+}
+
+func (s *userServiceImpl) respondStatusChange(c *gin.Context, ok bool, err error, message string) {
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atualizar o estado da conta."})
+		return
+	}
+	if !ok {
+		// O estado mudou entre a leitura e a atualização (outra requisição ou instância)
+		c.JSON(http.StatusConflict, gin.H{"message": "O estado da conta mudou. Tente novamente."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
@@ -0,0 +1,130 @@
+package user
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"api_authentication/internal/auth"
+)
+
+// Finalidades dos tokens de uso único
+const (
+	PurposeMagicLink         = "magic_link"
+	PurposePhoneVerification = "phone_verification"
+	PurposeSMSLogin          = "sms_login"
+	PurposeEmailVerification = "email_verification"
+	PurposeEmailChange       = "email_change"
+	PurposeEmailChangeCancel = "email_change_cancel"
+	PurposeMFAChallenge      = "mfa_challenge" // Desafio do login em duas etapas, emitido após a senha
+)
+
+// maxOneTimeCodeAttempts é quantas tentativas de código errado invalidam o token
+const maxOneTimeCodeAttempts = 5
+
+var errInvalidOneTimeToken = errors.New("token inválido ou expirado")
+
+// issueOneTimeToken invalida os tokens anteriores da mesma finalidade e emite um novo.
+// Com withCode, também gera um código de 6 dígitos que pode substituir o link.
+func (s *userServiceImpl) issueOneTimeToken(userID uint, purpose string, ttl time.Duration, withCode bool) (token, code string, err error) {
+	return s.issueOneTimeTokenFor(userID, purpose, "", ttl, withCode)
+}
+
+// issueOneTimeTokenFor emite um token que só vale para o destino informado (ex.: o telefone
+// para o qual o código foi enviado); veja redeemOneTimeCodeFor
+func (s *userServiceImpl) issueOneTimeTokenFor(userID uint, purpose, target string, ttl time.Duration, withCode bool) (token, code string, err error) {
+	if err := s.repo.InvalidateOneTimeTokens(userID, purpose); err != nil {
+		return "", "", err
+	}
+
+	token, err = auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	record := &OneTimeToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if target != "" {
+		record.Target = auth.HashToken(target)
+	}
+
+	if withCode {
+		code, err = auth.GenerateNumericCode(6)
+		if err != nil {
+			return "", "", err
+		}
+		record.CodeHash = auth.HashToken(record.TokenHash + code) // O hash do token serve de salt
+	}
+
+	if err := s.repo.CreateOneTimeToken(record); err != nil {
+		return "", "", err
+	}
+	return token, code, nil
+}
+
+// redeemOneTimeToken consome o token do link e retorna o registro correspondente
+func (s *userServiceImpl) redeemOneTimeToken(purpose, token string) (*OneTimeToken, error) {
+	record, err := s.repo.GetActiveOneTimeTokenByHash(purpose, auth.HashToken(token))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errInvalidOneTimeToken
+		}
+		return nil, err
+	}
+
+	consumed, err := s.repo.ConsumeOneTimeToken(record.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, errInvalidOneTimeToken
+	}
+	return record, nil
+}
+
+// redeemOneTimeCode consome o token ativo do usuário se o código estiver correto.
+// Cada verificação conta uma tentativa; ao atingir o limite o token deixa de aceitar códigos.
+func (s *userServiceImpl) redeemOneTimeCode(userID uint, purpose, code string) (*OneTimeToken, error) {
+	return s.redeemOneTimeCodeFor(userID, purpose, "", code)
+}
+
+// redeemOneTimeCodeFor é redeemOneTimeCode para códigos emitidos com issueOneTimeTokenFor:
+// o código só é aceito se tiver sido enviado para target
+func (s *userServiceImpl) redeemOneTimeCodeFor(userID uint, purpose, target, code string) (*OneTimeToken, error) {
+	record, err := s.repo.GetLatestActiveOneTimeToken(userID, purpose)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errInvalidOneTimeToken
+		}
+		return nil, err
+	}
+
+	if record.CodeHash == "" {
+		return nil, errInvalidOneTimeToken
+	}
+	if target != "" && record.Target != auth.HashToken(target) {
+		return nil, errInvalidOneTimeToken
+	}
+
+	allowed, err := s.repo.IncrementOneTimeTokenAttempts(record.ID, maxOneTimeCodeAttempts)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed || auth.HashToken(record.TokenHash+code) != record.CodeHash {
+		return nil, errInvalidOneTimeToken
+	}
+
+	consumed, err := s.repo.ConsumeOneTimeToken(record.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, errInvalidOneTimeToken
+	}
+	return record, nil
+}
@@ -0,0 +1,43 @@
+package user
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOneTimeCodeBoundToTarget(t *testing.T) {
+	_, s := newTestService(t)
+	user := createTestUser(t, s.repo, "eve")
+
+	_, code, err := s.issueOneTimeTokenFor(user.ID, PurposePhoneVerification, "+5511999990001", time.Minute, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.redeemOneTimeCodeFor(user.ID, PurposePhoneVerification, "+5511999990002", code); err != errInvalidOneTimeToken {
+		t.Fatalf("código aceito para outro número: %v", err)
+	}
+	if _, err := s.redeemOneTimeCodeFor(user.ID, PurposePhoneVerification, "+5511999990001", code); err != nil {
+		t.Fatalf("código recusado para o número de destino: %v", err)
+	}
+	if _, err := s.redeemOneTimeCodeFor(user.ID, PurposePhoneVerification, "+5511999990001", code); err != errInvalidOneTimeToken {
+		t.Fatalf("código aceito duas vezes: %v", err)
+	}
+}
+
+func TestOneTimeCodeReissueInvalidatesPrevious(t *testing.T) {
+	_, s := newTestService(t)
+	user := createTestUser(t, s.repo, "eve")
+
+	_, first, err := s.issueOneTimeTokenFor(user.ID, PurposePhoneVerification, "+5511999990001", time.Minute, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.issueOneTimeTokenFor(user.ID, PurposePhoneVerification, "+5511999990002", time.Minute, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.redeemOneTimeCodeFor(user.ID, PurposePhoneVerification, "+5511999990001", first); err != errInvalidOneTimeToken {
+		t.Fatalf("código anterior continua valendo: %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package user
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api_authentication/configs"
+	"api_authentication/internal/mail"
+)
+
+// Modos de EMAIL_VERIFICATION_MODE para contas com email não confirmado
+const (
+	EmailVerificationOff      = "off"      // Login e acesso liberados (padrão)
+	EmailVerificationRestrict = "restrict" // Login liberado, rotas marcadas com RequireVerifiedEmail bloqueadas
+	EmailVerificationRequire  = "require"  // Login recusado até a confirmação
+)
+
+// verificationResendInterval é o intervalo mínimo entre dois emails de confirmação
+const verificationResendInterval = time.Minute
+
+// EmailVerificationMode retorna o modo configurado em EMAIL_VERIFICATION_MODE
+func EmailVerificationMode() string {
+	switch mode := configs.GetEnv("EMAIL_VERIFICATION_MODE", EmailVerificationOff); mode {
+	case EmailVerificationRestrict, EmailVerificationRequire:
+		return mode
+	default:
+		return EmailVerificationOff
+	}
+}
+
+// sendVerificationEmail emite um novo token de confirmação e o envia ao email do usuário
+func (s *userServiceImpl) sendVerificationEmail(user *User) error {
+	ttl := configs.GetEnvDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour)
+	token, _, err := s.issueOneTimeToken(user.ID, PurposeEmailVerification, ttl, false)
+	if err != nil {
+		return err
+	}
+
+	link := configs.GetEnv("APP_URL", "http://localhost:5500") + "/verify-email?token=" + url.QueryEscape(token)
+	return s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Confirme seu email",
+		Body: fmt.Sprintf("Olá, %s!\n\nConfirme seu endereço de email pelo link abaixo:\n%s\n\n"+
+			"O link expira em %s e só pode ser usado uma vez. "+
+			"Se você não criou esta conta, ignore este email.",
+			user.Username, link, ttl),
+	})
+}
+
+// markEmailVerified registra a confirmação do email, se ainda não houver, e recarrega user.
+// A conta pendente passa a ativa; outros estados (ex.: suspensa) são mantidos.
+func (s *userServiceImpl) markEmailVerified(user *User) error {
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+	if _, err := s.repo.MarkEmailVerified(user.ID, time.Now()); err != nil {
+		return err
+	}
+
+	fresh, err := s.repo.GetUserByID(user.ID)
+	if err != nil {
+		return err
+	}
+	*user = *fresh
+	return nil
+}
+
+// VerifyEmail confirma o email do usuário com o token recebido por email
+func (s *userServiceImpl) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	record, err := s.redeemOneTimeToken(PurposeEmailVerification, req.Token)
+	if err != nil {
+		if err == errInvalidOneTimeToken {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Link de confirmação inválido ou expirado."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao verificar link de confirmação."})
+		return
+	}
+
+	user, err := s.repo.GetUserByID(record.UserID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Link de confirmação inválido ou expirado."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuário."})
+		return
+	}
+
+	if err := s.markEmailVerified(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao confirmar email."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email confirmado com sucesso!"})
+}
+
+// ResendVerificationEmail reenvia o email de confirmação. A resposta é sempre a mesma,
+// exista ou não uma conta pendente com o email informado.
+func (s *userServiceImpl) ResendVerificationEmail(c *gin.Context) {
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	accepted := gin.H{"message": "Se houver uma conta pendente de confirmação com este email, um novo link foi enviado."}
+
+	user, err := s.repo.GetUserByEmail(req.Email)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusAccepted, accepted)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuário."})
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+
+	recent, err := s.repo.CountOneTimeTokensSince(user.ID, PurposeEmailVerification, time.Now().Add(-verificationResendInterval))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao reenviar confirmação."})
+		return
+	}
+	if recent == 0 {
+		if err := s.sendVerificationEmail(user); err != nil {
+			log.Printf("Erro ao reenviar confirmação de email para userID %d: %v", user.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusAccepted, accepted)
+}
+
+// loginBlocked responde e retorna true quando a conta ainda não pode entrar.
+// Só é chamado depois da autenticação primária, para não revelar o estado da conta.
+func (s *userServiceImpl) loginBlocked(c *gin.Context, user *User) bool {
+	s.liftExpiredSuspension(user)
+	if IsSuspended(user, time.Now()) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"message":         "Conta suspensa.",
+			"code":            "account_suspended",
+			"reason":          user.SuspensionReason,
+			"suspended_until": user.SuspendedUntil,
+		})
+		return true
+	}
+
+	if user.EmailVerifiedAt == nil && EmailVerificationMode() == EmailVerificationRequire {
+		c.JSON(http.StatusForbidden, gin.H{
+			"message": "Confirme seu email antes de entrar. Verifique sua caixa de entrada ou solicite um novo link.",
+			"code":    "email_not_verified",
+		})
+		return true
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package user
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createUnverifiedTestUser cria uma conta pendente, com senha e email ainda não confirmado
+func createUnverifiedTestUser(t *testing.T, s *userServiceImpl, username string) *User {
+	t.Helper()
+	user := createTestUserWithPassword(t, s.repo, username, "senha123")
+	if err := s.repo.UpdateUserFields(user.ID, map[string]interface{}{"status": StatusPending, "email_verified_at": nil}); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// newVerificationTestServer monta o login e as rotas de confirmação de email
+func newVerificationTestServer(s *userServiceImpl) *gin.Engine {
+	r := gin.New()
+	r.POST("/login", s.Login)
+	r.POST("/verify-email", s.VerifyEmail)
+	r.POST("/verify-email/resend", s.ResendVerificationEmail)
+	return r
+}
+
+func TestLoginByEmailVerificationMode(t *testing.T) {
+	for _, tc := range []struct {
+		mode string
+		want int
+	}{
+		{"", http.StatusOK},
+		{EmailVerificationOff, http.StatusOK},
+		{EmailVerificationRestrict, http.StatusOK},
+		{EmailVerificationRequire, http.StatusForbidden},
+		{"desconhecido", http.StatusOK}, // Valor inválido cai no padrão (off)
+	} {
+		t.Setenv("EMAIL_VERIFICATION_MODE", tc.mode)
+		_, s := newTestService(t)
+		createUnverifiedTestUser(t, s, "alice")
+		r := newVerificationTestServer(s)
+
+		code, body := doJSON(t, r, "POST", "/login", LoginRequest{Username: "alice", Password: "senha123"})
+		if code != tc.want {
+			t.Errorf("modo %q: esperado %d, obtido %d", tc.mode, tc.want, code)
+		}
+		if tc.want == http.StatusForbidden && body["code"] != "email_not_verified" {
+			t.Errorf("modo %q: código %v, esperado email_not_verified", tc.mode, body["code"])
+		}
+	}
+}
+
+func TestVerifyEmailActivatesPendingAccount(t *testing.T) {
+	t.Setenv("EMAIL_VERIFICATION_MODE", EmailVerificationRequire)
+	_, s := newTestService(t)
+	mailer := &recordingMailer{}
+	s.mailer = mailer
+	user := createUnverifiedTestUser(t, s, "alice")
+	r := newVerificationTestServer(s)
+
+	if err := s.sendVerificationEmail(user); err != nil {
+		t.Fatal(err)
+	}
+	match := magicLinkTokenPattern.FindStringSubmatch(mailer.messages[0].Body)
+	if match == nil {
+		t.Fatalf("email sem link de confirmação: %q", mailer.messages[0].Body)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code, _ := doJSON(t, r, "POST", "/verify-email", VerifyEmailRequest{Token: "invalido"}); code != http.StatusBadRequest {
+		t.Errorf("token inválido: esperado 400, obtido %d", code)
+	}
+	if code, _ := doJSON(t, r, "POST", "/verify-email", VerifyEmailRequest{Token: token}); code != http.StatusOK {
+		t.Fatalf("confirmação: esperado 200, obtido %d", code)
+	}
+	if code, _ := doJSON(t, r, "POST", "/verify-email", VerifyEmailRequest{Token: token}); code != http.StatusBadRequest {
+		t.Errorf("link reutilizado: esperado 400, obtido %d", code)
+	}
+
+	stored, err := s.repo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.EmailVerifiedAt == nil || stored.Status != StatusActive {
+		t.Errorf("após a confirmação: status=%q, confirmado em %v", stored.Status, stored.EmailVerifiedAt)
+	}
+	if code, _ := doJSON(t, r, "POST", "/login", LoginRequest{Username: "alice", Password: "senha123"}); code != http.StatusOK {
+		t.Errorf("login após a confirmação: esperado 200, obtido %d", code)
+	}
+}
+
+func TestResendVerificationEmail(t *testing.T) {
+	_, s := newTestService(t)
+	mailer := &recordingMailer{}
+	s.mailer = mailer
+	createUnverifiedTestUser(t, s, "alice")
+	createTestUser(t, s.repo, "bob")
+	r := newVerificationTestServer(s)
+
+	for _, email := range []string{"ninguem@example.com", "bob@example.com", "alice@example.com", "alice@example.com"} {
+		if code, _ := doJSON(t, r, "POST", "/verify-email/resend", ResendVerificationRequest{Email: email}); code != http.StatusAccepted {
+			t.Errorf("%s: esperado 202, obtido %d", email, code)
+		}
+	}
+
+	// Só a conta pendente recebe o link, e uma única vez dentro do intervalo mínimo
+	if len(mailer.messages) != 1 || mailer.messages[0].To != "alice@example.com" {
+		t.Errorf("emails enviados: %d, esperado 1 para alice", len(mailer.messages))
+	}
+}
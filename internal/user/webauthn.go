@@ -0,0 +1,536 @@
+package user
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm"
+
+	"api_authentication/internal/auth"
+)
+
+// Finalidades das sessões WebAuthn, para que um desafio não seja usado em outra cerimônia
+const (
+	webAuthnPurposeRegistration = "registration"
+	webAuthnPurposeLogin        = "login"
+	webAuthnPurposeMFA          = "mfa"
+)
+
+// webAuthnSessionTTL é usado quando a biblioteca não define a expiração do desafio
+const webAuthnSessionTTL = 5 * time.Minute
+
+var errInvalidWebAuthnSession = errors.New("sessão WebAuthn inválida ou expirada")
+
+// webAuthnUser adapta User (e suas passkeys) à interface webauthn.User
+type webAuthnUser struct {
+	user        *User
+	credentials []WebAuthnCredential
+}
+
+// webAuthnUserHandle é o identificador opaco do usuário enviado ao autenticador
+func webAuthnUserHandle(userID uint) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return webAuthnUserHandle(u.user.ID)
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.credentials))
+	for i, c := range u.credentials {
+		var transports []protocol.AuthenticatorTransport
+		for _, t := range strings.Split(c.Transports, ",") {
+			if t != "" {
+				transports = append(transports, protocol.AuthenticatorTransport(t))
+			}
+		}
+
+		credentials[i] = webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			// O alerta de clonagem é recalculado a cada cerimônia a partir do contador:
+			// não é repassado para que uma anomalia antiga não recuse todos os usos seguintes
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		}
+	}
+	return credentials
+}
+
+// exclusions lista as passkeys já registradas, para o navegador não registrar a mesma duas vezes
+func (u *webAuthnUser) exclusions() []protocol.CredentialDescriptor {
+	var descriptors []protocol.CredentialDescriptor
+	for _, c := range u.WebAuthnCredentials() {
+		descriptors = append(descriptors, c.Descriptor())
+	}
+	return descriptors
+}
+
+// loadWebAuthnUser carrega as passkeys do usuário para uma cerimônia
+func (s *userServiceImpl) loadWebAuthnUser(user *User) (*webAuthnUser, error) {
+	credentials, err := s.repo.GetWebAuthnCredentialsByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &webAuthnUser{user: user, credentials: credentials}, nil
+}
+
+// saveWebAuthnSession persiste o desafio da cerimônia e retorna o session_id para o cliente
+func (s *userServiceImpl) saveWebAuthnSession(userID *uint, purpose string, data *webauthn.SessionData) (string, error) {
+	id, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := data.Expires
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(webAuthnSessionTTL)
+	}
+
+	err = s.repo.CreateWebAuthnSession(&WebAuthnSession{
+		ID:        id,
+		UserID:    userID,
+		Purpose:   purpose,
+		Data:      string(raw),
+		ExpiresAt: expiresAt,
+	})
+	return id, err
+}
+
+// takeWebAuthnSession consome o desafio salvo, conferindo a finalidade e o dono da sessão
+func (s *userServiceImpl) takeWebAuthnSession(id, purpose string, userID *uint) (*webauthn.SessionData, error) {
+	session, err := s.repo.TakeWebAuthnSession(id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errInvalidWebAuthnSession
+		}
+		return nil, err
+	}
+
+	if session.Purpose != purpose {
+		return nil, errInvalidWebAuthnSession
+	}
+	if (userID == nil) != (session.UserID == nil) || (userID != nil && *userID != *session.UserID) {
+		return nil, errInvalidWebAuthnSession
+	}
+
+	var data webauthn.SessionData
+	if err := json.Unmarshal([]byte(session.Data), &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// recordWebAuthnUse grava o novo contador de assinaturas da passkey usada. Retorna false
+// quando o contador indica um possível autenticador clonado; nesse caso o login é recusado,
+// o evento é auditado e CloneWarning fica marcado até o próximo uso com contador válido.
+func (s *userServiceImpl) recordWebAuthnUse(c *gin.Context, wu *webAuthnUser, credential *webauthn.Credential) (bool, error) {
+	for i := range wu.credentials {
+		stored := &wu.credentials[i]
+		if !bytes.Equal(stored.CredentialID, credential.ID) {
+			continue
+		}
+
+		now := time.Now()
+		stored.CloneWarning = credential.Authenticator.CloneWarning
+		if !stored.CloneWarning {
+			stored.SignCount = credential.Authenticator.SignCount
+			stored.BackupState = credential.Flags.BackupState
+			stored.LastUsedAt = &now
+		}
+		if err := s.repo.UpdateWebAuthnCredential(stored); err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return false, nil // Passkey removida (ou conta apagada) durante a cerimônia
+			}
+			return false, err
+		}
+		if stored.CloneWarning {
+			s.audit(c, wu.user.ID, AuditWebAuthnCloneWarning, map[string]interface{}{
+				"credential_id": stored.ID,
+				"sign_count":    credential.Authenticator.SignCount,
+				"stored_count":  stored.SignCount,
+			})
+		}
+		return !stored.CloneWarning, nil
+	}
+	return false, errors.New("passkey validada não pertence ao usuário")
+}
+
+// respondWebAuthnSessionError escreve a resposta para falhas ao recuperar o desafio
+func respondWebAuthnSessionError(c *gin.Context, err error) {
+	if err == errInvalidWebAuthnSession {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Sessão WebAuthn inválida ou expirada."})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao recuperar sessão WebAuthn."})
+}
+
+// BeginWebAuthnRegistration inicia o registro de uma passkey para o usuário logado
+func (s *userServiceImpl) BeginWebAuthnRegistration(c *gin.Context) {
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	wu, err := s.loadWebAuthnUser(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar passkeys."})
+		return
+	}
+
+	creation, data, err := s.webAuthn.BeginRegistration(wu,
+		webauthn.WithExclusions(wu.exclusions()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao iniciar registro de passkey."})
+		return
+	}
+
+	sessionID, err := s.saveWebAuthnSession(&user.ID, webAuthnPurposeRegistration, data)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao salvar sessão WebAuthn."})
+		return
+	}
+
+	c.JSON(http.StatusOK, WebAuthnBeginResponse{SessionID: sessionID, Options: creation})
+}
+
+// FinishWebAuthnRegistration valida a resposta do autenticador e salva a nova passkey
+func (s *userServiceImpl) FinishWebAuthnRegistration(c *gin.Context) {
+	var req WebAuthnRegisterFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	data, err := s.takeWebAuthnSession(req.SessionID, webAuthnPurposeRegistration, &user.ID)
+	if err != nil {
+		respondWebAuthnSessionError(c, err)
+		return
+	}
+
+	wu, err := s.loadWebAuthnUser(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar passkeys."})
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Resposta do autenticador inválida."})
+		return
+	}
+
+	credential, err := s.webAuthn.CreateCredential(wu, *data, parsed)
+	if err != nil {
+		log.Printf("Falha na verificação do registro WebAuthn para userID %d: %v", user.ID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Falha na verificação da passkey."})
+		return
+	}
+
+	transports := make([]string, len(credential.Transport))
+	for i, t := range credential.Transport {
+		transports[i] = string(t)
+	}
+
+	name := req.Name
+	if name == "" {
+		name = "Passkey"
+	}
+
+	model := &WebAuthnCredential{
+		UserID:          user.ID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		Transports:      strings.Join(transports, ","),
+	}
+	if err := s.repo.CreateWebAuthnCredential(model); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao salvar passkey."})
+		return
+	}
+
+	c.JSON(http.StatusCreated, model)
+}
+
+// ListWebAuthnCredentials lista as passkeys do usuário logado
+func (s *userServiceImpl) ListWebAuthnCredentials(c *gin.Context) {
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	credentials, err := s.repo.GetWebAuthnCredentialsByUserID(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar passkeys."})
+		return
+	}
+
+	c.JSON(http.StatusOK, credentials)
+}
+
+// DeleteWebAuthnCredential remove uma passkey do usuário logado
+func (s *userServiceImpl) DeleteWebAuthnCredential(c *gin.Context) {
+	credentialID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de passkey inválido."})
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	deleted, err := s.repo.DeleteWebAuthnCredential(user.ID, uint(credentialID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao remover passkey."})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Passkey não encontrada."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey removida com sucesso!"})
+}
+
+// BeginWebAuthnLogin inicia o login sem senha com uma passkey descoberta pelo navegador
+func (s *userServiceImpl) BeginWebAuthnLogin(c *gin.Context) {
+	assertion, data, err := s.webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao iniciar login com passkey."})
+		return
+	}
+
+	sessionID, err := s.saveWebAuthnSession(nil, webAuthnPurposeLogin, data)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao salvar sessão WebAuthn."})
+		return
+	}
+
+	c.JSON(http.StatusOK, WebAuthnBeginResponse{SessionID: sessionID, Options: assertion})
+}
+
+// FinishWebAuthnLogin valida a asserção da passkey e emite o mesmo token do login com senha.
+// Como a passkey exige verificação do usuário (biometria/PIN), não há desafio MFA adicional.
+func (s *userServiceImpl) FinishWebAuthnLogin(c *gin.Context) {
+	var req WebAuthnLoginFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	data, err := s.takeWebAuthnSession(req.SessionID, webAuthnPurposeLogin, nil)
+	if err != nil {
+		respondWebAuthnSessionError(c, err)
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Resposta do autenticador inválida."})
+		return
+	}
+
+	// Localiza o dono da passkey pelo ID da credencial e confere o user handle informado
+	var wu *webAuthnUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		stored, err := s.repo.GetWebAuthnCredentialByCredentialID(rawID)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(userHandle, webAuthnUserHandle(stored.UserID)) {
+			return nil, errors.New("user handle não corresponde ao dono da passkey")
+		}
+		user, err := s.repo.GetUserByID(stored.UserID)
+		if err != nil {
+			return nil, err
+		}
+		wu, err = s.loadWebAuthnUser(user)
+		return wu, err
+	}
+
+	_, credential, err := s.webAuthn.ValidatePasskeyLogin(handler, *data, parsed)
+	if err != nil {
+		log.Printf("Falha na verificação do login WebAuthn: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Falha na verificação da passkey."})
+		return
+	}
+
+	ok, err := s.recordWebAuthnUse(c, wu, credential)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atualizar passkey."})
+		return
+	}
+	if !ok {
+		log.Printf("Possível passkey clonada para userID %d", wu.user.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Falha na verificação da passkey."})
+		return
+	}
+
+	if s.loginBlocked(c, wu.user) {
+		return
+	}
+	s.issueToken(c, wu.user, "")
+}
+
+// BeginWebAuthnMFA inicia o uso de uma passkey como segundo fator do login com senha
+func (s *userServiceImpl) BeginWebAuthnMFA(c *gin.Context) {
+	var req WebAuthnMFABeginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	user := s.mfaChallengeUser(c, req.MFAToken)
+	if user == nil {
+		return
+	}
+
+	wu, err := s.loadWebAuthnUser(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar passkeys."})
+		return
+	}
+	if len(wu.credentials) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Nenhuma passkey registrada."})
+		return
+	}
+
+	assertion, data, err := s.webAuthn.BeginLogin(wu)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao iniciar verificação com passkey."})
+		return
+	}
+
+	sessionID, err := s.saveWebAuthnSession(&user.ID, webAuthnPurposeMFA, data)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao salvar sessão WebAuthn."})
+		return
+	}
+
+	c.JSON(http.StatusOK, WebAuthnBeginResponse{SessionID: sessionID, Options: assertion})
+}
+
+// FinishWebAuthnMFA conclui o desafio MFA com a asserção da passkey
+func (s *userServiceImpl) FinishWebAuthnMFA(c *gin.Context) {
+	var req WebAuthnLoginFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados de requisição inválidos: " + err.Error()})
+		return
+	}
+
+	if err := s.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Campos obrigatórios ausentes ou inválidos: " + err.Error()})
+		return
+	}
+
+	user, challenge := s.mfaChallenge(c, req.MFAToken)
+	if user == nil {
+		return
+	}
+	if !s.attemptMFAChallenge(c, user, challenge) {
+		return
+	}
+
+	data, err := s.takeWebAuthnSession(req.SessionID, webAuthnPurposeMFA, &user.ID)
+	if err != nil {
+		respondWebAuthnSessionError(c, err)
+		return
+	}
+
+	wu, err := s.loadWebAuthnUser(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar passkeys."})
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Resposta do autenticador inválida."})
+		return
+	}
+
+	credential, err := s.webAuthn.ValidateLogin(wu, *data, parsed)
+	if err != nil {
+		log.Printf("Falha na verificação WebAuthn (MFA) para userID %d: %v", user.ID, err)
+		s.failMFA(c, user, MFAMethodWebAuthn, "Falha na verificação da passkey.")
+		return
+	}
+
+	ok, err := s.recordWebAuthnUse(c, wu, credential)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atualizar passkey."})
+		return
+	}
+	if !ok {
+		log.Printf("Possível passkey clonada para userID %d", user.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Falha na verificação da passkey."})
+		return
+	}
+
+	s.finishMFAChallenge(c, user, challenge, req.RememberDevice, req.DeviceName)
+}
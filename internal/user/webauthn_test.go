@@ -0,0 +1,330 @@
+package user
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:5500"
+)
+
+var b64url = base64.RawURLEncoding
+
+// softAuthenticator é um autenticador de software (ES256, atestação "none") que responde
+// às cerimônias como um navegador faria
+type softAuthenticator struct {
+	key        *ecdsa.PrivateKey
+	credID     []byte
+	userHandle []byte
+	signCount  uint32
+	origin     string
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credID := make([]byte, 16)
+	rand.Read(credID)
+	return &softAuthenticator{key: key, credID: credID, origin: testOrigin}
+}
+
+// authData monta os dados do autenticador: hash do RP ID, flags e contador
+func (a *softAuthenticator) authData(flags byte) []byte {
+	rpHash := sha256.Sum256([]byte(testRPID))
+	data := append([]byte{}, rpHash[:]...)
+	data = append(data, flags)
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremony, challenge string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]string{"type": ceremony, "challenge": challenge, "origin": a.origin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// create responde às opções de registro com uma nova credencial
+func (a *softAuthenticator) create(t *testing.T, options map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	publicKey := options["publicKey"].(map[string]interface{})
+	handle, err := b64url.DecodeString(publicKey["user"].(map[string]interface{})["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.userHandle = handle
+
+	x := a.key.PublicKey.X.FillBytes(make([]byte, 32))
+	y := a.key.PublicKey.Y.FillBytes(make([]byte, 32))
+	cose, err := cbor.Marshal(map[int]interface{}{1: 2, 3: -7, -1: 1, -2: x, -3: y})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := a.authData(0x45)                 // UP | UV | AT
+	data = append(data, make([]byte, 16)...) // AAGUID
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.credID)))
+	data = append(data, a.credID...)
+	data = append(data, cose...)
+	attestation, err := cbor.Marshal(map[string]interface{}{"fmt": "none", "attStmt": map[string]interface{}{}, "authData": data})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]interface{}{
+		"id":    b64url.EncodeToString(a.credID),
+		"rawId": b64url.EncodeToString(a.credID),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64url.EncodeToString(a.clientData(t, "webauthn.create", publicKey["challenge"].(string))),
+			"attestationObject": b64url.EncodeToString(attestation),
+		},
+	}
+}
+
+// get responde às opções de login com uma asserção assinada, usando o contador atual
+func (a *softAuthenticator) get(t *testing.T, options map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	challenge := options["publicKey"].(map[string]interface{})["challenge"].(string)
+	clientData := a.clientData(t, "webauthn.get", challenge)
+	data := a.authData(0x05) // UP | UV
+
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, data...), clientHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]interface{}{
+		"id":    b64url.EncodeToString(a.credID),
+		"rawId": b64url.EncodeToString(a.credID),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64url.EncodeToString(clientData),
+			"authenticatorData": b64url.EncodeToString(data),
+			"signature":         b64url.EncodeToString(signature),
+			"userHandle":        b64url.EncodeToString(a.userHandle),
+		},
+	}
+}
+
+// newWebAuthnTestServer expõe as rotas de registro (como o usuário informado) e de login com passkey
+func newWebAuthnTestServer(t *testing.T) (*gorm.DB, *userServiceImpl, *gin.Engine, *User) {
+	t.Helper()
+	db, s := newTestService(t)
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:                  testRPID,
+		RPDisplayName:         "teste",
+		RPOrigins:             []string{testOrigin},
+		AttestationPreference: protocol.PreferNoAttestation,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.webAuthn = wa
+	user := createTestUser(t, s.repo, "carol")
+
+	r := gin.New()
+	account := r.Group("", func(c *gin.Context) { c.Set("userID", user.ID) })
+	account.POST("/register/begin", s.BeginWebAuthnRegistration)
+	account.POST("/register/finish", s.FinishWebAuthnRegistration)
+	r.POST("/login/begin", s.BeginWebAuthnLogin)
+	r.POST("/login/finish", s.FinishWebAuthnLogin)
+	return db, s, r, user
+}
+
+func registerSoftAuthenticator(t *testing.T, r *gin.Engine, a *softAuthenticator) (int, map[string]interface{}) {
+	t.Helper()
+	code, begin := doJSON(t, r, "POST", "/register/begin", nil)
+	if code != http.StatusOK {
+		t.Fatalf("register/begin: %d %v", code, begin)
+	}
+	credential := a.create(t, begin["options"].(map[string]interface{}))
+	return doJSON(t, r, "POST", "/register/finish", map[string]interface{}{
+		"session_id": begin["session_id"], "name": "chave", "credential": credential,
+	})
+}
+
+func loginSoftAuthenticator(t *testing.T, r *gin.Engine, a *softAuthenticator) (int, map[string]interface{}) {
+	t.Helper()
+	code, begin := doJSON(t, r, "POST", "/login/begin", nil)
+	if code != http.StatusOK {
+		t.Fatalf("login/begin: %d %v", code, begin)
+	}
+	assertion := a.get(t, begin["options"].(map[string]interface{}))
+	return doJSON(t, r, "POST", "/login/finish", map[string]interface{}{"session_id": begin["session_id"], "credential": assertion})
+}
+
+func TestWebAuthnRegistrationAndLogin(t *testing.T) {
+	_, s, r, user := newWebAuthnTestServer(t)
+	a := newSoftAuthenticator(t)
+
+	if code, body := registerSoftAuthenticator(t, r, a); code != http.StatusCreated {
+		t.Fatalf("registro: %d %v", code, body)
+	}
+
+	a.signCount = 1
+	code, body := loginSoftAuthenticator(t, r, a)
+	if code != http.StatusOK || body["token"] == nil {
+		t.Fatalf("login: %d %v", code, body)
+	}
+
+	credentials, err := s.repo.GetWebAuthnCredentialsByUserID(user.ID)
+	if err != nil || len(credentials) != 1 {
+		t.Fatalf("passkeys: %v %v", credentials, err)
+	}
+	if credentials[0].SignCount != 1 || credentials[0].LastUsedAt == nil {
+		t.Errorf("contador não atualizado: %+v", credentials[0])
+	}
+}
+
+func TestWebAuthnSessionIsSingleUse(t *testing.T) {
+	_, _, r, _ := newWebAuthnTestServer(t)
+	a := newSoftAuthenticator(t)
+	registerSoftAuthenticator(t, r, a)
+
+	_, begin := doJSON(t, r, "POST", "/login/begin", nil)
+	a.signCount = 1
+	request := map[string]interface{}{"session_id": begin["session_id"], "credential": a.get(t, begin["options"].(map[string]interface{}))}
+	if code, body := doJSON(t, r, "POST", "/login/finish", request); code != http.StatusOK {
+		t.Fatalf("login: %d %v", code, body)
+	}
+	if code, _ := doJSON(t, r, "POST", "/login/finish", request); code != http.StatusBadRequest {
+		t.Errorf("sessão reutilizada: esperado 400, obtido %d", code)
+	}
+}
+
+func TestWebAuthnSignCountRegression(t *testing.T) {
+	db, s, r, user := newWebAuthnTestServer(t)
+	a := newSoftAuthenticator(t)
+	registerSoftAuthenticator(t, r, a)
+
+	a.signCount = 5
+	if code, body := loginSoftAuthenticator(t, r, a); code != http.StatusOK {
+		t.Fatalf("login: %d %v", code, body)
+	}
+
+	// Um clone ainda com o contador antigo
+	a.signCount = 3
+	if code, _ := loginSoftAuthenticator(t, r, a); code != http.StatusUnauthorized {
+		t.Fatalf("contador regredido: esperado 401, obtido %d", code)
+	}
+	credentials, _ := s.repo.GetWebAuthnCredentialsByUserID(user.ID)
+	if !credentials[0].CloneWarning || credentials[0].SignCount != 5 {
+		t.Errorf("esperado alerta de clonagem mantendo o contador 5: %+v", credentials[0])
+	}
+	var events int64
+	db.Model(&AuditEvent{}).Where("user_id = ? AND action = ?", user.ID, AuditWebAuthnCloneWarning).Count(&events)
+	if events != 1 {
+		t.Errorf("esperado 1 evento de auditoria, obtido %d", events)
+	}
+
+	// O autenticador legítimo continua e o alerta é limpo
+	a.signCount = 6
+	if code, body := loginSoftAuthenticator(t, r, a); code != http.StatusOK {
+		t.Fatalf("login após o alerta: %d %v", code, body)
+	}
+	credentials, _ = s.repo.GetWebAuthnCredentialsByUserID(user.ID)
+	if credentials[0].CloneWarning || credentials[0].SignCount != 6 {
+		t.Errorf("alerta de clonagem não foi limpo: %+v", credentials[0])
+	}
+}
+
+func TestWebAuthnRejectsMismatchedOrigin(t *testing.T) {
+	_, s, r, user := newWebAuthnTestServer(t)
+	a := newSoftAuthenticator(t)
+
+	a.origin = "https://evil.example"
+	if code, _ := registerSoftAuthenticator(t, r, a); code != http.StatusBadRequest {
+		t.Fatalf("registro com origem errada: esperado 400, obtido %d", code)
+	}
+	if n, _ := s.repo.CountWebAuthnCredentials(user.ID); n != 0 {
+		t.Fatalf("passkey gravada apesar da origem errada")
+	}
+
+	a.origin = testOrigin
+	registerSoftAuthenticator(t, r, a)
+	a.origin = "https://evil.example"
+	a.signCount = 1
+	if code, _ := loginSoftAuthenticator(t, r, a); code != http.StatusUnauthorized {
+		t.Errorf("login com origem errada: esperado 401, obtido %d", code)
+	}
+}
+
+func TestWebAuthnRejectsMismatchedChallenge(t *testing.T) {
+	_, _, r, _ := newWebAuthnTestServer(t)
+	a := newSoftAuthenticator(t)
+	registerSoftAuthenticator(t, r, a)
+
+	_, first := doJSON(t, r, "POST", "/login/begin", nil)
+	_, second := doJSON(t, r, "POST", "/login/begin", nil)
+
+	// Asserção assinada sobre o desafio da primeira sessão, enviada com a segunda
+	a.signCount = 1
+	assertion := a.get(t, first["options"].(map[string]interface{}))
+	code, _ := doJSON(t, r, "POST", "/login/finish", map[string]interface{}{"session_id": second["session_id"], "credential": assertion})
+	if code != http.StatusUnauthorized {
+		t.Errorf("desafio trocado: esperado 401, obtido %d", code)
+	}
+}
+
+// eraseOnCredentialsLoadRepository apaga o usuário logo depois de carregar as passkeys dele,
+// quando armed, simulando um apagamento concorrente com o login por passkey
+type eraseOnCredentialsLoadRepository struct {
+	UserRepository
+	t     *testing.T
+	armed *bool
+}
+
+func (r eraseOnCredentialsLoadRepository) GetWebAuthnCredentialsByUserID(userID uint) ([]WebAuthnCredential, error) {
+	credentials, err := r.UserRepository.GetWebAuthnCredentialsByUserID(userID)
+	if err == nil && *r.armed {
+		if _, err := eraseUser(r.UserRepository, userID, ErasureAdminRequest, nil); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+	return credentials, err
+}
+
+func TestWebAuthnLoginDoesNotRecreateErasedPasskey(t *testing.T) {
+	db, s, r, user := newWebAuthnTestServer(t)
+	a := newSoftAuthenticator(t)
+	if code, body := registerSoftAuthenticator(t, r, a); code != http.StatusCreated {
+		t.Fatalf("registro: %d %v", code, body)
+	}
+
+	armed := true
+	s.repo = eraseOnCredentialsLoadRepository{UserRepository: s.repo, t: t, armed: &armed}
+	a.signCount = 1
+	if code, _ := loginSoftAuthenticator(t, r, a); code == http.StatusOK {
+		t.Fatal("login concluído com a conta apagada durante a cerimônia")
+	}
+
+	var credentials int64
+	if err := db.Model(&WebAuthnCredential{}).Where("user_id = ?", user.ID).Count(&credentials).Error; err != nil {
+		t.Fatal(err)
+	}
+	if credentials != 0 {
+		t.Errorf("passkey apagada foi recriada: %d registro(s)", credentials)
+	}
+}